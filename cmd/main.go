@@ -5,12 +5,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"os/signal"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/qj0r9j0vc2/blocktime-calculator/internal/cache"
 	"github.com/qj0r9j0vc2/blocktime-calculator/internal/calculator"
 	"github.com/qj0r9j0vc2/blocktime-calculator/internal/client"
 	"github.com/qj0r9j0vc2/blocktime-calculator/internal/config"
+	"github.com/qj0r9j0vc2/blocktime-calculator/internal/export"
 	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -49,6 +55,47 @@ with outlier removal and confidence-based range estimation.`,
 		RunE:  runPredict,
 	}
 
+	watchCmd = &cobra.Command{
+		Use:   "watch",
+		Short: "Watch new blocks as they are committed",
+		Long:  `Print every new block with its block time as it is committed, using the node's websocket`,
+		RunE:  runWatch,
+	}
+
+	findHeightCmd = &cobra.Command{
+		Use:   "find-height",
+		Short: "Find the height of the chain at a point in time",
+		Long:  `Find the first block committed at or after a timestamp`,
+		RunE:  runFindHeight,
+	}
+
+	exportCmd = &cobra.Command{
+		Use:   "export",
+		Short: "Export blocks to a file",
+		Long:  `Export the blocks of a range with their block times as JSONL, CSV or Parquet, resuming interrupted exports`,
+		RunE:  runExport,
+	}
+
+	cacheCmd = &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the block header cache",
+		Long:  `Inspect and prune the on-disk cache of block headers shared by all commands`,
+	}
+
+	cacheInfoCmd = &cobra.Command{
+		Use:   "info",
+		Short: "Show cache statistics",
+		Long:  `Show the cache location, size and cached height ranges per chain`,
+		RunE:  runCacheInfo,
+	}
+
+	cachePruneCmd = &cobra.Command{
+		Use:   "prune",
+		Short: "Delete cached blocks",
+		Long:  `Delete cached blocks of the configured chain, or of all chains with --all`,
+		RunE:  runCachePrune,
+	}
+
 	configCmd = &cobra.Command{
 		Use:   "config",
 		Short: "Generate default configuration",
@@ -62,9 +109,33 @@ func init() {
 
 	// Global flags
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default: ./config.yaml)")
-	rootCmd.PersistentFlags().String("rpc", "", "RPC endpoint URL")
+	rootCmd.PersistentFlags().StringSlice("rpc", nil, "RPC endpoint URL (repeat for failover across several endpoints)")
+	rootCmd.PersistentFlags().StringSlice("grpc", nil, "gRPC endpoint address (used with --transport grpc, repeat for failover)")
+	rootCmd.PersistentFlags().StringSlice("rest", nil, "REST (LCD) endpoint URL (used with --transport rest, repeat for failover)")
+	rootCmd.PersistentFlags().String("evm", "", "EVM JSON-RPC endpoint URL (used with --transport evm)")
+	rootCmd.PersistentFlags().String("home", "", "Read blocks offline from the data directory of this CometBFT node home")
+	rootCmd.PersistentFlags().String("from-file", "", "Replay blocks from a JSONL or CSV file written by export instead of querying a node")
+	rootCmd.PersistentFlags().String("simulate", "", "Query a chain simulated from this YAML spec instead of a node")
+	rootCmd.PersistentFlags().Bool("commits", false, "Record the commit round and signatures of every block (fetches full blocks instead of headers)")
+	rootCmd.PersistentFlags().Bool("load", false, "Record the gas, events and size of every block and relate block times to them (fetches block results, rpc or --home only)")
+	rootCmd.PersistentFlags().String("transport", "rpc", "Node API to query (rpc, grpc, rest, evm)")
 	rootCmd.PersistentFlags().String("chain-id", "cosmoshub-4", "Chain ID")
+	rootCmd.PersistentFlags().Bool("skip-chain-id-check", false, "Use the node even if it serves another chain than --chain-id")
+	rootCmd.PersistentFlags().Bool("allow-catching-up", false, "Use the node even if it is still catching up")
 	rootCmd.PersistentFlags().Duration("timeout", 30*time.Second, "Request timeout")
+	rootCmd.PersistentFlags().Int("max-retries", 3, "Maximum retries for transient request failures")
+	rootCmd.PersistentFlags().Duration("retry-delay", time.Second, "Initial delay between retries (doubled on each retry)")
+	rootCmd.PersistentFlags().Int("max-concurrency", 10, "Maximum concurrent requests per endpoint (lowered automatically when the node throttles)")
+	rootCmd.PersistentFlags().Float64("rps", 0, "Maximum requests per second per endpoint (0 for unlimited)")
+	rootCmd.PersistentFlags().Bool("light", false, "Verify block headers with a light client against --trust-height and --trust-hash")
+	rootCmd.PersistentFlags().Int64("trust-height", 0, "Height of the trusted header for light client verification")
+	rootCmd.PersistentFlags().String("trust-hash", "", "Hex hash of the trusted header for light client verification")
+	rootCmd.PersistentFlags().Duration("trust-period", 168*time.Hour, "How long verified headers are trusted, well below the unbonding period")
+	rootCmd.PersistentFlags().StringSlice("witness", nil, "RPC endpoint cross-checking the primary during light client verification (repeatable)")
+	rootCmd.PersistentFlags().Bool("allow-gaps", false, "Skip blocks that cannot be fetched instead of failing")
+	rootCmd.PersistentFlags().Bool("verify-linkage", false, "Check that every fetched block links to its predecessor by hash")
+	rootCmd.PersistentFlags().Bool("no-cache", false, "Do not use the block header cache")
+	rootCmd.PersistentFlags().String("cache-dir", "", "Block header cache directory (default: ~/.cache/blocktime-calculator)")
 
 	// Calculate command flags
 	calculateCmd.Flags().Int("sample-size", 100, "Number of blocks to analyze")
@@ -89,17 +160,52 @@ func init() {
 	predictCmd.Flags().String("output", "text", "Output format (json, text, table)")
 	predictCmd.Flags().Bool("verbose", false, "Show detailed statistics")
 
+	// Watch command flags
+	watchCmd.Flags().String("output", "text", "Output format (json, text)")
+
+	// Find-height command flags
+	findHeightCmd.Flags().String("time", "", "Timestamp to find the height for (RFC3339, e.g. 2026-03-01T00:00:00Z)")
+	findHeightCmd.Flags().Int("max-lookups", 64, "Maximum number of block lookups")
+	findHeightCmd.Flags().String("output", "text", "Output format (json, text)")
+	findHeightCmd.MarkFlagRequired("time")
+
+	// Export command flags
+	exportCmd.Flags().Int64("start-height", 0, "First height to export")
+	exportCmd.Flags().Int64("end-height", 0, "Last height to export (0 for latest)")
+	exportCmd.Flags().String("format", "", "Output file format (jsonl, csv, parquet; default: from the --out extension)")
+	exportCmd.Flags().String("out", "", "Output file")
+	exportCmd.Flags().Int("checkpoint-every", 1000, "Blocks written between resumable checkpoints")
+	exportCmd.Flags().Bool("verbose", false, "Print progress to stderr")
+	exportCmd.MarkFlagRequired("start-height")
+	exportCmd.MarkFlagRequired("out")
+
+	// Cache command flags
+	cachePruneCmd.Flags().Bool("all", false, "Delete cached blocks of all chains")
+	cachePruneCmd.Flags().Int64("below", 0, "Only delete blocks below this height")
+
 	// Bind flags to viper
 	viper.BindPFlags(rootCmd.PersistentFlags())
 	viper.BindPFlags(calculateCmd.Flags())
 	viper.BindPFlags(analyzeCmd.Flags())
 	viper.BindPFlags(predictCmd.Flags())
 
+	// --chain is bound under another key, as "chain" holds the chain section of the config file
+	rootCmd.PersistentFlags().String("chain", "", "Chain name to resolve from the chain registry (e.g. osmosis)")
+	rootCmd.PersistentFlags().String("registry", "", "Chain registry directory (default: bundled snapshot)")
+	viper.BindPFlag("chain-name", rootCmd.PersistentFlags().Lookup("chain"))
+	viper.BindPFlag("registry", rootCmd.PersistentFlags().Lookup("registry"))
+
 	// Add commands
 	rootCmd.AddCommand(calculateCmd)
 	rootCmd.AddCommand(analyzeCmd)
 	rootCmd.AddCommand(predictCmd)
+	rootCmd.AddCommand(watchCmd)
+	rootCmd.AddCommand(findHeightCmd)
+	rootCmd.AddCommand(exportCmd)
 	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheInfoCmd)
+	cacheCmd.AddCommand(cachePruneCmd)
 }
 
 func initConfig() {
@@ -127,13 +233,18 @@ func runCalculate(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to build config: %w", err)
 	}
 
+	// The command's own flag wins over the configuration
+	if cmd.Flags().Changed("verbose") {
+		cfg.Output.Verbose, _ = cmd.Flags().GetBool("verbose")
+	}
+
 	// Validate RPC endpoint
-	if cfg.Chain.RPCEndpoint == "" {
+	if cfg.Chain.Transport == client.TransportRPC && cfg.Chain.RPCEndpoint == "" {
 		return fmt.Errorf("RPC endpoint is required (use --rpc flag or config file)")
 	}
 
 	// Create client
-	blockClient, err := client.NewCosmosSDKClient(&cfg.Chain)
+	blockClient, err := newBlockchainClient(cfg)
 	if err != nil {
 		return fmt.Errorf("failed to create client: %w", err)
 	}
@@ -163,6 +274,8 @@ func runCalculate(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to calculate statistics: %w", err)
 	}
 
+	warnUnverified(cfg, stats.UnverifiedBlocks)
+
 	// Output results - check if flag was explicitly set
 	outputFormat := cfg.Output.Format
 	if cmd.Flags().Changed("output") {
@@ -173,11 +286,14 @@ func runCalculate(cmd *cobra.Command, args []string) error {
 	}
 
 	verbose := cfg.Output.Verbose
-	if cmd.Flags().Changed("verbose") {
-		verbose = viper.GetBool("verbose")
+	if err := outputStats(stats, outputFormat, verbose); err != nil {
+		return err
 	}
 
-	return outputStats(stats, outputFormat, verbose)
+	if verbose {
+		printClientStats(blockClient)
+	}
+	return nil
 }
 
 func runAnalyze(cmd *cobra.Command, args []string) error {
@@ -188,12 +304,12 @@ func runAnalyze(cmd *cobra.Command, args []string) error {
 	}
 
 	// Validate RPC endpoint
-	if cfg.Chain.RPCEndpoint == "" {
+	if cfg.Chain.Transport == client.TransportRPC && cfg.Chain.RPCEndpoint == "" {
 		return fmt.Errorf("RPC endpoint is required (use --rpc flag or config file)")
 	}
 
 	// Create client
-	blockClient, err := client.NewCosmosSDKClient(&cfg.Chain)
+	blockClient, err := newBlockchainClient(cfg)
 	if err != nil {
 		return fmt.Errorf("failed to create client: %w", err)
 	}
@@ -218,17 +334,51 @@ func runAnalyze(cmd *cobra.Command, args []string) error {
 		startHeight = 1
 	}
 
-	blocks, err := blockClient.GetBlockRange(ctx, startHeight, latestHeight)
-	if err != nil {
-		return fmt.Errorf("failed to get blocks: %w", err)
+	var blocks []*types.BlockInfo
+	if cfg.Calculator.AllowGaps {
+		blockRange, err := client.GetBlockRangeWithGaps(ctx, blockClient, startHeight, latestHeight)
+		if err != nil {
+			return fmt.Errorf("failed to get blocks: %w", err)
+		}
+		if len(blockRange.Missing) > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: skipped %d blocks that could not be fetched\n", len(blockRange.Missing))
+		}
+		blocks = blockRange.Blocks
+	} else {
+		blocks, err = blockClient.GetBlockRange(ctx, startHeight, latestHeight)
+		if err != nil {
+			return fmt.Errorf("failed to get blocks: %w", err)
+		}
 	}
 
+	if cfg.Calculator.VerifyLinkage {
+		if err := client.VerifyLinkage(blocks); err != nil {
+			return fmt.Errorf("block linkage check failed: %w", err)
+		}
+	}
+
+	var unverified int
+	for _, block := range blocks {
+		if !block.Verified {
+			unverified++
+		}
+	}
+	warnUnverified(cfg, unverified)
+
 	// Analyze proposer patterns
 	proposerStats := calc.AnalyzeProposerPatterns(ctx, blocks)
 
+	// Name the proposers where the source knows their validators
+	validators, err := client.ResolveValidators(ctx, blockClient, blocks)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: proposers are shown by address: %v\n", err)
+	} else if err := client.DescribeValidators(ctx, blockClient, validators, cfg.Chain.Bech32Prefix); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: proposers are shown without monikers: %v\n", err)
+	}
+
 	// Output results
 	outputFormat := viper.GetString("output")
-	return outputProposerStats(proposerStats, outputFormat)
+	return outputProposerStats(proposerStats, validators, outputFormat)
 }
 
 func runPredict(cmd *cobra.Command, args []string) error {
@@ -238,13 +388,18 @@ func runPredict(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to build config: %w", err)
 	}
 
+	// The command's own flag wins over the configuration
+	if cmd.Flags().Changed("verbose") {
+		cfg.Output.Verbose, _ = cmd.Flags().GetBool("verbose")
+	}
+
 	// Validate RPC endpoint
-	if cfg.Chain.RPCEndpoint == "" {
+	if cfg.Chain.Transport == client.TransportRPC && cfg.Chain.RPCEndpoint == "" {
 		return fmt.Errorf("RPC endpoint is required (use --rpc flag or config file)")
 	}
 
 	// Create client
-	blockClient, err := client.NewCosmosSDKClient(&cfg.Chain)
+	blockClient, err := newBlockchainClient(cfg)
 	if err != nil {
 		return fmt.Errorf("failed to create client: %w", err)
 	}
@@ -281,8 +436,8 @@ func runPredict(cmd *cobra.Command, args []string) error {
 	}
 
 	verbose := cfg.Output.Verbose
-	if cmd.Flags().Changed("verbose") {
-		verbose = viper.GetBool("verbose")
+	if verbose {
+		defer printClientStats(blockClient)
 	}
 
 	// Predict next N blocks
@@ -291,6 +446,7 @@ func runPredict(cmd *cobra.Command, args []string) error {
 		if err != nil {
 			return fmt.Errorf("failed to predict next blocks: %w", err)
 		}
+		warnUnverifiedResult(cfg, prediction.Verified, "prediction")
 		return outputMultiBlockPrediction(prediction, outputFormat, verbose)
 	}
 
@@ -300,6 +456,7 @@ func runPredict(cmd *cobra.Command, args []string) error {
 		if err != nil {
 			return fmt.Errorf("failed to predict block time: %w", err)
 		}
+		warnUnverifiedResult(cfg, prediction.Verified, "prediction")
 		return outputPrediction(prediction, outputFormat, verbose)
 	}
 
@@ -308,9 +465,250 @@ func runPredict(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return fmt.Errorf("failed to predict next blocks: %w", err)
 	}
+	warnUnverifiedResult(cfg, prediction.Verified, "prediction")
 	return outputMultiBlockPrediction(prediction, outputFormat, verbose)
 }
 
+func runWatch(cmd *cobra.Command, args []string) error {
+	// Build configuration
+	cfg, err := config.BuildConfig()
+	if err != nil {
+		return fmt.Errorf("failed to build config: %w", err)
+	}
+
+	// Validate RPC endpoint
+	if cfg.Chain.Transport == client.TransportRPC && cfg.Chain.RPCEndpoint == "" {
+		return fmt.Errorf("RPC endpoint is required (use --rpc flag or config file)")
+	}
+
+	// Create client
+	blockClient, err := newBlockchainClient(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create client: %w", err)
+	}
+	defer blockClient.Close()
+
+	subscriber, ok := client.FindSubscriber(blockClient)
+	if !ok {
+		return fmt.Errorf("the configured client does not support subscriptions")
+	}
+
+	// Watch until interrupted
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	outputFormat, _ := cmd.Flags().GetString("output")
+	blockChan, errChan := subscriber.SubscribeNewBlocks(ctx)
+	for {
+		select {
+		case block, ok := <-blockChan:
+			if !ok {
+				// Short of an interrupt, the subscription ends on a header
+				// that failed light client verification
+				if ctx.Err() == nil && errChan != nil {
+					var last error
+					for err := range errChan {
+						last = err
+					}
+					return last
+				}
+				return nil
+			}
+			if err := outputBlock(block, outputFormat); err != nil {
+				return err
+			}
+
+		case err, ok := <-errChan:
+			if ok {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			} else {
+				errChan = nil
+			}
+		}
+	}
+}
+
+func runFindHeight(cmd *cobra.Command, args []string) error {
+	timeFlag, _ := cmd.Flags().GetString("time")
+	target, err := time.Parse(time.RFC3339, timeFlag)
+	if err != nil {
+		return fmt.Errorf("invalid time %q (use RFC3339, e.g. 2026-03-01T00:00:00Z): %w", timeFlag, err)
+	}
+
+	// Build configuration
+	cfg, err := config.BuildConfig()
+	if err != nil {
+		return fmt.Errorf("failed to build config: %w", err)
+	}
+
+	// Validate RPC endpoint
+	if cfg.Chain.Transport == client.TransportRPC && cfg.Chain.RPCEndpoint == "" {
+		return fmt.Errorf("RPC endpoint is required (use --rpc flag or config file)")
+	}
+
+	// Create client
+	blockClient, err := newBlockchainClient(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create client: %w", err)
+	}
+	defer blockClient.Close()
+
+	maxLookups, _ := cmd.Flags().GetInt("max-lookups")
+	result, err := client.FindHeightAtTime(context.Background(), blockClient, target, client.SearchOptions{
+		MaxLookups: maxLookups,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to find height: %w", err)
+	}
+	warnUnverifiedResult(cfg, result.Verified, "height")
+
+	outputFormat, _ := cmd.Flags().GetString("output")
+	return outputHeightSearch(target, result, outputFormat)
+}
+
+func runExport(cmd *cobra.Command, args []string) error {
+	out, _ := cmd.Flags().GetString("out")
+	format, _ := cmd.Flags().GetString("format")
+	if format == "" {
+		format = export.FormatFromPath(out)
+	}
+
+	// Build configuration
+	cfg, err := config.BuildConfig()
+	if err != nil {
+		return fmt.Errorf("failed to build config: %w", err)
+	}
+
+	verbose, _ := cmd.Flags().GetBool("verbose")
+	cfg.Output.Verbose = verbose
+
+	// Validate RPC endpoint
+	if cfg.Chain.Transport == client.TransportRPC && cfg.Chain.RPCEndpoint == "" {
+		return fmt.Errorf("RPC endpoint is required (use --rpc flag or config file)")
+	}
+
+	// Create client
+	blockClient, err := newBlockchainClient(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create client: %w", err)
+	}
+	defer blockClient.Close()
+
+	// Interrupting saves a checkpoint, so the export can be resumed
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	startHeight, _ := cmd.Flags().GetInt64("start-height")
+	endHeight, _ := cmd.Flags().GetInt64("end-height")
+	checkpointEvery, _ := cmd.Flags().GetInt("checkpoint-every")
+
+	opts := export.Options{
+		ChainID:         cfg.Chain.ChainID,
+		Format:          format,
+		Path:            out,
+		StartHeight:     startHeight,
+		EndHeight:       endHeight,
+		CheckpointEvery: checkpointEvery,
+		AllowGaps:       cfg.Calculator.AllowGaps,
+		VerifyLinkage:   cfg.Calculator.VerifyLinkage,
+	}
+	if verbose {
+		opts.Progress = func(height int64, rows int64) {
+			fmt.Fprintf(os.Stderr, "Exported %d blocks up to height %d\n", rows, height)
+		}
+	}
+
+	result, err := export.Export(ctx, blockClient, opts)
+	if err != nil {
+		return fmt.Errorf("failed to export blocks: %w", err)
+	}
+
+	fmt.Printf("Exported %d blocks (%d - %d) to %s as %s\n", result.Rows, result.StartHeight, result.EndHeight, result.Path, result.Format)
+	if result.ResumedFrom > 0 {
+		fmt.Printf("Resumed from height %d\n", result.ResumedFrom)
+	}
+	if result.MissingBlocks > 0 {
+		fmt.Printf("Skipped %d missing blocks\n", result.MissingBlocks)
+	}
+	warnUnverified(cfg, int(result.UnverifiedBlocks))
+
+	if verbose {
+		printClientStats(blockClient)
+	}
+	return nil
+}
+
+func runCacheInfo(cmd *cobra.Command, args []string) error {
+	cfg, err := config.BuildConfig()
+	if err != nil {
+		return fmt.Errorf("failed to build config: %w", err)
+	}
+
+	store, err := openCache(cfg)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	chains, err := store.Info()
+	if err != nil {
+		return err
+	}
+
+	size, err := store.Size()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Block Cache")
+	fmt.Println("===========")
+	fmt.Printf("Directory: %s\n", store.Dir())
+	fmt.Printf("Size: %.1f MB\n", float64(size)/(1<<20))
+
+	if len(chains) == 0 {
+		fmt.Println("\nNo cached blocks")
+		return nil
+	}
+
+	fmt.Printf("\n%-20s | %-10s | %-25s\n", "Chain ID", "Blocks", "Heights")
+	fmt.Println("---------------------|------------|--------------------------")
+	for _, chain := range chains {
+		fmt.Printf("%-20s | %10d | %d - %d\n", chain.ChainID, chain.Entries, chain.MinHeight, chain.MaxHeight)
+	}
+
+	return nil
+}
+
+func runCachePrune(cmd *cobra.Command, args []string) error {
+	cfg, err := config.BuildConfig()
+	if err != nil {
+		return fmt.Errorf("failed to build config: %w", err)
+	}
+
+	all, _ := cmd.Flags().GetBool("all")
+	below, _ := cmd.Flags().GetInt64("below")
+
+	// Prune the configured chain unless all chains are requested
+	chainID := cfg.Chain.ChainID
+	if all {
+		chainID = ""
+	}
+
+	store, err := openCache(cfg)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	deleted, err := store.Prune(chainID, below)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Deleted %d cached blocks\n", deleted)
+	return nil
+}
+
 func runConfig(cmd *cobra.Command, args []string) error {
 	defaultConfig := config.DefaultConfig()
 
@@ -332,6 +730,96 @@ func runConfig(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// newBlockchainClient creates the client for the configuration, with the
+// block header cache in front of it when enabled
+func newBlockchainClient(cfg *config.Config) (client.BlockchainClient, error) {
+	// Show how the clients adapt to the node in verbose mode
+	if cfg.Output.Verbose {
+		cfg.Chain.Logf = func(format string, args ...any) {
+			fmt.Fprintf(os.Stderr, format+"\n", args...)
+		}
+	}
+
+	blockClient, err := client.NewClient(&cfg.Chain)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make sure the node serves the configured chain and is in sync
+	status, err := client.VerifyNode(context.Background(), blockClient, &cfg.Chain)
+	if err != nil {
+		blockClient.Close()
+		return nil, err
+	}
+	if status.ChainID != cfg.Chain.ChainID {
+		fmt.Fprintf(os.Stderr, "Warning: node serves chain %s, not the configured %s\n", status.ChainID, cfg.Chain.ChainID)
+	}
+	if status.CatchingUp {
+		fmt.Fprintf(os.Stderr, "Warning: node is catching up at height %d, results may be outdated\n", status.LatestHeight)
+	}
+
+	if cfg.Chain.Light.Enabled {
+		verifyingClient, err := client.NewVerifyingClient(context.Background(), blockClient, &cfg.Chain)
+		if err != nil {
+			blockClient.Close()
+			return nil, err
+		}
+		blockClient = verifyingClient
+	}
+
+	// Blocks read from disk or simulated gain nothing from the cache
+	if !cfg.Cache.Enabled || cfg.Chain.Home != "" || cfg.Chain.FromFile != "" || cfg.Chain.Simulate != "" {
+		return blockClient, nil
+	}
+
+	// Entries are keyed by the configured chain, so a node serving another
+	// chain must not write into them
+	if cfg.Chain.ChainID == "" || status.ChainID != cfg.Chain.ChainID {
+		fmt.Fprintf(os.Stderr, "Warning: block cache disabled: node serves chain %s, not the configured %q\n", status.ChainID, cfg.Chain.ChainID)
+		return blockClient, nil
+	}
+
+	store, err := openCache(cfg)
+	if err != nil {
+		// The cache only saves requests, so carry on without it
+		fmt.Fprintf(os.Stderr, "Warning: block cache disabled: %v\n", err)
+		return blockClient, nil
+	}
+
+	tipDepth := int64(cache.DefaultTipDepth)
+	if cfg.Chain.Transport == client.TransportEVM {
+		tipDepth = cache.EVMTipDepth
+	}
+
+	cachedClient, err := cache.NewCachedClient(blockClient, store, cfg.Chain.ChainID, cache.Options{
+		TipDepth:        tipDepth,
+		RequireVerified: cfg.Chain.Light.Enabled,
+		RequireCommits:  cfg.Chain.Commits,
+		RequireLoad:     cfg.Chain.Load,
+	})
+	if err != nil {
+		store.Close()
+		blockClient.Close()
+		return nil, err
+	}
+
+	return cachedClient, nil
+}
+
+// openCache opens the block header cache in the configured directory
+func openCache(cfg *config.Config) (*cache.Store, error) {
+	dir := cfg.Cache.Dir
+	if dir == "" {
+		defaultDir, err := cache.DefaultDir()
+		if err != nil {
+			return nil, err
+		}
+		dir = defaultDir
+	}
+
+	return cache.Open(dir)
+}
+
 func outputStats(stats *types.BlockTimeStats, format string, verbose bool) error {
 	// Trim any whitespace from format
 	format = strings.TrimSpace(format)
@@ -350,6 +838,15 @@ func outputStats(stats *types.BlockTimeStats, format string, verbose bool) error
 		fmt.Printf("Sample Size: %d blocks\n", stats.SampleSize)
 		fmt.Printf("Height Range: %d - %d\n", stats.StartHeight, stats.EndHeight)
 		fmt.Printf("Time Range: %s - %s\n", stats.StartTime.Format(time.RFC3339), stats.EndTime.Format(time.RFC3339))
+		if stats.GapCount > 0 {
+			fmt.Printf("Gaps: %d (%d missing blocks)\n", stats.GapCount, stats.MissingBlocks)
+		}
+		if stats.Verified {
+			fmt.Println("Headers: verified by light client")
+		}
+		if stats.Resolution > 0 {
+			fmt.Printf("Timestamp Resolution: %gs (block times are whole multiples)\n", stats.Resolution)
+		}
 		fmt.Println("\nStatistics (seconds):")
 		fmt.Printf("  Mean: %.2f\n", stats.Mean)
 		fmt.Printf("  Median: %.2f\n", stats.Median)
@@ -371,6 +868,22 @@ func outputStats(stats *types.BlockTimeStats, format string, verbose bool) error
 		fmt.Printf("  Upper Bound: %.2f seconds\n", stats.EstimatedRange.Upper)
 		fmt.Printf("  Typical: %.2f seconds\n", stats.EstimatedRange.Typical)
 
+		if r := stats.Rounds; r != nil {
+			fmt.Printf("\nConsensus Rounds:\n")
+			fmt.Printf("  Round 0: %d blocks (%.1f%%), mean %.2fs, median %.2fs, P95 %.2fs\n",
+				r.FirstRound.Blocks, r.FirstRound.Share*100, r.FirstRound.Mean, r.FirstRound.Median, r.FirstRound.P95)
+			fmt.Printf("  Round 1+: %d blocks (%.1f%%), mean %.2fs, median %.2fs, P95 %.2fs\n",
+				r.LaterRounds.Blocks, r.LaterRounds.Share*100, r.LaterRounds.Mean, r.LaterRounds.Median, r.LaterRounds.P95)
+			fmt.Printf("  Slower than P95: %d blocks, %.1f%% after a later round\n", r.TailBlocks, r.TailLaterRounds*100)
+		}
+
+		if l := stats.Load; l != nil {
+			fmt.Printf("\nBlock Load (%d blocks, each block time against the load of the block before):\n", l.Blocks)
+			for _, metric := range loadMetrics(l) {
+				fmt.Printf("  %s: r = %.2f, %+.4fs per %s\n", metric.name, metric.fit.Correlation, metric.fit.Slope*metric.scale, metric.unit)
+			}
+		}
+
 	case "table":
 		fmt.Printf("%-20s | %-15s\n", "Metric", "Value")
 		fmt.Println("---------------------|----------------")
@@ -380,10 +893,31 @@ func outputStats(stats *types.BlockTimeStats, format string, verbose bool) error
 		fmt.Printf("%-20s | %.2f s\n", "Std Dev", stats.StdDev)
 		fmt.Printf("%-20s | %.2f - %.2f s\n", "Range", stats.Min, stats.Max)
 		fmt.Printf("%-20s | %d\n", "Outliers Removed", stats.OutlierCount)
+		if stats.GapCount > 0 {
+			fmt.Printf("%-20s | %d (%d blocks)\n", "Gaps", stats.GapCount, stats.MissingBlocks)
+		}
+		if stats.Verified {
+			fmt.Printf("%-20s | %s\n", "Headers", "verified by light client")
+		}
+		if stats.Resolution > 0 {
+			fmt.Printf("%-20s | %g s\n", "Timestamp Resolution", stats.Resolution)
+		}
 		fmt.Println("---------------------|----------------")
 		fmt.Printf("%-20s | %.2f - %.2f s\n", "Estimated Range", stats.EstimatedRange.Lower, stats.EstimatedRange.Upper)
 		fmt.Printf("%-20s | %.2f s\n", "Typical Block Time", stats.EstimatedRange.Typical)
 		fmt.Printf("%-20s | %.0f%%\n", "Confidence Level", stats.ConfidenceLevel*100)
+		if r := stats.Rounds; r != nil {
+			fmt.Println("---------------------|----------------")
+			fmt.Printf("%-20s | %d blocks, median %.2f s\n", "Round 0", r.FirstRound.Blocks, r.FirstRound.Median)
+			fmt.Printf("%-20s | %d blocks, median %.2f s\n", "Round 1+", r.LaterRounds.Blocks, r.LaterRounds.Median)
+			fmt.Printf("%-20s | %.1f%% of %d blocks\n", "Tail After Round 1+", r.TailLaterRounds*100, r.TailBlocks)
+		}
+		if l := stats.Load; l != nil {
+			fmt.Println("---------------------|----------------")
+			for _, metric := range loadMetrics(l) {
+				fmt.Printf("%-20s | r %.2f, %+.4f s/%s\n", "Load: "+metric.name, metric.fit.Correlation, metric.fit.Slope*metric.scale, metric.unit)
+			}
+		}
 
 	default:
 		return fmt.Errorf("unsupported output format: %s", format)
@@ -392,31 +926,150 @@ func outputStats(stats *types.BlockTimeStats, format string, verbose bool) error
 	return nil
 }
 
-func outputProposerStats(proposerStats map[string]*types.BlockTimeStats, format string) error {
+// loadMetric is a load metric with the unit its slope is shown per
+type loadMetric struct {
+	name  string
+	fit   types.LoadCorrelation
+	unit  string
+	scale float64 // units of the metric in one shown unit
+}
+
+// loadMetrics lists the fits of l in display order
+func loadMetrics(l *types.LoadStats) []loadMetric {
+	return []loadMetric{
+		{"Gas Used", l.GasUsed, "Mgas", 1e6},
+		{"Gas Wanted", l.GasWanted, "Mgas", 1e6},
+		{"Txs", l.Txs, "tx", 1},
+		{"Events", l.Events, "event", 1},
+		{"Size", l.Size, "kB", 1e3},
+	}
+}
+
+// proposerReport is the JSON form of the statistics of a proposer
+type proposerReport struct {
+	*types.BlockTimeStats
+	Validator *types.ValidatorInfo `json:"validator,omitempty"`
+}
+
+func outputProposerStats(proposerStats map[string]*types.BlockTimeStats, validators map[string]*types.ValidatorInfo, format string) error {
 	if len(proposerStats) == 0 {
 		fmt.Println("No proposer statistics available")
 		return nil
 	}
 
+	// Proposers with the most blocks first
+	proposers := make([]string, 0, len(proposerStats))
+	for proposer := range proposerStats {
+		proposers = append(proposers, proposer)
+	}
+	sort.Slice(proposers, func(i, j int) bool {
+		a, b := proposerStats[proposers[i]], proposerStats[proposers[j]]
+		if a.SampleSize != b.SampleSize {
+			return a.SampleSize > b.SampleSize
+		}
+		return proposers[i] < proposers[j]
+	})
+
 	switch format {
 	case "json":
-		data, err := json.MarshalIndent(proposerStats, "", "  ")
+		reports := make(map[string]proposerReport, len(proposerStats))
+		for proposer, stats := range proposerStats {
+			reports[proposer] = proposerReport{BlockTimeStats: stats, Validator: validators[proposer]}
+		}
+		data, err := json.MarshalIndent(reports, "", "  ")
 		if err != nil {
 			return err
 		}
 		fmt.Println(string(data))
 
 	case "table", "text":
-		fmt.Printf("%-40s | %-10s | %-10s | %-10s | %-10s\n", "Proposer", "Blocks", "Mean (s)", "Median (s)", "Std Dev")
-		fmt.Println("------------------------------------------|------------|------------|------------|------------")
+		// Validators are named by moniker and listed with their operator
+		// address, falling back to the consensus address
+		names := make(map[string]string, len(proposers))
+		width := len("Validator")
+		for _, proposer := range proposers {
+			name := proposer
+			if val := validators[proposer]; val != nil && val.Moniker != "" {
+				name = val.Moniker
+			}
+			names[proposer] = name
+			width = max(width, len(name))
+		}
 
-		for proposer, stats := range proposerStats {
-			displayProposer := proposer
-			if len(displayProposer) > 38 {
-				displayProposer = displayProposer[:35] + "..."
+		fmt.Printf("%-*s | %-10s | %-10s | %-10s | %-10s | %-12s | %s\n", width, "Validator", "Blocks", "Mean (s)", "Median (s)", "Std Dev", "Power", "Address")
+		fmt.Printf("%s-|------------|------------|------------|------------|--------------|%s\n", strings.Repeat("-", width), strings.Repeat("-", 42))
+
+		for _, proposer := range proposers {
+			stats := proposerStats[proposer]
+			power, address := "-", proposer
+			if val := validators[proposer]; val != nil {
+				power = strconv.FormatInt(val.VotingPower, 10)
+				if val.OperatorAddress != "" {
+					address = val.OperatorAddress
+				}
 			}
-			fmt.Printf("%-40s | %10d | %10.2f | %10.2f | %10.2f\n",
-				displayProposer, stats.SampleSize, stats.Mean, stats.Median, stats.StdDev)
+			fmt.Printf("%-*s | %10d | %10.2f | %10.2f | %10.2f | %12s | %s\n",
+				width, names[proposer], stats.SampleSize, stats.Mean, stats.Median, stats.StdDev, power, address)
+		}
+
+	default:
+		return fmt.Errorf("unsupported output format: %s", format)
+	}
+
+	return nil
+}
+
+func outputBlock(block *types.BlockInfo, format string) error {
+	format = strings.TrimSpace(format)
+
+	switch format {
+	case "json":
+		data, err := json.Marshal(block)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+
+	case "text":
+		verified := ""
+		if block.Verified {
+			verified = ", verified"
+		}
+		fmt.Printf("Block %d: %s (%.2fs) proposer %s, %d txs%s\n",
+			block.Height,
+			block.Time.Format(time.RFC3339),
+			block.BlockTime,
+			block.Proposer,
+			block.TxCount,
+			verified)
+
+	default:
+		return fmt.Errorf("unsupported output format: %s", format)
+	}
+
+	return nil
+}
+
+func outputHeightSearch(target time.Time, result *client.SearchResult, format string) error {
+	format = strings.TrimSpace(format)
+
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+
+	case "text":
+		fmt.Println("Height at Time")
+		fmt.Println("==============")
+		fmt.Printf("Target Time: %s\n", target.Format(time.RFC3339))
+		fmt.Printf("Height: %d\n", result.Block.Height)
+		fmt.Printf("Block Time: %s\n", result.Block.Time.Format(time.RFC3339))
+		fmt.Printf("Lookups: %d\n", result.Lookups)
+		if result.Verified {
+			fmt.Println("Headers: verified by light client")
 		}
 
 	default:
@@ -444,6 +1097,9 @@ func outputPrediction(pred *calculator.BlockPrediction, format string, verbose b
 		if pred.IsComplete {
 			fmt.Printf("Block %d already exists\n", pred.TargetHeight)
 			fmt.Printf("Created at: %s\n", pred.ActualTime.Format(time.RFC3339))
+			if pred.Verified {
+				fmt.Println("Header: verified by light client")
+			}
 			return nil
 		}
 
@@ -451,6 +1107,9 @@ func outputPrediction(pred *calculator.BlockPrediction, format string, verbose b
 		fmt.Printf("Current Block: %d\n", pred.CurrentHeight)
 		fmt.Printf("Blocks Remaining: %d\n", pred.BlocksLeft)
 		fmt.Printf("Current Time: %s\n", pred.CurrentTime.Format(time.RFC3339))
+		if pred.Verified {
+			fmt.Println("Headers: verified by light client")
+		}
 
 		fmt.Println("\nEstimated Arrival Time:")
 		fmt.Printf("  Typical: %s (in %s)\n",
@@ -482,6 +1141,9 @@ func outputPrediction(pred *calculator.BlockPrediction, format string, verbose b
 		fmt.Printf("%-20s | %s - %s\n", "Range",
 			formatDuration(pred.Duration.Min),
 			formatDuration(pred.Duration.Max))
+		if pred.Verified {
+			fmt.Printf("%-20s | %s\n", "Headers", "verified by light client")
+		}
 
 	default:
 		return fmt.Errorf("unsupported output format: %s", format)
@@ -506,6 +1168,9 @@ func outputMultiBlockPrediction(pred *calculator.MultiBlockPrediction, format st
 		fmt.Println("======================")
 		fmt.Printf("Current Block: %d\n", pred.CurrentHeight)
 		fmt.Printf("Current Time: %s\n", pred.CurrentTime.Format(time.RFC3339))
+		if pred.Verified {
+			fmt.Println("Headers: verified by light client")
+		}
 		fmt.Println("\nUpcoming Blocks:")
 
 		for _, p := range pred.Predictions {
@@ -539,6 +1204,57 @@ func outputMultiBlockPrediction(pred *calculator.MultiBlockPrediction, format st
 	return nil
 }
 
+// warnUnverified warns when light client verification is enabled but results
+// rest on headers it did not verify
+func warnUnverified(cfg *config.Config, unverified int) {
+	if cfg.Chain.Light.Enabled && unverified > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %d block headers were not verified by the light client\n", unverified)
+	}
+}
+
+// warnUnverifiedResult warns when light client verification is enabled but
+// the result rests on headers it did not verify
+func warnUnverifiedResult(cfg *config.Config, verified bool, result string) {
+	if cfg.Chain.Light.Enabled && !verified {
+		fmt.Fprintf(os.Stderr, "Warning: the %s rests on block headers that were not verified by the light client\n", result)
+	}
+}
+
+// printClientStats prints the cache, request and endpoint statistics of the client to stderr
+func printClientStats(blockClient client.BlockchainClient) {
+	for {
+		if cachedClient, ok := blockClient.(*cache.CachedClient); ok {
+			stats := cachedClient.CacheStats()
+			fmt.Fprintf(os.Stderr, "\nCache: %d hits, %d misses\n", stats.Hits, stats.Misses)
+		}
+
+		if statsProvider, ok := blockClient.(client.StatsProvider); ok {
+			stats := statsProvider.Stats()
+			fmt.Fprintf(os.Stderr, "\nRPC Requests: %d (retries: %d, failed: %d)\n",
+				stats.Requests, stats.Retries, stats.Failures)
+			if stats.Throttles > 0 {
+				fmt.Fprintf(os.Stderr, "Throttled: concurrency cut %d times, now %d\n",
+					stats.Throttles, stats.Concurrency)
+			}
+		}
+
+		if endpointStatsProvider, ok := blockClient.(client.EndpointStatsProvider); ok {
+			fmt.Fprintf(os.Stderr, "\n%-40s | %-8s | %-8s | %-10s | %s\n", "Endpoint", "Requests", "Errors", "Latency", "Status")
+			fmt.Fprintln(os.Stderr, "-----------------------------------------|----------|----------|------------|----------------")
+			for _, e := range endpointStatsProvider.EndpointStats() {
+				fmt.Fprintf(os.Stderr, "%-40s | %8d | %8d | %10s | %s\n",
+					e.URL, e.Requests, e.Errors, e.Latency.Round(time.Millisecond), e.Status)
+			}
+		}
+
+		wrapper, ok := blockClient.(client.Wrapper)
+		if !ok {
+			return
+		}
+		blockClient = wrapper.Unwrap()
+	}
+}
+
 func formatDuration(d time.Duration) string {
 	if d < time.Minute {
 		return fmt.Sprintf("%.0f seconds", d.Seconds())
@@ -0,0 +1,285 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	dbm "github.com/cometbft/cometbft-db"
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+const (
+	// dbName is the name of the cache database inside the cache directory
+	dbName = "headers"
+
+	// schemaVersion is bumped whenever the stored BlockInfo changes meaning,
+	// which discards entries written by older versions
+	schemaVersion = "2"
+)
+
+var (
+	schemaKey   = []byte("meta/schema")
+	blockPrefix = []byte("block/")
+)
+
+// Store is a persistent block header cache keyed by chain ID and height
+type Store struct {
+	dir string
+	db  dbm.DB
+}
+
+// ChainInfo summarizes the cached entries of one chain
+type ChainInfo struct {
+	ChainID   string `json:"chain_id"`
+	Entries   int    `json:"entries"`
+	MinHeight int64  `json:"min_height"`
+	MaxHeight int64  `json:"max_height"`
+}
+
+// entry is the stored form of a block
+type entry struct {
+	ChainID string           `json:"chain_id"`
+	Block   *types.BlockInfo `json:"block"`
+}
+
+// DefaultDir returns the default cache directory, ~/.cache/blocktime-calculator on Linux
+func DefaultDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine user cache directory: %w", err)
+	}
+
+	return filepath.Join(dir, "blocktime-calculator"), nil
+}
+
+// Open opens or creates the cache in dir
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	db, err := dbm.NewGoLevelDB(dbName, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cache database: %w", err)
+	}
+
+	store := &Store{dir: dir, db: db}
+	if err := store.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// migrate discards all entries when they were written with another schema version
+func (s *Store) migrate() error {
+	version, err := s.db.Get(schemaKey)
+	if err != nil {
+		return fmt.Errorf("failed to read cache schema: %w", err)
+	}
+
+	if string(version) == schemaVersion {
+		return nil
+	}
+
+	if version != nil {
+		if _, err := s.Prune("", 0); err != nil {
+			return err
+		}
+	}
+
+	if err := s.db.SetSync(schemaKey, []byte(schemaVersion)); err != nil {
+		return fmt.Errorf("failed to write cache schema: %w", err)
+	}
+	return nil
+}
+
+// Dir returns the cache directory
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Get returns the cached block of chainID at height, or nil if it is not cached
+func (s *Store) Get(chainID string, height int64) (*types.BlockInfo, error) {
+	value, err := s.db.Get(blockKey(chainID, height))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read block %d from cache: %w", height, err)
+	}
+	if value == nil {
+		return nil, nil
+	}
+
+	var e entry
+	if err := json.Unmarshal(value, &e); err != nil || e.Block == nil || e.ChainID != chainID || e.Block.Height != height {
+		// Never serve an entry that does not belong where it is stored
+		if err := s.db.Delete(blockKey(chainID, height)); err != nil {
+			return nil, fmt.Errorf("failed to delete invalid cache entry: %w", err)
+		}
+		return nil, nil
+	}
+
+	return e.Block, nil
+}
+
+// Put stores blocks of chainID. Block times are not stored since they depend
+// on the range the block was fetched with
+func (s *Store) Put(chainID string, blocks []*types.BlockInfo) error {
+	batch := s.db.NewBatch()
+	defer batch.Close()
+
+	for _, block := range blocks {
+		stored := *block
+		stored.BlockTime = 0
+
+		value, err := json.Marshal(entry{ChainID: chainID, Block: &stored})
+		if err != nil {
+			return fmt.Errorf("failed to encode block %d: %w", block.Height, err)
+		}
+		if err := batch.Set(blockKey(chainID, block.Height), value); err != nil {
+			return fmt.Errorf("failed to cache block %d: %w", block.Height, err)
+		}
+	}
+
+	if err := batch.Write(); err != nil {
+		return fmt.Errorf("failed to write cache: %w", err)
+	}
+	return nil
+}
+
+// Info summarizes the cached entries per chain
+func (s *Store) Info() ([]ChainInfo, error) {
+	iter, err := dbm.IteratePrefix(s.db, blockPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to iterate cache: %w", err)
+	}
+	defer iter.Close()
+
+	chains := make(map[string]*ChainInfo)
+	for ; iter.Valid(); iter.Next() {
+		chainID, height, ok := parseBlockKey(iter.Key())
+		if !ok {
+			continue
+		}
+
+		info, ok := chains[chainID]
+		if !ok {
+			info = &ChainInfo{ChainID: chainID, MinHeight: height}
+			chains[chainID] = info
+		}
+		info.Entries++
+		if height < info.MinHeight {
+			info.MinHeight = height
+		}
+		if height > info.MaxHeight {
+			info.MaxHeight = height
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return nil, fmt.Errorf("failed to iterate cache: %w", err)
+	}
+
+	infos := make([]ChainInfo, 0, len(chains))
+	for _, info := range chains {
+		infos = append(infos, *info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ChainID < infos[j].ChainID
+	})
+
+	return infos, nil
+}
+
+// Size returns the size of the cache on disk in bytes
+func (s *Store) Size() (int64, error) {
+	var size int64
+	err := filepath.Walk(s.dir, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to determine cache size: %w", err)
+	}
+
+	return size, nil
+}
+
+// Prune deletes cached blocks and returns how many were deleted. An empty
+// chainID matches all chains, and a positive belowHeight only deletes blocks
+// below that height
+func (s *Store) Prune(chainID string, belowHeight int64) (int, error) {
+	prefix := blockPrefix
+	if chainID != "" {
+		prefix = chainPrefix(chainID)
+	}
+
+	iter, err := dbm.IteratePrefix(s.db, prefix)
+	if err != nil {
+		return 0, fmt.Errorf("failed to iterate cache: %w", err)
+	}
+
+	var keys [][]byte
+	for ; iter.Valid(); iter.Next() {
+		_, height, ok := parseBlockKey(iter.Key())
+		if ok && belowHeight > 0 && height >= belowHeight {
+			continue
+		}
+		keys = append(keys, bytes.Clone(iter.Key()))
+	}
+	err = iter.Error()
+	iter.Close()
+	if err != nil {
+		return 0, fmt.Errorf("failed to iterate cache: %w", err)
+	}
+
+	batch := s.db.NewBatch()
+	defer batch.Close()
+	for _, key := range keys {
+		if err := batch.Delete(key); err != nil {
+			return 0, fmt.Errorf("failed to prune cache: %w", err)
+		}
+	}
+	if err := batch.WriteSync(); err != nil {
+		return 0, fmt.Errorf("failed to prune cache: %w", err)
+	}
+
+	return len(keys), nil
+}
+
+// Close closes the cache
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// chainPrefix returns the key prefix of all blocks of chainID
+func chainPrefix(chainID string) []byte {
+	return append(append(bytes.Clone(blockPrefix), chainID...), '/')
+}
+
+// blockKey returns the key of a block. Heights are big-endian so that keys
+// of one chain sort by height
+func blockKey(chainID string, height int64) []byte {
+	return binary.BigEndian.AppendUint64(chainPrefix(chainID), uint64(height))
+}
+
+// parseBlockKey splits a block key into chain ID and height
+func parseBlockKey(key []byte) (string, int64, bool) {
+	rest := bytes.TrimPrefix(key, blockPrefix)
+	if len(rest) < 10 || rest[len(rest)-9] != '/' {
+		return "", 0, false
+	}
+
+	chainID := string(rest[:len(rest)-9])
+	height := int64(binary.BigEndian.Uint64(rest[len(rest)-8:]))
+	return chainID, height, true
+}
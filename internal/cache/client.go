@@ -0,0 +1,260 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/qj0r9j0vc2/blocktime-calculator/internal/client"
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+// Stats holds cache hit and miss counters
+type Stats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+}
+
+// DefaultTipDepth is the number of heights below the tip that are not cached.
+// Commits are final, but a node rolled back after a halt may have served
+// blocks the chain replaced
+const DefaultTipDepth = 10
+
+// EVMTipDepth is the tip depth for EVM chains. Blocks near the tip of chains
+// without instant finality may still be reorganized, 64 blocks are the two
+// epochs after which Ethereum finalizes them
+const EVMTipDepth = 64
+
+// Options configures a CachedClient
+type Options struct {
+	TipDepth        int64 // Blocks within this many heights of the tip are not cached
+	RequireVerified bool  // Entries cached without light client verification are misses, so they are fetched and verified again
+	RequireCommits  bool  // Entries cached without their last commit are misses, so they are fetched again with it
+	RequireLoad     bool  // Entries cached without their load are misses, so they are fetched again with it
+}
+
+// CachedClient implements client.BlockchainClient with a persistent header
+// cache in front of another client. Blocks below the tip never change, so
+// every block deeper than TipDepth is served from the cache once it has been fetched
+type CachedClient struct {
+	inner   client.BlockchainClient
+	store   *Store
+	chainID string
+	opts    Options
+
+	verifyOnce sync.Once
+	verifyErr  error
+
+	// tip is the highest height known to exist, from node statuses and fetched blocks
+	tip atomic.Int64
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// NewCachedClient creates a client serving blocks of chainID from store before asking inner
+func NewCachedClient(inner client.BlockchainClient, store *Store, chainID string, opts Options) (*CachedClient, error) {
+	if chainID == "" {
+		return nil, fmt.Errorf("chain ID is required for caching")
+	}
+	if opts.TipDepth < 0 {
+		return nil, fmt.Errorf("tip depth must be non-negative")
+	}
+
+	return &CachedClient{
+		inner:   inner,
+		store:   store,
+		chainID: chainID,
+		opts:    opts,
+	}, nil
+}
+
+// GetLatestBlockHeight gets the latest block height from the node
+func (c *CachedClient) GetLatestBlockHeight(ctx context.Context) (int64, error) {
+	height, err := c.inner.GetLatestBlockHeight(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	c.observeTip(height)
+	return height, nil
+}
+
+// GetStatus gets the node status from the node
+func (c *CachedClient) GetStatus(ctx context.Context) (*types.NodeStatus, error) {
+	status, err := c.inner.GetStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.observeTip(status.LatestHeight)
+	return status, nil
+}
+
+// GetBlockByHeight gets block information by height
+func (c *CachedClient) GetBlockByHeight(ctx context.Context, height int64) (*types.BlockInfo, error) {
+	if err := c.verify(ctx); err != nil {
+		return nil, err
+	}
+
+	block, err := c.get(height)
+	if err != nil {
+		return nil, err
+	}
+	if block != nil {
+		c.hits.Add(1)
+		return block, nil
+	}
+
+	c.misses.Add(1)
+	block, err = c.inner.GetBlockByHeight(ctx, height)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.put([]*types.BlockInfo{block}); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// GetBlockRange gets a range of blocks, fetching only the heights missing from the cache
+func (c *CachedClient) GetBlockRange(ctx context.Context, startHeight, endHeight int64) ([]*types.BlockInfo, error) {
+	if startHeight > endHeight {
+		return nil, fmt.Errorf("invalid range: start height %d > end height %d", startHeight, endHeight)
+	}
+
+	if err := c.verify(ctx); err != nil {
+		return nil, err
+	}
+
+	blocks := make([]*types.BlockInfo, endHeight-startHeight+1)
+	for height := startHeight; height <= endHeight; height++ {
+		block, err := c.get(height)
+		if err != nil {
+			return nil, err
+		}
+		blocks[height-startHeight] = block
+	}
+
+	// Fetch every run of consecutive missing heights with one range call
+	for i := 0; i < len(blocks); {
+		if blocks[i] != nil {
+			c.hits.Add(1)
+			i++
+			continue
+		}
+
+		j := i
+		for j < len(blocks) && blocks[j] == nil {
+			j++
+		}
+		c.misses.Add(int64(j - i))
+
+		fetched, err := c.inner.GetBlockRange(ctx, startHeight+int64(i), startHeight+int64(j-1))
+		if err != nil {
+			return nil, err
+		}
+		if len(fetched) != j-i {
+			return nil, fmt.Errorf("expected %d blocks from %d, got %d", j-i, startHeight+int64(i), len(fetched))
+		}
+		if err := c.put(fetched); err != nil {
+			return nil, err
+		}
+
+		copy(blocks[i:j], fetched)
+		i = j
+	}
+
+	client.FillBlockTimes(blocks)
+	return blocks, nil
+}
+
+// CacheStats returns the cache hit and miss counters
+func (c *CachedClient) CacheStats() Stats {
+	return Stats{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+	}
+}
+
+// Unwrap returns the client behind the cache
+func (c *CachedClient) Unwrap() client.BlockchainClient {
+	return c.inner
+}
+
+// Close closes the cache and the client behind it
+func (c *CachedClient) Close() error {
+	storeErr := c.store.Close()
+	if err := c.inner.Close(); err != nil {
+		return err
+	}
+	return storeErr
+}
+
+// get returns the cached block at height, or nil if it is not cached, or
+// lacks the verification, commit or load the options require
+func (c *CachedClient) get(height int64) (*types.BlockInfo, error) {
+	block, err := c.store.Get(c.chainID, height)
+	if err != nil || block == nil {
+		return nil, err
+	}
+	if c.opts.RequireVerified && !block.Verified {
+		return nil, nil
+	}
+	if c.opts.RequireCommits && block.Commit == nil {
+		return nil, nil
+	}
+	if c.opts.RequireLoad && block.Load == nil {
+		return nil, nil
+	}
+	return block, nil
+}
+
+// put stores the fetched blocks that are deep enough below the tip. The
+// blocks themselves raise the known tip, so no extra request is needed
+func (c *CachedClient) put(blocks []*types.BlockInfo) error {
+	for _, block := range blocks {
+		c.observeTip(block.Height)
+	}
+
+	maxHeight := c.tip.Load() - c.opts.TipDepth
+	final := blocks
+	for len(final) > 0 && final[len(final)-1].Height > maxHeight {
+		final = final[:len(final)-1]
+	}
+	if len(final) == 0 {
+		return nil
+	}
+
+	return c.store.Put(c.chainID, final)
+}
+
+// observeTip raises the known tip to height
+func (c *CachedClient) observeTip(height int64) {
+	for {
+		tip := c.tip.Load()
+		if height <= tip || c.tip.CompareAndSwap(tip, height) {
+			return
+		}
+	}
+}
+
+// verify checks once that the node serves the configured chain the cache
+// entries are stored under, so blocks of different chains never mix
+func (c *CachedClient) verify(ctx context.Context) error {
+	c.verifyOnce.Do(func() {
+		status, err := c.inner.GetStatus(ctx)
+		if err != nil {
+			c.verifyErr = fmt.Errorf("failed to verify chain ID for cache: %w", err)
+			return
+		}
+		c.observeTip(status.LatestHeight)
+
+		if status.ChainID != c.chainID {
+			c.verifyErr = fmt.Errorf("node serves chain %s but chain ID %s is configured; refusing to use the block cache", status.ChainID, c.chainID)
+		}
+	})
+	return c.verifyErr
+}
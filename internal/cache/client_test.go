@@ -0,0 +1,335 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/simulate"
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+const testChainID = "test-1"
+
+// newTestNode serves a chain of blocks 5 seconds apart up to latest. Its
+// blocks come without their last commit, unless Edit is replaced
+func newTestNode(t *testing.T, chainID string, latest int64) *simulate.Node {
+	t.Helper()
+
+	chain, err := simulate.New(simulate.Spec{
+		ChainID:      chainID,
+		LatestHeight: latest,
+		BlockTime:    simulate.Distribution{Distribution: simulate.DistributionConstant, Mean: 5 * time.Second},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &simulate.Node{Chain: chain, Edit: func(block *types.BlockInfo) { block.Commit = nil }}
+}
+
+// withCommit gives block a last commit
+func withCommit(block *types.BlockInfo) {
+	block.Commit = &types.CommitInfo{Round: int32(block.Height % 2), Signatures: 3, SignedPower: 1}
+}
+
+// withLoad gives block a load and no last commit
+func withLoad(block *types.BlockInfo) {
+	block.Commit = nil
+	block.Load = &types.LoadInfo{GasUsed: block.Height * 1000, GasWanted: block.Height * 1200, Events: int(block.Height % 7), Size: 512}
+}
+
+func openTestStore(t *testing.T) *Store {
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestCachedClientGetBlockRange(t *testing.T) {
+	inner := newTestNode(t, testChainID, 1000)
+	c, err := NewCachedClient(inner, openTestStore(t), testChainID, Options{TipDepth: DefaultTipDepth})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	if _, err := c.GetBlockRange(ctx, 100, 199); err != nil {
+		t.Fatal(err)
+	}
+	if got := inner.TakeRanges(); len(got) != 1 || got[0] != [2]int64{100, 199} {
+		t.Fatalf("got fetches %v, want 100-199", got)
+	}
+
+	// Only the missing runs around the cached heights are fetched
+	blocks, err := c.GetBlockRange(ctx, 50, 250)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetched := [][2]int64{{50, 99}, {200, 250}}
+	if got := inner.TakeRanges(); fmt.Sprint(got) != fmt.Sprint(fetched) {
+		t.Errorf("got fetches %v, want %v", got, fetched)
+	}
+
+	want, err := inner.Chain.GetBlockRange(ctx, 50, 250)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, block := range blocks {
+		if block.Height != 50+int64(i) || block.Hash != want[i].Hash {
+			t.Fatalf("block %d: got height %d with hash %s", i, block.Height, block.Hash)
+		}
+		// Block times span cached and fetched blocks alike
+		if i > 0 && block.BlockTime != 5 {
+			t.Errorf("block %d has block time %v, want 5", block.Height, block.BlockTime)
+		}
+	}
+
+	if stats := c.CacheStats(); stats.Hits != 100 || stats.Misses != 201 {
+		t.Errorf("got %+v, want 100 hits and 201 misses", stats)
+	}
+}
+
+func TestCachedClientTipDepth(t *testing.T) {
+	tests := []struct {
+		name      string
+		tipDepth  int64
+		latest    int64
+		start     int64
+		end       int64
+		wantCache int64 // highest cached height, 0 for none
+	}{
+		{"deep range", 10, 1000, 100, 200, 200},
+		{"range up to the tip", 10, 1000, 950, 1000, 990},
+		{"range within the tip depth", 10, 1000, 995, 1000, 0},
+		{"no tip depth", 0, 1000, 950, 1000, 1000},
+		{"large tip depth", 64, 1000, 900, 1000, 936},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := openTestStore(t)
+			inner := newTestNode(t, testChainID, tt.latest)
+			c, err := NewCachedClient(inner, store, testChainID, Options{TipDepth: tt.tipDepth})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			if _, err := c.GetBlockRange(context.Background(), tt.start, tt.end); err != nil {
+				t.Fatal(err)
+			}
+
+			infos, err := store.Info()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var maxHeight int64
+			if len(infos) > 0 {
+				maxHeight = infos[0].MaxHeight
+			}
+			if maxHeight != tt.wantCache {
+				t.Errorf("cached up to height %d, want %d", maxHeight, tt.wantCache)
+			}
+		})
+	}
+}
+
+func TestCachedClientTipFromBlocks(t *testing.T) {
+	// The status is only asked once, later blocks raise the tip on their own
+	inner := newTestNode(t, testChainID, 200)
+	inner.Latest = 100
+	c, err := NewCachedClient(inner, openTestStore(t), testChainID, Options{TipDepth: DefaultTipDepth})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	if _, err := c.GetBlockByHeight(ctx, 95); err != nil {
+		t.Fatal(err)
+	}
+	inner.Latest = 200
+	if _, err := c.GetBlockByHeight(ctx, 200); err != nil {
+		t.Fatal(err)
+	}
+	inner.TakeRanges()
+
+	// Height 95 was within the tip depth when fetched, but is final now
+	if _, err := c.GetBlockByHeight(ctx, 95); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetBlockByHeight(ctx, 95); err != nil {
+		t.Fatal(err)
+	}
+	if got := inner.TakeRanges(); len(got) != 1 {
+		t.Errorf("got fetches %v, want height 95 fetched once more and then cached", got)
+	}
+}
+
+func TestCachedClientRequireVerified(t *testing.T) {
+	store := openTestStore(t)
+	ctx := context.Background()
+
+	// Blocks cached without verification
+	unverified := newTestNode(t, testChainID, 1000)
+	c, err := NewCachedClient(unverified, store, testChainID, Options{TipDepth: DefaultTipDepth})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetBlockRange(ctx, 100, 199); err != nil {
+		t.Fatal(err)
+	}
+
+	// With verification required they are misses and fetched again
+	inner := newTestNode(t, testChainID, 1000)
+	inner.Edit = func(block *types.BlockInfo) { block.Commit, block.Verified = nil, true }
+	verifying, err := NewCachedClient(inner, store, testChainID, Options{TipDepth: DefaultTipDepth, RequireVerified: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		blocks, err := verifying.GetBlockRange(ctx, 100, 199)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, block := range blocks {
+			if !block.Verified {
+				t.Fatalf("pass %d: block %d is not verified", i, block.Height)
+			}
+		}
+
+		block, err := verifying.GetBlockByHeight(ctx, 150)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !block.Verified {
+			t.Fatalf("pass %d: block 150 is not verified", i)
+		}
+	}
+
+	// The verified entries replaced the unverified ones
+	if got := inner.TakeRanges(); len(got) != 1 || got[0] != [2]int64{100, 199} {
+		t.Errorf("got fetches %v, want 100-199 once", got)
+	}
+	if stats := verifying.CacheStats(); stats.Hits != 102 || stats.Misses != 100 {
+		t.Errorf("got %+v, want 102 hits and 100 misses", stats)
+	}
+}
+
+func TestCachedClientRequireCommits(t *testing.T) {
+	store := openTestStore(t)
+	ctx := context.Background()
+
+	// Blocks cached without commits
+	c, err := NewCachedClient(newTestNode(t, testChainID, 1000), store, testChainID, Options{TipDepth: DefaultTipDepth})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetBlockRange(ctx, 100, 199); err != nil {
+		t.Fatal(err)
+	}
+
+	// With commits required they are misses, the refetched ones are cached with their commits
+	inner := newTestNode(t, testChainID, 1000)
+	inner.Edit = withCommit
+	committed, err := NewCachedClient(inner, store, testChainID, Options{TipDepth: DefaultTipDepth, RequireCommits: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		blocks, err := committed.GetBlockRange(ctx, 100, 199)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, block := range blocks {
+			if block.Commit == nil || block.Commit.Round != int32(block.Height%2) || block.Commit.Signatures != 3 {
+				t.Fatalf("pass %d: got commit %+v in block %d", i, block.Commit, block.Height)
+			}
+		}
+	}
+	if got := inner.TakeRanges(); len(got) != 1 || got[0] != [2]int64{100, 199} {
+		t.Errorf("got fetches %v, want 100-199 once", got)
+	}
+}
+
+func TestCachedClientRequireLoad(t *testing.T) {
+	store := openTestStore(t)
+	ctx := context.Background()
+
+	// Blocks cached with commits but without their load
+	committed := newTestNode(t, testChainID, 1000)
+	committed.Edit = withCommit
+	c, err := NewCachedClient(committed, store, testChainID, Options{TipDepth: DefaultTipDepth})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetBlockRange(ctx, 100, 149); err != nil {
+		t.Fatal(err)
+	}
+
+	// With load required they are misses, the refetched ones are cached with their load
+	inner := newTestNode(t, testChainID, 1000)
+	inner.Edit = withLoad
+	loaded, err := NewCachedClient(inner, store, testChainID, Options{TipDepth: DefaultTipDepth, RequireLoad: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		blocks, err := loaded.GetBlockRange(ctx, 100, 149)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, block := range blocks {
+			if block.Load == nil || block.Load.GasUsed != block.Height*1000 || block.Load.Events != int(block.Height%7) {
+				t.Fatalf("pass %d: got load %+v in block %d", i, block.Load, block.Height)
+			}
+		}
+	}
+	if got := inner.TakeRanges(); len(got) != 1 || got[0] != [2]int64{100, 149} {
+		t.Errorf("got fetches %v, want 100-149 once", got)
+	}
+}
+
+func TestCachedClientChainMismatch(t *testing.T) {
+	store := openTestStore(t)
+	inner := newTestNode(t, "other-1", 1000)
+	c, err := NewCachedClient(inner, store, testChainID, Options{TipDepth: DefaultTipDepth})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	_, err = c.GetBlockRange(context.Background(), 1, 10)
+	if err == nil || !strings.Contains(err.Error(), "node serves chain other-1 but chain ID test-1 is configured") {
+		t.Fatalf("got error %v", err)
+	}
+	if _, err := c.GetBlockByHeight(context.Background(), 5); err == nil {
+		t.Fatal("expected the mismatch to persist")
+	}
+
+	infos, err := store.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 0 {
+		t.Errorf("blocks were cached despite the mismatch: %+v", infos)
+	}
+	if got := inner.TakeRanges(); len(got) != 0 {
+		t.Errorf("blocks were fetched despite the mismatch: %v", got)
+	}
+}
+
+func TestNewCachedClientOptions(t *testing.T) {
+	inner := newTestNode(t, testChainID, 100)
+	if _, err := NewCachedClient(inner, nil, "", Options{}); err == nil {
+		t.Error("expected an error without chain ID")
+	}
+	if _, err := NewCachedClient(inner, nil, testChainID, Options{TipDepth: -1}); err == nil {
+		t.Error("expected an error for a negative tip depth")
+	}
+}
@@ -60,48 +60,109 @@ func DefaultConfig() *types.CalculatorConfig {
 	}
 }
 
-// CalculateStats calculates block time statistics for the latest blocks
+// CalculateStats calculates block time statistics for the latest blocks.
+// On a pruned node the sample is clamped to the blocks the node still has
 func (c *BlockTimeCalculator) CalculateStats(ctx context.Context) (*types.BlockTimeStats, error) {
-	// Get latest block height
-	latestHeight, err := c.client.GetLatestBlockHeight(ctx)
+	// Get the available height window
+	status, err := c.client.GetStatus(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get latest height: %w", err)
 	}
+	latestHeight := status.LatestHeight
 
 	// Calculate start height
 	startHeight := latestHeight - int64(c.config.SampleSize) + 1
 	if startHeight < 1 {
 		startHeight = 1
 	}
+	if startHeight < status.EarliestHeight {
+		startHeight = status.EarliestHeight
 
-	return c.CalculateStatsForRange(ctx, startHeight, latestHeight)
+		sampleSize := int(latestHeight - startHeight + 1)
+		if sampleSize < c.config.MinSampleSize {
+			return nil, fmt.Errorf("node only keeps blocks from height %d: %d blocks < minimum sample size %d", startHeight, sampleSize, c.config.MinSampleSize)
+		}
+	}
+
+	return c.calculateStatsForRange(ctx, startHeight, latestHeight)
 }
 
-// CalculateStatsForRange calculates block time statistics for a specific range
+// CalculateStatsForRange calculates block time statistics for a specific range.
+// It fails early when the range is outside the heights the node has
 func (c *BlockTimeCalculator) CalculateStatsForRange(ctx context.Context, startHeight, endHeight int64) (*types.BlockTimeStats, error) {
 	// Validate range
 	if startHeight > endHeight {
 		return nil, fmt.Errorf("invalid range: start %d > end %d", startHeight, endHeight)
 	}
 
+	status, err := c.client.GetStatus(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get node status: %w", err)
+	}
+	if startHeight < status.EarliestHeight {
+		return nil, fmt.Errorf("start height %d is pruned: the node only keeps blocks from height %d (use a later start height or an archive node)", startHeight, status.EarliestHeight)
+	}
+	if endHeight > status.LatestHeight {
+		return nil, fmt.Errorf("end height %d is above the latest height %d", endHeight, status.LatestHeight)
+	}
+
+	return c.calculateStatsForRange(ctx, startHeight, endHeight)
+}
+
+// calculateStatsForRange calculates statistics for a range known to be available
+func (c *BlockTimeCalculator) calculateStatsForRange(ctx context.Context, startHeight, endHeight int64) (*types.BlockTimeStats, error) {
 	sampleSize := int(endHeight - startHeight + 1)
 	if sampleSize < c.config.MinSampleSize {
 		return nil, fmt.Errorf("insufficient sample size: %d < minimum %d", sampleSize, c.config.MinSampleSize)
 	}
 
-	// Fetch blocks
-	blocks, err := c.client.GetBlockRange(ctx, startHeight, endHeight)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get block range: %w", err)
+	// Count missing heights when gaps are allowed, otherwise the first one fails the range
+	opts := client.StreamOptions{VerifyLinkage: c.config.VerifyLinkage}
+	var missingBlocks, gapCount int
+	var lastMissing int64
+	if c.config.AllowGaps {
+		opts.OnMissing = func(missing types.MissingBlock) {
+			missingBlocks++
+			if missingBlocks == 1 || missing.Height != lastMissing+1 {
+				gapCount++
+			}
+			lastMissing = missing.Height
+		}
 	}
 
-	// Calculate block times
-	blockTimes := make([]float64, 0, len(blocks)-1)
-	for i := 1; i < len(blocks); i++ {
-		timeDiff := blocks[i].Time.Sub(blocks[i-1].Time).Seconds()
-		if timeDiff > 0 { // Filter out negative or zero times
-			blockTimes = append(blockTimes, timeDiff)
+	// Stream blocks and keep only their block times, so memory stays small for large ranges
+	blockChan, errChan := client.StreamBlockRange(ctx, c.client, startHeight, endHeight, opts)
+
+	blockTimes := make([]float64, 0, sampleSize-1)
+	rounds := make([]int32, 0, sampleSize-1)     // commit round before each block time, -1 if unknown
+	loads := make([]*blockLoad, 0, sampleSize-1) // load of the block before each block time, nil if unknown
+	var firstBlock, lastBlock *types.BlockInfo
+	var unverifiedBlocks int
+	for block := range blockChan {
+		if !block.Verified {
+			unverifiedBlocks++
+		}
+
+		if firstBlock == nil {
+			firstBlock = block
+		} else if block.Height == lastBlock.Height+1 {
+			// Only consecutive heights give a block time, a gap is not one long block
+			// Zero is a valid block time on chains with whole-second timestamps
+			timeDiff := block.Time.Sub(lastBlock.Time).Seconds()
+			if timeDiff >= 0 { // Filter out negative times
+				blockTimes = append(blockTimes, timeDiff)
+				rounds = append(rounds, commitRound(block))
+				loads = append(loads, loadOf(lastBlock))
+			}
 		}
+		lastBlock = block
+	}
+
+	if err := <-errChan; err != nil {
+		return nil, fmt.Errorf("failed to get block range: %w", err)
+	}
+	if firstBlock == nil {
+		return nil, fmt.Errorf("none of the blocks %d-%d could be fetched", startHeight, endHeight)
 	}
 
 	if len(blockTimes) < c.config.MinSampleSize {
@@ -118,14 +179,23 @@ func (c *BlockTimeCalculator) CalculateStatsForRange(ctx context.Context, startH
 	stats.SampleSize = len(blockTimes)
 	stats.StartHeight = startHeight
 	stats.EndHeight = endHeight
-	stats.StartTime = blocks[0].Time
-	stats.EndTime = blocks[len(blocks)-1].Time
+	stats.StartTime = firstBlock.Time
+	stats.EndTime = lastBlock.Time
 	stats.OutlierCount = outlierCount
+	stats.GapCount = gapCount
+	stats.MissingBlocks = missingBlocks
+	stats.Verified = unverifiedBlocks == 0
+	stats.UnverifiedBlocks = unverifiedBlocks
+	stats.Resolution = timestampResolution(blockTimes)
 	stats.ConfidenceLevel = c.config.ConfidenceLevel
 
 	// Calculate estimated range
 	stats.EstimatedRange = c.calculateRange(cleanedTimes, stats)
 
+	// Outliers are kept, as the slowest blocks are the ones extra rounds or load explain
+	stats.Rounds = roundStats(blockTimes, rounds)
+	stats.Load = loadStats(blockTimes, loads)
+
 	return stats, nil
 }
 
@@ -192,7 +262,11 @@ func (c *BlockTimeCalculator) removeOutliers(times []float64) ([]float64, int) {
 func (c *BlockTimeCalculator) removeOutliersIQR(sorted []float64) ([]float64, int) {
 	q1 := percentile(sorted, 0.25)
 	q3 := percentile(sorted, 0.75)
-	iqr := q3 - q1
+
+	// With whole-second timestamps most block times are equal and the IQR
+	// collapses to 0, which would flag every other value; it can't be finer
+	// than the timestamp resolution
+	iqr := math.Max(q3-q1, timestampResolution(sorted))
 
 	lowerBound := q1 - c.config.OutlierThreshold*iqr
 	upperBound := q3 + c.config.OutlierThreshold*iqr
@@ -266,6 +340,15 @@ func (c *BlockTimeCalculator) calculateRange(times []float64, stats *types.Block
 	// Typical value is the median for robustness
 	typical := stats.Median
 
+	// Block times quantized to the timestamp resolution make the median jump
+	// between steps (0 or 1 for a 0.5s chain), while the mean stays exact, as
+	// the times add up to the elapsed time. The range covers the rounding
+	if resolution := timestampResolution(times); resolution > 0 && iqr <= resolution {
+		typical = stats.Mean
+		lower = math.Min(lower, typical-resolution/2)
+		upper = math.Max(upper, typical+resolution/2)
+	}
+
 	// Adjust based on confidence level
 	if c.config.ConfidenceLevel < 0.95 {
 		// Narrow the range for lower confidence
@@ -283,6 +366,21 @@ func (c *BlockTimeCalculator) calculateRange(times []float64, stats *types.Block
 	}
 }
 
+// timestampResolution returns 1 when all block times are whole seconds, as
+// with EVM chains, and 0 when the timestamps are finer
+func timestampResolution(times []float64) float64 {
+	if len(times) == 0 {
+		return 0
+	}
+
+	for _, v := range times {
+		if v != math.Trunc(v) {
+			return 0
+		}
+	}
+	return 1
+}
+
 // percentile calculates the percentile value
 func percentile(sorted []float64, p float64) float64 {
 	if len(sorted) == 0 {
@@ -313,9 +411,9 @@ func percentile(sorted []float64, p float64) float64 {
 func (c *BlockTimeCalculator) AnalyzeProposerPatterns(ctx context.Context, blocks []*types.BlockInfo) map[string]*types.BlockTimeStats {
 	proposerBlocks := make(map[string][]float64)
 
-	// Group block times by proposer
+	// Group block times by proposer, only consecutive heights give a block time
 	for i := 1; i < len(blocks); i++ {
-		if blocks[i].BlockTime > 0 {
+		if blocks[i].Height == blocks[i-1].Height+1 && blocks[i].BlockTime >= 0 {
 			proposer := blocks[i].Proposer
 			proposerBlocks[proposer] = append(proposerBlocks[proposer], blocks[i].BlockTime)
 		}
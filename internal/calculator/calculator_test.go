@@ -0,0 +1,355 @@
+package calculator
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/simulate"
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+var genesisTime = time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+// newTestNode serves a chain of blocks 6 seconds apart, keeping the heights
+// earliest..latest
+func newTestNode(t *testing.T, earliest, latest int64) *simulate.Node {
+	t.Helper()
+
+	chain, err := simulate.New(simulate.Spec{
+		ChainID:      "test-1",
+		GenesisTime:  genesisTime,
+		LatestHeight: latest,
+		BlockTime:    simulate.Distribution{Distribution: simulate.DistributionConstant, Mean: 6 * time.Second},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &simulate.Node{Chain: chain, Earliest: earliest}
+}
+
+func newTestCalculator(t *testing.T, c *simulate.Node, config *types.CalculatorConfig) *BlockTimeCalculator {
+	calc, err := NewBlockTimeCalculator(c, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return calc
+}
+
+func TestCalculateStatsClampsToEarliestHeight(t *testing.T) {
+	tests := []struct {
+		name      string
+		earliest  int64
+		wantStart int64
+		wantErr   string
+	}{
+		{"archive node", 1, 901, ""},
+		{"pruned below the sample", 800, 901, ""},
+		{"pruned within the sample", 950, 950, ""},
+		{"too few blocks left", 990, 0, "node only keeps blocks from height 990: 11 blocks < minimum sample size 30"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestNode(t, tt.earliest, 1000)
+			calc := newTestCalculator(t, c, &types.CalculatorConfig{SampleSize: 100, MinSampleSize: 30})
+
+			stats, err := calc.CalculateStats(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				if calls := c.Ranges(); len(calls) != 0 {
+					t.Errorf("blocks were fetched before failing: %v", calls)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if stats.StartHeight != tt.wantStart || stats.EndHeight != 1000 {
+				t.Errorf("got range %d-%d, want %d-1000", stats.StartHeight, stats.EndHeight, tt.wantStart)
+			}
+			if stats.SampleSize != int(1000-tt.wantStart) || stats.Median != 6 {
+				t.Errorf("got %d block times with median %v", stats.SampleSize, stats.Median)
+			}
+			for _, r := range c.Ranges() {
+				if r[0] < tt.earliest {
+					t.Errorf("pruned heights %d-%d were requested", r[0], r[1])
+				}
+			}
+		})
+	}
+}
+
+func TestCalculateStatsForRangeAvailability(t *testing.T) {
+	tests := []struct {
+		name    string
+		start   int64
+		end     int64
+		wantErr string
+	}{
+		{"available", 600, 700, ""},
+		{"from the earliest height", 500, 600, ""},
+		{"pruned start", 499, 600, "start height 499 is pruned: the node only keeps blocks from height 500"},
+		{"end above the tip", 900, 1001, "end height 1001 is above the latest height 1000"},
+		{"inverted", 700, 600, "invalid range: start 700 > end 600"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestNode(t, 500, 1000)
+			calc := newTestCalculator(t, c, &types.CalculatorConfig{MinSampleSize: 30})
+
+			stats, err := calc.CalculateStatsForRange(context.Background(), tt.start, tt.end)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				if calls := c.Ranges(); len(calls) != 0 {
+					t.Errorf("blocks were fetched before failing: %v", calls)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.StartHeight != tt.start || stats.EndHeight != tt.end || stats.SampleSize != int(tt.end-tt.start) {
+				t.Errorf("got %d block times for %d-%d", stats.SampleSize, stats.StartHeight, stats.EndHeight)
+			}
+		})
+	}
+}
+
+func TestPredictBlockTimePruned(t *testing.T) {
+	c := newTestNode(t, 500, 1000)
+	calc := newTestCalculator(t, c, nil)
+	predictor := NewBlockPredictor(c, calc)
+	ctx := context.Background()
+
+	_, err := predictor.PredictBlockTime(ctx, 100)
+	if err == nil || !strings.Contains(err.Error(), "block 100 is pruned: the node only keeps blocks from height 500") {
+		t.Fatalf("got error %v, want the pruned block reported", err)
+	}
+
+	prediction, err := predictor.PredictBlockTime(ctx, 700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := c.GetBlockByHeight(ctx, 700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !prediction.IsComplete || !prediction.ActualTime.Equal(block.Time) {
+		t.Errorf("got prediction %+v, want the actual time of block 700", prediction)
+	}
+}
+
+func TestCalculateStatsForRangeGaps(t *testing.T) {
+	c := newTestNode(t, 1, 1000)
+	c.Missing = map[int64]bool{37: true, 38: true, 500: true}
+	// The 18 seconds from height 36 to 39 would show up as an outlier
+	// or in the maximum if the gap was taken for one long block
+	calc := newTestCalculator(t, c, &types.CalculatorConfig{MinSampleSize: 30, AllowGaps: true})
+
+	stats, err := calc.CalculateStatsForRange(context.Background(), 1, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.GapCount != 2 || stats.MissingBlocks != 3 {
+		t.Errorf("got %d gaps with %d missing blocks, want 2 with 3", stats.GapCount, stats.MissingBlocks)
+	}
+	// 999 pairs of heights, less the 5 touching a missing height
+	if stats.SampleSize != 994 {
+		t.Errorf("got %d block times, want 994", stats.SampleSize)
+	}
+	if stats.Max != 6 || stats.OutlierCount != 0 {
+		t.Errorf("got max %v with %d outliers, want only 6 second blocks", stats.Max, stats.OutlierCount)
+	}
+
+	// Without AllowGaps the first missing height fails the range
+	calc = newTestCalculator(t, c, &types.CalculatorConfig{MinSampleSize: 30})
+	if _, err := calc.CalculateStatsForRange(context.Background(), 1, 1000); err == nil || !strings.Contains(err.Error(), "block 37 is missing") {
+		t.Errorf("got error %v, want the missing height", err)
+	}
+}
+
+func TestCalculateStatsZeroBlockTimes(t *testing.T) {
+	// Whole-second timestamps, 1 second apart, but every 100th block shares
+	// the timestamp of its parent
+	c := newTestNode(t, 1, 1000)
+	c.Edit = func(block *types.BlockInfo) {
+		block.Time = genesisTime.Add(time.Duration(block.Height-block.Height/100) * time.Second)
+	}
+	calc := newTestCalculator(t, c, &types.CalculatorConfig{MinSampleSize: 30})
+
+	stats, err := calc.CalculateStatsForRange(context.Background(), 1, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Zero block times are samples, not dropped or taken for outliers
+	if stats.SampleSize != 999 || stats.OutlierCount != 0 {
+		t.Errorf("got %d block times with %d outliers, want 999 with none", stats.SampleSize, stats.OutlierCount)
+	}
+	if stats.Min != 0 || stats.Median != 1 || stats.Resolution != 1 {
+		t.Errorf("got min %v, median %v, resolution %v, want 0, 1 and 1", stats.Min, stats.Median, stats.Resolution)
+	}
+	if want := 989.0 / 999; math.Abs(stats.Mean-want) > 1e-9 {
+		t.Errorf("got mean %v, want %v", stats.Mean, want)
+	}
+}
+
+func TestCalculateStatsQuantizedBlockTimes(t *testing.T) {
+	// Blocks every 0.5 seconds with whole-second timestamps, so block times
+	// alternate between 0 and 1
+	c := newTestNode(t, 1, 1000)
+	c.Edit = func(block *types.BlockInfo) {
+		block.Time = genesisTime.Add(time.Duration(block.Height/2) * time.Second)
+	}
+	calc := newTestCalculator(t, c, &types.CalculatorConfig{MinSampleSize: 30})
+
+	stats, err := calc.CalculateStatsForRange(context.Background(), 1, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.SampleSize != 999 || stats.OutlierCount != 0 || stats.Resolution != 1 {
+		t.Errorf("got %d block times with %d outliers at resolution %v", stats.SampleSize, stats.OutlierCount, stats.Resolution)
+	}
+	// The median lands on one of the steps, the typical block time is the
+	// exact mean of 500 seconds over 999 blocks
+	if stats.Median != 1 {
+		t.Errorf("got median %v, want 1", stats.Median)
+	}
+	mean := 500.0 / 999
+	r := stats.EstimatedRange
+	if math.Abs(r.Typical-mean) > 1e-9 {
+		t.Errorf("got typical block time %v, want %v", r.Typical, mean)
+	}
+	if r.Lower != 0 || math.Abs(r.Upper-(mean+0.5)) > 1e-9 {
+		t.Errorf("got range %v-%v, want 0-%v", r.Lower, r.Upper, mean+0.5)
+	}
+}
+
+func TestCalculateStatsRounds(t *testing.T) {
+	// Every 10th block follows a commit in round 1 and takes 12 seconds,
+	// every 50th one in round 2 and takes 18. Four blocks in round 0 are
+	// slow for another reason
+	rounds := make(map[int64]int32)
+	times := []time.Time{genesisTime, genesisTime}
+	for height := int64(2); height <= 201; height++ {
+		blockTime := 6 * time.Second
+		switch {
+		case height%50 == 0:
+			rounds[height], blockTime = 2, 18*time.Second
+		case height%10 == 0:
+			rounds[height], blockTime = 1, 12*time.Second
+		case height%50 == 25:
+			blockTime = 20 * time.Second
+		}
+		times = append(times, times[height-1].Add(blockTime))
+	}
+
+	c := newTestNode(t, 1, 201)
+	c.Edit = func(block *types.BlockInfo) {
+		block.Time = times[block.Height]
+		block.Commit = nil
+	}
+	calc := newTestCalculator(t, c, &types.CalculatorConfig{MinSampleSize: 30})
+
+	stats, err := calc.CalculateStatsForRange(context.Background(), 1, 201)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Rounds != nil {
+		t.Errorf("got round stats %+v without commits", stats.Rounds)
+	}
+
+	c.Edit = func(block *types.BlockInfo) {
+		block.Time = times[block.Height]
+		block.Commit.Round = rounds[block.Height]
+	}
+	stats, err = calc.CalculateStatsForRange(context.Background(), 1, 201)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := stats.Rounds
+	if r == nil {
+		t.Fatal("got no round stats")
+	}
+	first := types.RoundGroup{Blocks: 180, Share: 0.9, Mean: (176*6 + 4*20) / 180.0, Median: 6, P95: 6}
+	later := types.RoundGroup{Blocks: 20, Share: 0.1, Mean: 13.2, Median: 12, P95: 18}
+	for _, group := range []struct {
+		name      string
+		got, want types.RoundGroup
+	}{{"first round", r.FirstRound, first}, {"later rounds", r.LaterRounds, later}} {
+		got, want := group.got, group.want
+		if got.Blocks != want.Blocks || math.Abs(got.Share-want.Share) > 1e-9 || math.Abs(got.Mean-want.Mean) > 1e-9 ||
+			got.Median != want.Median || math.Abs(got.P95-want.P95) > 1e-9 {
+			t.Errorf("got %s %+v, want %+v", group.name, got, want)
+		}
+	}
+
+	// Above the P95 of 12 seconds are the 4 blocks in round 2 and the 4 slow ones in round 0
+	if r.TailBlocks != 8 || r.TailLaterRounds != 0.5 {
+		t.Errorf("got %d tail blocks, %v of them after later rounds, want 8 and 0.5", r.TailBlocks, r.TailLaterRounds)
+	}
+}
+
+func TestCalculateStatsLoad(t *testing.T) {
+	// The block after block h comes 5 seconds plus a second per million gas
+	// h used later. Every block has the same size, and the load of every
+	// 10th block is unknown
+	times := []time.Time{genesisTime, genesisTime}
+	for height := int64(2); height <= 201; height++ {
+		times = append(times, times[height-1].Add(time.Duration(5+(height-1)%7)*time.Second))
+	}
+
+	c := newTestNode(t, 1, 201)
+	c.Edit = func(block *types.BlockInfo) { block.Time = times[block.Height] }
+	calc := newTestCalculator(t, c, &types.CalculatorConfig{MinSampleSize: 30})
+
+	stats, err := calc.CalculateStatsForRange(context.Background(), 1, 201)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Load != nil {
+		t.Errorf("got load stats %+v without loads", stats.Load)
+	}
+
+	c.Edit = func(block *types.BlockInfo) {
+		block.Time = times[block.Height]
+		if height := block.Height; height%10 != 0 {
+			block.Load = &types.LoadInfo{GasUsed: height % 7 * 1000000, GasWanted: 2000000, Events: int(height % 3), Size: 1024}
+		}
+	}
+	stats, err = calc.CalculateStatsForRange(context.Background(), 1, 201)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := stats.Load
+	if l == nil {
+		t.Fatal("got no load stats")
+	}
+	if l.Blocks != 180 {
+		t.Errorf("got %d blocks with a load, want 180", l.Blocks)
+	}
+	if math.Abs(l.GasUsed.Correlation-1) > 1e-9 || math.Abs(l.GasUsed.Slope-1e-6) > 1e-12 || math.Abs(l.GasUsed.Intercept-5) > 1e-6 {
+		t.Errorf("got gas used fit %+v, want a correlation of 1 and 5s plus 1s per million gas", l.GasUsed)
+	}
+	for name, constant := range map[string]types.LoadCorrelation{"gas wanted": l.GasWanted, "txs": l.Txs, "size": l.Size} {
+		if constant.Correlation != 0 || constant.Slope != 0 || constant.Intercept < 5 || constant.Intercept > 11 {
+			t.Errorf("got %s fit %+v for a constant metric", name, constant)
+		}
+	}
+	if math.Abs(l.Events.Correlation) >= 1 {
+		t.Errorf("got events correlation %v for an unrelated metric", l.Events.Correlation)
+	}
+}
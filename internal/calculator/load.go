@@ -0,0 +1,82 @@
+package calculator
+
+import (
+	"math"
+
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+// blockLoad is the load of the block a block time was spent agreeing on
+type blockLoad struct {
+	types.LoadInfo
+	txs int
+}
+
+// loadOf returns the load of block, nil when it was not fetched
+func loadOf(block *types.BlockInfo) *blockLoad {
+	if block.Load == nil {
+		return nil
+	}
+	return &blockLoad{LoadInfo: *block.Load, txs: block.TxCount}
+}
+
+// loadStats fits block times to each load metric, where loads holds nil for
+// unknown ones. It returns nil without known loads
+func loadStats(times []float64, loads []*blockLoad) *types.LoadStats {
+	var known, gasUsed, gasWanted, txs, events, size []float64
+	for i, load := range loads {
+		if load == nil {
+			continue
+		}
+		known = append(known, times[i])
+		gasUsed = append(gasUsed, float64(load.GasUsed))
+		gasWanted = append(gasWanted, float64(load.GasWanted))
+		txs = append(txs, float64(load.txs))
+		events = append(events, float64(load.Events))
+		size = append(size, float64(load.Size))
+	}
+	if len(known) == 0 {
+		return nil
+	}
+
+	return &types.LoadStats{
+		Blocks:    len(known),
+		GasUsed:   fit(gasUsed, known),
+		GasWanted: fit(gasWanted, known),
+		Txs:       fit(txs, known),
+		Events:    fit(events, known),
+		Size:      fit(size, known),
+	}
+}
+
+// fit fits ys to xs by least squares. A constant metric explains nothing,
+// so its slope is 0 and the intercept is the mean block time
+func fit(xs, ys []float64) types.LoadCorrelation {
+	n := float64(len(xs))
+	var meanX, meanY float64
+	for i := range xs {
+		meanX += xs[i]
+		meanY += ys[i]
+	}
+	meanX /= n
+	meanY /= n
+
+	var sxx, syy, sxy float64
+	for i := range xs {
+		dx, dy := xs[i]-meanX, ys[i]-meanY
+		sxx += dx * dx
+		syy += dy * dy
+		sxy += dx * dy
+	}
+
+	result := types.LoadCorrelation{Intercept: meanY}
+	if sxx == 0 {
+		return result
+	}
+	result.Slope = sxy / sxx
+	result.Intercept = meanY - result.Slope*meanX
+	if syy > 0 {
+		result.Correlation = sxy / math.Sqrt(sxx*syy)
+	}
+	return result
+}
@@ -25,14 +25,19 @@ func NewBlockPredictor(client client.BlockchainClient, calculator *BlockTimeCalc
 
 // PredictBlockTime predicts when a target block will be created
 func (p *BlockPredictor) PredictBlockTime(ctx context.Context, targetHeight int64) (*BlockPrediction, error) {
-	// Get current block height
-	currentHeight, err := p.client.GetLatestBlockHeight(ctx)
+	// Get current block height and the earliest height still available
+	status, err := p.client.GetStatus(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get current height: %w", err)
 	}
+	currentHeight := status.LatestHeight
 
 	// If target is in the past or current
 	if targetHeight <= currentHeight {
+		if targetHeight < status.EarliestHeight {
+			return nil, fmt.Errorf("block %d is pruned: the node only keeps blocks from height %d", targetHeight, status.EarliestHeight)
+		}
+
 		// Get the actual block
 		block, err := p.client.GetBlockByHeight(ctx, targetHeight)
 		if err != nil {
@@ -44,6 +49,7 @@ func (p *BlockPredictor) PredictBlockTime(ctx context.Context, targetHeight int6
 			BlocksLeft:    0,
 			IsComplete:    true,
 			ActualTime:    &block.Time,
+			Verified:      block.Verified,
 		}, nil
 	}
 
@@ -100,6 +106,7 @@ func (p *BlockPredictor) PredictBlockTime(ctx context.Context, targetHeight int6
 		BlockTimeStats:  stats,
 		ConfidenceLevel: stats.ConfidenceLevel,
 		IsComplete:      false,
+		Verified:        stats.Verified && currentBlock.Verified,
 	}, nil
 }
 
@@ -154,6 +161,7 @@ func (p *BlockPredictor) PredictNextBlocks(ctx context.Context, count int) (*Mul
 		CurrentBlockAge: blockAge,
 		Predictions:     predictions,
 		BlockTimeStats:  stats,
+		Verified:        stats.Verified && currentBlock.Verified,
 	}, nil
 }
 
@@ -172,6 +180,7 @@ type BlockPrediction struct {
 	ConfidenceLevel float64               `json:"confidence_level"`
 	IsComplete      bool                  `json:"is_complete"`
 	ActualTime      *time.Time            `json:"actual_time,omitempty"`
+	Verified        bool                  `json:"verified"` // every header the prediction rests on was verified by the light client
 }
 
 // DurationEstimate represents estimated duration ranges
@@ -196,4 +205,5 @@ type MultiBlockPrediction struct {
 	CurrentBlockAge time.Duration         `json:"current_block_age"`
 	Predictions     []BlockMilestone      `json:"predictions"`
 	BlockTimeStats  *types.BlockTimeStats `json:"block_time_stats,omitempty"`
+	Verified        bool                  `json:"verified"` // every header the predictions rest on was verified by the light client
 }
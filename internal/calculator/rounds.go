@@ -0,0 +1,77 @@
+package calculator
+
+import (
+	"sort"
+
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+// commitRound returns the round of the commit block carries, -1 when it was not fetched
+func commitRound(block *types.BlockInfo) int32 {
+	if block.Commit == nil {
+		return -1
+	}
+	return block.Commit.Round
+}
+
+// roundStats splits block times by the round of the commit before each
+// block, where rounds holds -1 for unknown ones, and tells how much of the
+// tail above P95 followed later rounds. It returns nil without known rounds
+func roundStats(times []float64, rounds []int32) *types.RoundStats {
+	var first, later, known []float64
+	for i, round := range rounds {
+		switch {
+		case round < 0:
+			continue
+		case round == 0:
+			first = append(first, times[i])
+		default:
+			later = append(later, times[i])
+		}
+		known = append(known, times[i])
+	}
+	if len(known) == 0 {
+		return nil
+	}
+
+	sort.Float64s(known)
+	p95 := percentile(known, 0.95)
+
+	stats := &types.RoundStats{
+		FirstRound:  roundGroup(first, len(known)),
+		LaterRounds: roundGroup(later, len(known)),
+	}
+	var tailLater int
+	for i, round := range rounds {
+		if round >= 0 && times[i] > p95 {
+			stats.TailBlocks++
+			if round > 0 {
+				tailLater++
+			}
+		}
+	}
+	if stats.TailBlocks > 0 {
+		stats.TailLaterRounds = float64(tailLater) / float64(stats.TailBlocks)
+	}
+	return stats
+}
+
+// roundGroup summarizes the block times of a group out of total blocks
+func roundGroup(times []float64, total int) types.RoundGroup {
+	if len(times) == 0 {
+		return types.RoundGroup{}
+	}
+
+	sort.Float64s(times)
+	var sum float64
+	for _, v := range times {
+		sum += v
+	}
+	return types.RoundGroup{
+		Blocks: len(times),
+		Share:  float64(len(times)) / float64(total),
+		Mean:   sum / float64(len(times)),
+		Median: percentile(times, 0.5),
+		P95:    percentile(times, 0.95),
+	}
+}
@@ -0,0 +1,232 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	dbm "github.com/cometbft/cometbft-db"
+	sm "github.com/cometbft/cometbft/state"
+	"github.com/cometbft/cometbft/store"
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// BlockstoreClient implements BlockchainClient by reading the blockstore.db
+// and state.db of a CometBFT node's data directory, so a halted node can be
+// analyzed without any RPC. The databases are opened read-only.
+type BlockstoreClient struct {
+	dataDir string
+	blockDB dbm.DB
+	blocks  *store.BlockStore
+	stateDB dbm.DB   // nil when the data directory has no state.db
+	state   sm.Store // nil when the data directory has no state.db
+
+	validators *commitValidators // nil unless commits are recorded
+	load       bool              // attach the load from the stored block results
+}
+
+// NewBlockstoreClient opens the data directory of the node home config.Home,
+// or the home itself when it already is the data directory
+func NewBlockstoreClient(config *types.ChainConfig) (*BlockstoreClient, error) {
+	home := config.Home
+	dataDir := filepath.Join(home, "data")
+	if !dirExists(filepath.Join(dataDir, "blockstore.db")) {
+		dataDir = home
+	}
+	if !dirExists(filepath.Join(dataDir, "blockstore.db")) {
+		return nil, fmt.Errorf("no blockstore.db in %s or %s", home, filepath.Join(home, "data"))
+	}
+
+	blockDB, err := openReadOnlyDB("blockstore", dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &BlockstoreClient{
+		dataDir: dataDir,
+		blockDB: blockDB,
+		blocks:  store.NewBlockStore(blockDB),
+	}
+	if c.blocks.Height() == 0 {
+		blockDB.Close()
+		return nil, fmt.Errorf("blockstore in %s is empty", dataDir)
+	}
+
+	// The state is optional, blocks can be analyzed without validator sets
+	if dirExists(filepath.Join(dataDir, "state.db")) {
+		stateDB, err := openReadOnlyDB("state", dataDir)
+		if err != nil {
+			blockDB.Close()
+			return nil, err
+		}
+		c.stateDB = stateDB
+		c.state = sm.NewStore(stateDB, sm.StoreOptions{})
+	}
+
+	if config.Commits {
+		c.validators = newCommitValidators(config, c.getValidators)
+	}
+	if config.Load {
+		if c.state == nil {
+			c.Close()
+			return nil, fmt.Errorf("block results need the state.db, which is not in %s", dataDir)
+		}
+		c.load = true
+	}
+	return c, nil
+}
+
+// GetLatestBlockHeight gets the highest height in the blockstore
+func (c *BlockstoreClient) GetLatestBlockHeight(ctx context.Context) (int64, error) {
+	return c.blocks.Height(), nil
+}
+
+// GetStatus gets the chain ID and the height window of the blockstore. The
+// chain ID comes from the state, or from the latest header without state.db
+func (c *BlockstoreClient) GetStatus(ctx context.Context) (*types.NodeStatus, error) {
+	var chainID string
+	if c.state != nil {
+		state, err := c.state.Load()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load state: %w", err)
+		}
+		chainID = state.ChainID
+	}
+
+	if chainID == "" {
+		meta := c.blocks.LoadBlockMeta(c.blocks.Height())
+		if meta == nil {
+			return nil, fmt.Errorf("failed to load block %d", c.blocks.Height())
+		}
+		chainID = meta.Header.ChainID
+	}
+
+	return &types.NodeStatus{
+		ChainID:        chainID,
+		LatestHeight:   c.blocks.Height(),
+		EarliestHeight: c.blocks.Base(),
+	}, nil
+}
+
+// GetBlockByHeight gets block information by height. Recording commits
+// loads the full block instead of its meta
+func (c *BlockstoreClient) GetBlockByHeight(ctx context.Context, height int64) (*types.BlockInfo, error) {
+	var info *types.BlockInfo
+	var size int
+	if c.validators == nil {
+		meta := c.blocks.LoadBlockMeta(height)
+		if meta == nil {
+			return nil, c.missing(height)
+		}
+		info, size = blockInfoFromMeta(meta), meta.BlockSize
+	} else {
+		block := c.blocks.LoadBlock(height)
+		if block == nil {
+			return nil, c.missing(height)
+		}
+		info, size = blockInfoFromBlock(block), block.Size()
+		if block.LastCommit != nil {
+			c.validators.record(ctx, info, block.LastCommit.Height, block.LastCommit.Round, votesFromCommit(block.LastCommit))
+		}
+	}
+
+	if c.load {
+		// Nodes discarding ABCI responses only keep those of the latest block
+		resp, err := c.state.LoadFinalizeBlockResponse(height)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load block results at height %d: %w", height, err)
+		}
+		info.Load = loadFromResults(resp.TxResults, resp.Events, size)
+	}
+	return info, nil
+}
+
+// missing reports a height that is not in the blockstore
+func (c *BlockstoreClient) missing(height int64) error {
+	return fmt.Errorf("block %d is not in the blockstore, which has blocks %d-%d", height, c.blocks.Base(), c.blocks.Height())
+}
+
+// GetBlockRange gets a range of blocks
+func (c *BlockstoreClient) GetBlockRange(ctx context.Context, startHeight, endHeight int64) ([]*types.BlockInfo, error) {
+	if startHeight > endHeight {
+		return nil, fmt.Errorf("invalid range: start height %d > end height %d", startHeight, endHeight)
+	}
+
+	blocks := make([]*types.BlockInfo, 0, endHeight-startHeight+1)
+	for height := startHeight; height <= endHeight; height++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		block, err := c.GetBlockByHeight(ctx, height)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+	}
+
+	FillBlockTimes(blocks)
+	return blocks, nil
+}
+
+// GetValidatorSet gets the validator set of height from state.db
+func (c *BlockstoreClient) GetValidatorSet(ctx context.Context, height int64) ([]types.ValidatorInfo, error) {
+	set, err := c.getValidators(ctx, height)
+	if err != nil {
+		return nil, err
+	}
+	return validatorInfos(set), nil
+}
+
+// getValidators loads the validator set of height from state.db
+func (c *BlockstoreClient) getValidators(ctx context.Context, height int64) ([]validatorPower, error) {
+	if c.state == nil {
+		return nil, fmt.Errorf("no state.db in %s", c.dataDir)
+	}
+
+	validators, err := c.state.LoadValidators(height)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load validators at height %d: %w", height, err)
+	}
+	return validatorPowers(validators.Validators), nil
+}
+
+// Close closes the databases
+func (c *BlockstoreClient) Close() error {
+	err := c.blockDB.Close()
+	if c.stateDB != nil {
+		if stateErr := c.stateDB.Close(); err == nil {
+			err = stateErr
+		}
+	}
+	return err
+}
+
+// openReadOnlyDB opens dir/name.db read-only, detecting whether the node
+// wrote it with goleveldb or pebble
+func openReadOnlyDB(name, dir string) (dbm.DB, error) {
+	path := filepath.Join(dir, name+".db")
+
+	// Pebble writes an OPTIONS file next to its manifest, goleveldb does not
+	options, _ := filepath.Glob(filepath.Join(path, "OPTIONS-*"))
+	if len(options) > 0 {
+		db, err := openPebbleReadOnly(name, dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", path, err)
+		}
+		return db, nil
+	}
+
+	db, err := dbm.NewGoLevelDBWithOpts(name, dir, &opt.Options{ReadOnly: true, ErrorIfMissing: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s (is the node still running?): %w", path, err)
+	}
+	return db, nil
+}
+
+func dirExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
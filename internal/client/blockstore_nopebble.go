@@ -0,0 +1,14 @@
+//go:build !pebbledb
+
+package client
+
+import (
+	"fmt"
+
+	dbm "github.com/cometbft/cometbft-db"
+)
+
+// openPebbleReadOnly fails, as pebble support needs the pebbledb build tag
+func openPebbleReadOnly(name, dir string) (dbm.DB, error) {
+	return nil, fmt.Errorf("database uses the pebble backend, rebuild with -tags pebbledb to read it")
+}
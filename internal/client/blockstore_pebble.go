@@ -0,0 +1,13 @@
+//go:build pebbledb
+
+package client
+
+import (
+	"github.com/cockroachdb/pebble"
+	dbm "github.com/cometbft/cometbft-db"
+)
+
+// openPebbleReadOnly opens dir/name.db written by a node using the pebble backend
+func openPebbleReadOnly(name, dir string) (dbm.DB, error) {
+	return dbm.NewPebbleDBWithOpts(name, dir, &pebble.Options{ReadOnly: true})
+}
@@ -0,0 +1,56 @@
+//go:build pebbledb
+
+package client
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	dbm "github.com/cometbft/cometbft-db"
+	"github.com/cometbft/cometbft/crypto/ed25519"
+	tmtypes "github.com/cometbft/cometbft/types"
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+func TestBlockstoreClientPebble(t *testing.T) {
+	vals := tmtypes.NewValidatorSet([]*tmtypes.Validator{tmtypes.NewValidator(ed25519.GenPrivKey().PubKey(), 10)})
+	home, written := writeBlockstoreBackend(t, dbm.PebbleDBBackend, 5, 20, vals)
+
+	c, err := NewBlockstoreClient(&types.ChainConfig{Home: home})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	status, err := c.GetStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.ChainID != testChainID || status.LatestHeight != 20 || status.EarliestHeight != 5 {
+		t.Errorf("got status %+v", status)
+	}
+
+	blocks, err := c.GetBlockRange(ctx, 5, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != len(written) {
+		t.Fatalf("got %d blocks, want %d", len(blocks), len(written))
+	}
+	for i, block := range blocks {
+		if want := written[i]; block.Height != want.Height || block.Hash != want.Hash().String() || !block.Time.Equal(want.Time) {
+			t.Errorf("got block %d with hash %s at %s, want block %d", block.Height, block.Hash, block.Time, want.Height)
+		}
+	}
+
+	validators, err := c.GetValidatorSet(ctx, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []types.ValidatorInfo{{Address: vals.Validators[0].Address.String(), VotingPower: 10}}
+	if !slices.Equal(validators, want) {
+		t.Errorf("got validator set %+v, want %+v", validators, want)
+	}
+}
@@ -0,0 +1,346 @@
+package client
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	dbm "github.com/cometbft/cometbft-db"
+	abci "github.com/cometbft/cometbft/abci/types"
+	"github.com/cometbft/cometbft/crypto/ed25519"
+	"github.com/cometbft/cometbft/crypto/tmhash"
+	sm "github.com/cometbft/cometbft/state"
+	"github.com/cometbft/cometbft/store"
+	tmtypes "github.com/cometbft/cometbft/types"
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/testkit"
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+// writeBlockstore writes the blocks base..latest into a goleveldb
+// blockstore.db in the data directory of a node home, like a node that state
+// synced to base would. With vals, state.db holds the state at latest
+func writeBlockstore(t *testing.T, base, latest int64, vals *tmtypes.ValidatorSet) (home string, blocks []*tmtypes.Block) {
+	return writeBlockstoreBackend(t, dbm.GoLevelDBBackend, base, latest, vals)
+}
+
+// writeBlockstoreBackend is writeBlockstore with the databases written by
+// backend
+func writeBlockstoreBackend(t *testing.T, backend dbm.BackendType, base, latest int64, vals *tmtypes.ValidatorSet) (home string, blocks []*tmtypes.Block) {
+	home = t.TempDir()
+	dataDir := filepath.Join(home, "data")
+
+	blockDB, err := dbm.NewDB("blockstore", backend, dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer blockDB.Close()
+	blockStore := store.NewBlockStore(blockDB)
+
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	var lastID tmtypes.BlockID
+	lastCommit := &tmtypes.Commit{}
+	for height := base; height <= latest; height++ {
+		txs := make(tmtypes.Txs, height%3)
+		for i := range txs {
+			txs[i] = tmtypes.Tx{byte(height), byte(i)}
+		}
+
+		block := tmtypes.MakeBlock(height, txs, lastCommit, nil)
+		block.ChainID = testChainID
+		block.Time = start.Add(time.Duration(height) * 6 * time.Second)
+		block.LastBlockID = lastID
+		block.ProposerAddress = tmhash.SumTruncated([]byte{byte(height % 4)})
+
+		parts, err := block.MakePartSet(tmtypes.BlockPartSizeBytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blockID := tmtypes.BlockID{Hash: block.Hash(), PartSetHeader: parts.Header()}
+		seenCommit := &tmtypes.Commit{Height: height, BlockID: blockID}
+		blockStore.SaveBlock(block, parts, seenCommit)
+
+		blocks = append(blocks, block)
+		lastID = blockID
+		lastCommit = seenCommit
+	}
+
+	if vals == nil {
+		return home, blocks
+	}
+
+	stateDB, err := dbm.NewDB("state", backend, dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stateDB.Close()
+
+	err = sm.NewStore(stateDB, sm.StoreOptions{}).Bootstrap(sm.State{
+		ChainID:                          testChainID,
+		InitialHeight:                    1,
+		LastBlockHeight:                  latest,
+		LastBlockID:                      lastID,
+		LastBlockTime:                    blocks[len(blocks)-1].Time,
+		Validators:                       vals.Copy(),
+		NextValidators:                   vals.Copy(),
+		LastValidators:                   vals.Copy(),
+		LastHeightValidatorsChanged:      1,
+		ConsensusParams:                  *tmtypes.DefaultConsensusParams(),
+		LastHeightConsensusParamsChanged: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return home, blocks
+}
+
+func TestBlockstoreClient(t *testing.T) {
+	vals := tmtypes.NewValidatorSet([]*tmtypes.Validator{tmtypes.NewValidator(ed25519.GenPrivKey().PubKey(), 10)})
+	home, written := writeBlockstore(t, 5, 40, vals)
+
+	c, err := NewBlockstoreClient(&types.ChainConfig{Home: home})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	status, err := c.GetStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.ChainID != testChainID || status.LatestHeight != 40 || status.EarliestHeight != 5 {
+		t.Errorf("got status %+v", status)
+	}
+
+	blocks, err := c.GetBlockRange(ctx, 5, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 36 {
+		t.Fatalf("got %d blocks, want 36", len(blocks))
+	}
+	for i, block := range blocks {
+		want := written[i]
+		if block.Height != want.Height || block.Hash != want.Hash().String() || block.TxCount != len(want.Txs) {
+			t.Fatalf("got block %d with hash %s and %d txs, want block %d", block.Height, block.Hash, block.TxCount, want.Height)
+		}
+		if !block.Time.Equal(want.Time) || block.Proposer != want.ProposerAddress.String() {
+			t.Errorf("got block %d at %s proposed by %s", block.Height, block.Time, block.Proposer)
+		}
+		if i > 0 && block.BlockTime != 6 {
+			t.Errorf("got block time %v for block %d, want 6", block.BlockTime, block.Height)
+		}
+	}
+	if err := VerifyLinkage(blocks); err != nil {
+		t.Errorf("stored blocks do not link: %v", err)
+	}
+
+	_, err = c.GetBlockByHeight(ctx, 4)
+	if err == nil || !strings.Contains(err.Error(), "block 4 is not in the blockstore, which has blocks 5-40") {
+		t.Errorf("got error %v, want the block reported below the base", err)
+	}
+
+	validators, err := c.GetValidatorSet(ctx, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []types.ValidatorInfo
+	for _, val := range vals.Validators {
+		want = append(want, types.ValidatorInfo{Address: val.Address.String(), VotingPower: val.VotingPower})
+	}
+	if !slices.Equal(validators, want) {
+		t.Errorf("got validator set %+v, want %+v", validators, want)
+	}
+	if _, err := c.GetValidatorSet(ctx, 10); err == nil {
+		t.Error("got a validator set for height 10, which state.db does not hold")
+	}
+}
+
+func TestBlockstoreClientWithoutState(t *testing.T) {
+	home, _ := writeBlockstore(t, 1, 10, nil)
+
+	// The data directory itself works as the home
+	c, err := NewBlockstoreClient(&types.ChainConfig{Home: filepath.Join(home, "data")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// The chain ID comes from the latest header
+	status, err := c.GetStatus(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.ChainID != testChainID || status.LatestHeight != 10 || status.EarliestHeight != 1 {
+		t.Errorf("got status %+v", status)
+	}
+
+	_, err = c.GetValidatorSet(context.Background(), 10)
+	if err == nil || !strings.Contains(err.Error(), "no state.db in") {
+		t.Errorf("got error %v, want state.db reported missing", err)
+	}
+}
+
+func TestNewBlockstoreClientErrors(t *testing.T) {
+	home, _ := writeBlockstore(t, 1, 10, nil)
+
+	// A running node holds the lock on its databases
+	running, err := dbm.NewGoLevelDB("blockstore", filepath.Join(home, "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewBlockstoreClient(&types.ChainConfig{Home: home})
+	running.Close()
+	if err == nil || !strings.Contains(err.Error(), "is the node still running?") {
+		t.Errorf("got error %v, want the lock reported", err)
+	}
+
+	empty := t.TempDir()
+	_, err = NewBlockstoreClient(&types.ChainConfig{Home: empty})
+	if err == nil || !strings.Contains(err.Error(), "no blockstore.db in") {
+		t.Errorf("got error %v, want the missing blockstore reported", err)
+	}
+
+	// A blockstore with the pebble OPTIONS file needs the pebbledb build tag
+	// or opens as pebble with it, never as goleveldb
+	pebbleDir := filepath.Join(t.TempDir(), "blockstore.db")
+	if err := os.MkdirAll(pebbleDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(pebbleDir, "OPTIONS-000001"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewBlockstoreClient(&types.ChainConfig{Home: filepath.Dir(pebbleDir)})
+	if err == nil || strings.Contains(err.Error(), "is the node still running?") {
+		t.Errorf("got error %v, want the pebble backend detected", err)
+	}
+}
+
+func TestBlockstoreClientLoad(t *testing.T) {
+	vals := tmtypes.NewValidatorSet([]*tmtypes.Validator{tmtypes.NewValidator(ed25519.GenPrivKey().PubKey(), 10)})
+	home, written := writeBlockstore(t, 1, 10, vals)
+
+	// The node kept the block results of heights 1-9 only
+	stateDB, err := dbm.NewGoLevelDB("state", filepath.Join(home, "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := sm.NewStore(stateDB, sm.StoreOptions{})
+	for height := int64(1); height <= 9; height++ {
+		resp := &abci.ResponseFinalizeBlock{Events: []abci.Event{{Type: "coin_received"}}}
+		for range written[height-1].Txs {
+			resp.TxResults = append(resp.TxResults, &abci.ExecTxResult{GasWanted: 100, GasUsed: 80, Events: []abci.Event{{Type: "message"}, {Type: "transfer"}}})
+		}
+		if err := state.SaveFinalizeBlockResponse(height, resp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stateDB.Close()
+
+	c, err := NewBlockstoreClient(&types.ChainConfig{Home: home, Load: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	blocks, err := c.GetBlockRange(context.Background(), 1, 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, block := range blocks {
+		txs := int64(len(written[i].Txs))
+		want := types.LoadInfo{GasUsed: 80 * txs, GasWanted: 100 * txs, Events: 1 + 2*int(txs), Size: written[i].Size()}
+		if block.Load == nil || *block.Load != want {
+			t.Errorf("got load %+v in block %d, want %+v", block.Load, block.Height, want)
+		}
+	}
+
+	_, err = c.GetBlockByHeight(context.Background(), 10)
+	if err == nil || !strings.Contains(err.Error(), "failed to load block results at height 10") {
+		t.Errorf("got error %v, want the missing block results reported", err)
+	}
+
+	withoutState, _ := writeBlockstore(t, 1, 10, nil)
+	_, err = NewBlockstoreClient(&types.ChainConfig{Home: withoutState, Load: true})
+	if err == nil || !strings.Contains(err.Error(), "block results need the state.db") {
+		t.Errorf("got error %v, want state.db reported missing", err)
+	}
+}
+
+func TestBlockstoreClientCommits(t *testing.T) {
+	validators := []testkit.Validator{{Name: "alpha", Power: 50}, {Name: "beta", Power: 30}, {Name: "gamma", Power: 20}}
+	chain := testkit.NewChain(testChainID, validators...)
+	chain.Append(make([]testkit.Block, 5)...)
+	chain.Append(testkit.Block{Round: 1, Absent: []string{"gamma"}}, testkit.Block{})
+
+	// A node that stored blocks 1-6, with state.db holding the validators of height 5
+	home := t.TempDir()
+	dataDir := filepath.Join(home, "data")
+	blockDB, err := dbm.NewGoLevelDB("blockstore", dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockStore := store.NewBlockStore(blockDB)
+	for height := int64(1); height <= 6; height++ {
+		block := chain.Block(height)
+		parts, err := block.MakePartSet(tmtypes.BlockPartSizeBytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blockStore.SaveBlock(block, parts, chain.Block(height+1).LastCommit)
+	}
+	blockDB.Close()
+
+	vals := make([]*tmtypes.Validator, len(validators))
+	for i, val := range validators {
+		vals[i] = tmtypes.NewValidator(ed25519.GenPrivKeyFromSecret([]byte(val.Name)).PubKey(), val.Power)
+	}
+	set := tmtypes.NewValidatorSet(vals)
+	stateDB, err := dbm.NewDB("state", backend, dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sm.NewStore(stateDB, sm.StoreOptions{}).Bootstrap(sm.State{
+		ChainID:                          testChainID,
+		InitialHeight:                    1,
+		LastBlockHeight:                  4,
+		LastBlockTime:                    chain.Block(4).Time,
+		Validators:                       set.Copy(),
+		NextValidators:                   set.Copy(),
+		LastValidators:                   set.Copy(),
+		LastHeightValidatorsChanged:      1,
+		ConsensusParams:                  *tmtypes.DefaultConsensusParams(),
+		LastHeightConsensusParamsChanged: 1,
+	})
+	stateDB.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewBlockstoreClient(&types.ChainConfig{Home: home, Commits: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	blocks, err := c.GetBlockRange(context.Background(), 5, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []types.CommitInfo{
+		{Signatures: 3, SignedPower: 1},
+		{Round: 1, Signatures: 2, Absent: 1, SignedPower: 0.8},
+	}
+	for i, block := range blocks {
+		if block.Commit == nil || *block.Commit != want[i] {
+			t.Errorf("got commit %+v in block %d, want %+v", block.Commit, block.Height, want[i])
+		}
+		if block.Hash != chain.Block(block.Height).Hash().String() {
+			t.Errorf("got hash %s for block %d", block.Hash, block.Height)
+		}
+	}
+}
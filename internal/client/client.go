@@ -6,30 +6,101 @@ import (
 	"time"
 
 	rpchttp "github.com/cometbft/cometbft/rpc/client/http"
+	coretypes "github.com/cometbft/cometbft/rpc/core/types"
 	tmtypes "github.com/cometbft/cometbft/types"
+	stakingtypes "github.com/cosmos/cosmos-sdk/x/staking/types"
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/simulate"
 	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
 )
 
+// maxBlockMetas is the maximum number of headers a node returns per /blockchain call
+const maxBlockMetas = 20
+
+// maxValidatorsPerPage is the maximum number of validators a node returns per /validators call
+const maxValidatorsPerPage = 100
+
+// Transports supported by NewClient
+const (
+	TransportRPC  = "rpc"  // CometBFT JSON-RPC
+	TransportGRPC = "grpc" // Cosmos SDK tendermint gRPC service
+	TransportREST = "rest" // Cosmos SDK REST (LCD) gateway
+	TransportEVM  = "evm"  // Ethereum JSON-RPC of EVM chains
+)
+
 // BlockchainClient interface for blockchain interactions
 type BlockchainClient interface {
 	GetLatestBlockHeight(ctx context.Context) (int64, error)
+	GetStatus(ctx context.Context) (*types.NodeStatus, error)
 	GetBlockByHeight(ctx context.Context, height int64) (*types.BlockInfo, error)
 	GetBlockRange(ctx context.Context, startHeight, endHeight int64) ([]*types.BlockInfo, error)
 	Close() error
 }
 
+// Wrapper is implemented by clients that add behavior in front of another client
+type Wrapper interface {
+	Unwrap() BlockchainClient
+}
+
 // CosmosSDKClient implements BlockchainClient for Cosmos SDK blockchain
 type CosmosSDKClient struct {
-	config *types.ChainConfig
-	client *rpchttp.HTTP
+	config     *types.ChainConfig
+	client     *rpchttp.HTTP
+	retry      *retrier
+	validators *commitValidators // nil unless commits are recorded
 }
 
-// NewCosmosSDKClient creates a new Cosmos SDK blockchain client
-func NewCosmosSDKClient(config *types.ChainConfig) (*CosmosSDKClient, error) {
-	if config.RPCEndpoint == "" {
-		return nil, fmt.Errorf("RPC endpoint is required")
+// NewClient creates a BlockchainClient for the configured transport, spreading
+// requests over all endpoints when several RPC endpoints are configured. With
+// a simulation spec, a blocks file or a node home directory configured, blocks
+// come from there instead
+func NewClient(config *types.ChainConfig) (BlockchainClient, error) {
+	if config.Simulate != "" {
+		return simulate.Open(config.Simulate, config.ChainID)
+	}
+	if config.FromFile != "" {
+		return NewFileClient(config.FromFile, config.ChainID)
+	}
+	if config.Home != "" {
+		return NewBlockstoreClient(config)
 	}
 
+	switch config.Transport {
+	case "", TransportRPC:
+	case TransportGRPC:
+		if len(config.GRPCEndpoints) > 1 {
+			return newFailoverClient(config, config.GRPCEndpoints, func(url string) (BlockchainClient, error) {
+				endpointConfig := *config
+				endpointConfig.GRPCEndpoint = url
+				endpointConfig.GRPCEndpoints = nil
+				return NewGRPCClient(&endpointConfig)
+			})
+		}
+		return NewGRPCClient(config)
+	case TransportREST:
+		if len(config.RESTEndpoints) > 1 {
+			return newFailoverClient(config, config.RESTEndpoints, func(url string) (BlockchainClient, error) {
+				endpointConfig := *config
+				endpointConfig.RESTEndpoint = url
+				endpointConfig.RESTEndpoints = nil
+				return NewRESTClient(&endpointConfig)
+			})
+		}
+		return NewRESTClient(config)
+	case TransportEVM:
+		return NewEVMClient(config)
+	default:
+		return nil, fmt.Errorf("unknown transport: %s", config.Transport)
+	}
+
+	if len(config.RPCEndpoints) > 1 {
+		return NewMultiClient(config)
+	}
+
+	return NewCosmosSDKClient(config)
+}
+
+// applyDefaults fills in the connection settings left unset in config
+func applyDefaults(config *types.ChainConfig) {
 	if config.Timeout == 0 {
 		config.Timeout = 30 * time.Second
 	}
@@ -42,87 +113,142 @@ func NewCosmosSDKClient(config *types.ChainConfig) (*CosmosSDKClient, error) {
 		config.RetryDelay = time.Second
 	}
 
+	if config.MaxConcurrency == 0 {
+		config.MaxConcurrency = defaultMaxConcurrency
+	}
+}
+
+// NewCosmosSDKClient creates a new Cosmos SDK blockchain client
+func NewCosmosSDKClient(config *types.ChainConfig) (*CosmosSDKClient, error) {
+	if config.RPCEndpoint == "" {
+		return nil, fmt.Errorf("RPC endpoint is required")
+	}
+
+	applyDefaults(config)
+
 	// Create CometBFT HTTP client
 	client, err := rpchttp.New(config.RPCEndpoint, "/websocket")
 	if err != nil {
 		return nil, fmt.Errorf("failed to create RPC client: %w", err)
 	}
 
-	return &CosmosSDKClient{
+	c := &CosmosSDKClient{
 		config: config,
 		client: client,
-	}, nil
+		retry:  newRetrier(config, config.RPCEndpoint),
+	}
+	if config.Commits {
+		c.validators = newCommitValidators(config, c.getValidators)
+	}
+	return c, nil
 }
 
 // GetLatestBlockHeight gets the latest block height
 func (c *CosmosSDKClient) GetLatestBlockHeight(ctx context.Context) (int64, error) {
-	status, err := c.client.Status(ctx)
+	status, err := c.GetStatus(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to get status: %w", err)
+		return 0, err
 	}
 
-	return status.SyncInfo.LatestBlockHeight, nil
+	return status.LatestHeight, nil
+}
+
+// GetStatus gets the chain ID and the available height window of the node
+func (c *CosmosSDKClient) GetStatus(ctx context.Context) (*types.NodeStatus, error) {
+	var status *coretypes.ResultStatus
+	err := c.retry.do(ctx, func(ctx context.Context) (err error) {
+		status, err = c.client.Status(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get status: %w", err)
+	}
+
+	return &types.NodeStatus{
+		ChainID:        status.NodeInfo.Network,
+		LatestHeight:   status.SyncInfo.LatestBlockHeight,
+		EarliestHeight: status.SyncInfo.EarliestBlockHeight,
+		CatchingUp:     status.SyncInfo.CatchingUp,
+	}, nil
 }
 
 // GetBlockByHeight gets block information by height
 func (c *CosmosSDKClient) GetBlockByHeight(ctx context.Context, height int64) (*types.BlockInfo, error) {
-	blockResult, err := c.client.Block(ctx, &height)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get block at height %d: %w", height, err)
+	var block *types.BlockInfo
+	var size int
+	if c.config.Commits {
+		full, err := c.getBlock(ctx, height)
+		if err != nil {
+			return nil, err
+		}
+		block, size = c.fromBlock(ctx, full), full.Size()
+	} else {
+		metas, err := c.getBlockMetas(ctx, height, height)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get block at height %d: %w", height, err)
+		}
+		block, size = blockInfoFromMeta(metas[0]), metas[0].BlockSize
 	}
 
-	if blockResult == nil || blockResult.Block == nil {
-		return nil, fmt.Errorf("nil block result at height %d", height)
+	if c.config.Load {
+		load, err := c.getLoad(ctx, height, size)
+		if err != nil {
+			return nil, err
+		}
+		block.Load = load
 	}
 
-	return &types.BlockInfo{
-		Height:   blockResult.Block.Height,
-		Time:     blockResult.Block.Time,
-		Hash:     blockResult.Block.LastBlockID.Hash.String(),
-		Proposer: blockResult.Block.ProposerAddress.String(),
-		TxCount:  len(blockResult.Block.Txs),
-	}, nil
+	return block, nil
 }
 
-// GetBlockRange gets a range of blocks
+// GetBlockRange gets a range of blocks. Recording commits or load takes
+// requests per height instead of batches of headers
 func (c *CosmosSDKClient) GetBlockRange(ctx context.Context, startHeight, endHeight int64) ([]*types.BlockInfo, error) {
 	if startHeight > endHeight {
 		return nil, fmt.Errorf("invalid range: start height %d > end height %d", startHeight, endHeight)
 	}
+	if c.config.Commits || c.config.Load {
+		return getBlockRangeByHeight(ctx, c, startHeight, endHeight, c.config.MaxConcurrency)
+	}
 
-	blocks := make([]*types.BlockInfo, 0, endHeight-startHeight+1)
+	count := endHeight - startHeight + 1
+	metas := make([]*tmtypes.BlockMeta, count)
 
-	// Fetch blocks in parallel with controlled concurrency
-	const maxConcurrent = 10
+	// Fetch headers in batches of maxBlockMetas, the limiter adapts how many run at once
+	maxConcurrent := c.config.MaxConcurrency
 	semaphore := make(chan struct{}, maxConcurrent)
-	blockChan := make(chan *tmtypes.Block, endHeight-startHeight+1)
 	errChan := make(chan error, 1)
 
-	// Fetch all blocks first
-	for height := startHeight; height <= endHeight; height++ {
+	for batchStart := startHeight; batchStart <= endHeight; batchStart += maxBlockMetas {
 		select {
 		case <-ctx.Done():
 			return nil, ctx.Err()
 		default:
 		}
 
+		batchEnd := batchStart + maxBlockMetas - 1
+		if batchEnd > endHeight {
+			batchEnd = endHeight
+		}
+
 		semaphore <- struct{}{}
-		go func(h int64) {
+		go func(minHeight, maxHeight int64) {
 			defer func() { <-semaphore }()
 
-			blockResult, err := c.client.Block(ctx, &h)
+			batch, err := c.getBlockMetas(ctx, minHeight, maxHeight)
 			if err != nil {
 				select {
-				case errChan <- fmt.Errorf("failed to get block %d: %w", h, err):
+				case errChan <- fmt.Errorf("failed to get blocks %d-%d: %w", minHeight, maxHeight, err):
 				default:
 				}
 				return
 			}
 
-			if blockResult != nil && blockResult.Block != nil {
-				blockChan <- blockResult.Block
+			// Each batch writes a disjoint part of the slice
+			for _, meta := range batch {
+				metas[meta.Header.Height-startHeight] = meta
 			}
-		}(height)
+		}(batchStart, batchEnd)
 	}
 
 	// Wait for all goroutines to complete
@@ -130,52 +256,187 @@ func (c *CosmosSDKClient) GetBlockRange(ctx context.Context, startHeight, endHei
 		semaphore <- struct{}{}
 	}
 
-	close(blockChan)
 	close(errChan)
 
 	// Check for errors
-	select {
-	case err := <-errChan:
+	if err := <-errChan; err != nil {
+		return nil, err
+	}
+
+	// Convert to BlockInfo and calculate block times
+	blocks := make([]*types.BlockInfo, 0, count)
+	for i, meta := range metas {
+		blockInfo := blockInfoFromMeta(meta)
+
+		// Calculate block time if not the first block
+		if i > 0 {
+			blockInfo.BlockTime = meta.Header.Time.Sub(metas[i-1].Header.Time).Seconds()
+		}
+
+		blocks = append(blocks, blockInfo)
+	}
+
+	return blocks, nil
+}
+
+// getBlockMetas fetches the headers for minHeight..maxHeight (at most
+// maxBlockMetas heights) with a single /blockchain call, in ascending order
+func (c *CosmosSDKClient) getBlockMetas(ctx context.Context, minHeight, maxHeight int64) ([]*tmtypes.BlockMeta, error) {
+	var result *coretypes.ResultBlockchainInfo
+	err := c.retry.do(ctx, func(ctx context.Context) (err error) {
+		result, err = c.client.BlockchainInfo(ctx, minHeight, maxHeight)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The node returns metas in descending order and silently narrows the
+	// range to what it has, so place them by height and check for holes
+	metas := make([]*tmtypes.BlockMeta, maxHeight-minHeight+1)
+	for _, meta := range result.BlockMetas {
+		if meta == nil || meta.Header.Height < minHeight || meta.Header.Height > maxHeight {
+			continue
+		}
+		metas[meta.Header.Height-minHeight] = meta
+	}
+
+	for i, meta := range metas {
+		if meta == nil {
+			return nil, fmt.Errorf("node did not return block %d", minHeight+int64(i))
+		}
+	}
+
+	return metas, nil
+}
+
+// getBlock fetches the full block at height with its last commit
+func (c *CosmosSDKClient) getBlock(ctx context.Context, height int64) (*tmtypes.Block, error) {
+	var result *coretypes.ResultBlock
+	err := c.retry.do(ctx, func(ctx context.Context) (err error) {
+		result, err = c.client.Block(ctx, &height)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get block at height %d: %w", height, err)
+	}
+	if result.Block == nil {
+		return nil, fmt.Errorf("failed to get block at height %d: node did not return block %d", height, height)
+	}
+
+	return result.Block, nil
+}
+
+// getLoad fetches the execution results of the block at height, whose size
+// in bytes is known from its meta or the block itself
+func (c *CosmosSDKClient) getLoad(ctx context.Context, height int64, size int) (*types.LoadInfo, error) {
+	var result *coretypes.ResultBlockResults
+	err := c.retry.do(ctx, func(ctx context.Context) (err error) {
+		result, err = c.client.BlockResults(ctx, &height)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get block results at height %d: %w", height, err)
+	}
+
+	return loadFromResults(result.TxsResults, result.FinalizeBlockEvents, size), nil
+}
+
+// getValidators fetches the validator set of height page by page
+func (c *CosmosSDKClient) getValidators(ctx context.Context, height int64) ([]validatorPower, error) {
+	var vals []*tmtypes.Validator
+	perPage := maxValidatorsPerPage
+	for page := 1; ; page++ {
+		var result *coretypes.ResultValidators
+		err := c.retry.do(ctx, func(ctx context.Context) (err error) {
+			result, err = c.client.Validators(ctx, &height, &page, &perPage)
+			return err
+		})
 		if err != nil {
 			return nil, err
 		}
-	default:
+
+		vals = append(vals, result.Validators...)
+		if len(vals) >= result.Total || len(result.Validators) == 0 {
+			return validatorPowers(vals), nil
+		}
 	}
+}
 
-	// Collect and convert blocks
-	tmBlocks := make([]*tmtypes.Block, 0)
-	for block := range blockChan {
-		tmBlocks = append(tmBlocks, block)
+// GetValidatorSet gets the validator set of height
+func (c *CosmosSDKClient) GetValidatorSet(ctx context.Context, height int64) ([]types.ValidatorInfo, error) {
+	set, err := c.getValidators(ctx, height)
+	if err != nil {
+		return nil, err
 	}
+	return validatorInfos(set), nil
+}
 
-	// Sort blocks by height
-	for i := 0; i < len(tmBlocks)-1; i++ {
-		for j := i + 1; j < len(tmBlocks); j++ {
-			if tmBlocks[i].Height > tmBlocks[j].Height {
-				tmBlocks[i], tmBlocks[j] = tmBlocks[j], tmBlocks[i]
-			}
+// GetStakingValidators queries the validators of the staking module over
+// abci_query, which nodes of Cosmos SDK chains answer like the gRPC query
+func (c *CosmosSDKClient) GetStakingValidators(ctx context.Context) ([]types.ValidatorInfo, error) {
+	return stakingValidators(ctx, func(ctx context.Context, req *stakingtypes.QueryValidatorsRequest) (*stakingtypes.QueryValidatorsResponse, error) {
+		data, err := req.Marshal()
+		if err != nil {
+			return nil, err
 		}
-	}
 
-	// Convert to BlockInfo and calculate block times
-	for i, block := range tmBlocks {
-		blockInfo := &types.BlockInfo{
-			Height:   block.Height,
-			Time:     block.Time,
-			Hash:     block.LastBlockID.Hash.String(),
-			Proposer: block.ProposerAddress.String(),
-			TxCount:  len(block.Txs),
+		var result *coretypes.ResultABCIQuery
+		err = c.retry.do(ctx, func(ctx context.Context) (err error) {
+			result, err = c.client.ABCIQuery(ctx, stakingValidatorsPath, data)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !result.Response.IsOK() {
+			return nil, fmt.Errorf("%s failed with code %d: %s", stakingValidatorsPath, result.Response.Code, result.Response.Log)
 		}
 
-		// Calculate block time if not the first block
-		if i > 0 {
-			blockInfo.BlockTime = block.Time.Sub(tmBlocks[i-1].Time).Seconds()
+		var resp stakingtypes.QueryValidatorsResponse
+		if err := resp.Unmarshal(result.Response.Value); err != nil {
+			return nil, fmt.Errorf("invalid response to %s: %w", stakingValidatorsPath, err)
 		}
+		return &resp, nil
+	})
+}
 
-		blocks = append(blocks, blockInfo)
+// fromBlock converts a full block into BlockInfo, with its last commit when
+// commits are recorded
+func (c *CosmosSDKClient) fromBlock(ctx context.Context, block *tmtypes.Block) *types.BlockInfo {
+	info := blockInfoFromBlock(block)
+	if c.config.Commits && block.LastCommit != nil {
+		c.validators.record(ctx, info, block.LastCommit.Height, block.LastCommit.Round, votesFromCommit(block.LastCommit))
 	}
+	return info
+}
 
-	return blocks, nil
+// blockInfoFromMeta converts a block meta into BlockInfo. The hash is computed
+// from the header rather than taken from the node, so it commits to the block time
+func blockInfoFromMeta(meta *tmtypes.BlockMeta) *types.BlockInfo {
+	return &types.BlockInfo{
+		Height:     meta.Header.Height,
+		Time:       meta.Header.Time,
+		Hash:       meta.Header.Hash().String(),
+		ParentHash: meta.Header.LastBlockID.Hash.String(),
+		Proposer:   meta.Header.ProposerAddress.String(),
+		TxCount:    meta.NumTxs,
+	}
+}
+
+// Stats returns the request and retry counters of the client
+func (c *CosmosSDKClient) Stats() Stats {
+	return c.retry.stats()
+}
+
+// FillBlockTimes sets the block time of every block from the block before it
+func FillBlockTimes(blocks []*types.BlockInfo) {
+	for i, block := range blocks {
+		block.BlockTime = 0
+		if i > 0 {
+			block.BlockTime = block.Time.Sub(blocks[i-1].Time).Seconds()
+		}
+	}
 }
 
 // Close closes the client
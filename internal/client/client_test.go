@@ -0,0 +1,301 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cometbft/cometbft/crypto/tmhash"
+	"github.com/cometbft/cometbft/p2p"
+	coretypes "github.com/cometbft/cometbft/rpc/core/types"
+	rpctypes "github.com/cometbft/cometbft/rpc/jsonrpc/types"
+	tmtypes "github.com/cometbft/cometbft/types"
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+const testChainID = "test-1"
+
+// testChain builds linked block metas for heights 1..n, metas[h-1] being height h
+func testChain(n int64) []*tmtypes.BlockMeta {
+	base := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	metas := make([]*tmtypes.BlockMeta, 0, n)
+
+	var lastID tmtypes.BlockID
+	for height := int64(1); height <= n; height++ {
+		header := tmtypes.Header{
+			ChainID:         testChainID,
+			Height:          height,
+			Time:            base.Add(time.Duration(height)*6*time.Second + time.Duration(height%3)*100*time.Millisecond),
+			LastBlockID:     lastID,
+			ValidatorsHash:  tmhash.Sum([]byte("validators")),
+			ProposerAddress: tmhash.SumTruncated([]byte{byte(height % 4)}),
+		}
+		meta := &tmtypes.BlockMeta{
+			BlockID: tmtypes.BlockID{Hash: header.Hash()},
+			Header:  header,
+			NumTxs:  int(height % 5),
+		}
+		metas = append(metas, meta)
+		lastID = meta.BlockID
+	}
+	return metas
+}
+
+// rpcServer is a CometBFT JSON-RPC stand-in serving status and blockchain
+type rpcServer struct {
+	*httptest.Server
+
+	metas []*tmtypes.BlockMeta
+
+	mu       sync.Mutex
+	calls    map[string]int
+	omit     map[int64]bool // heights left out of blockchain responses
+	limit    int64          // highest height the node admits to have, 0 for all
+	earliest int64          // earliest height reported by status
+}
+
+func newRPCServer(t *testing.T, metas []*tmtypes.BlockMeta) *rpcServer {
+	s := &rpcServer{
+		metas: metas,
+		calls: make(map[string]int),
+		omit:  make(map[int64]bool),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *rpcServer) handle(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	var req rpctypes.RPCRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var params map[string]string
+	json.Unmarshal(req.Params, &params)
+
+	s.mu.Lock()
+	s.calls[req.Method]++
+	s.mu.Unlock()
+
+	var result any
+	switch req.Method {
+	case "status":
+		result = s.status()
+	case "blockchain":
+		minHeight, _ := strconv.ParseInt(params["minHeight"], 10, 64)
+		maxHeight, _ := strconv.ParseInt(params["maxHeight"], 10, 64)
+		result = s.blockchain(minHeight, maxHeight)
+	default:
+		json.NewEncoder(w).Encode(rpctypes.RPCMethodNotFoundError(req.ID))
+		return
+	}
+
+	json.NewEncoder(w).Encode(rpctypes.NewRPCSuccessResponse(req.ID, result))
+}
+
+func (s *rpcServer) latest() int64 {
+	if s.limit > 0 {
+		return s.limit
+	}
+	return int64(len(s.metas))
+}
+
+func (s *rpcServer) status() *coretypes.ResultStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return &coretypes.ResultStatus{
+		NodeInfo: p2p.DefaultNodeInfo{Network: testChainID},
+		SyncInfo: coretypes.SyncInfo{
+			LatestBlockHeight:   s.latest(),
+			EarliestBlockHeight: max(s.earliest, 1),
+		},
+	}
+}
+
+// blockchain answers like CometBFT: at most maxBlockMetas metas in descending
+// order, silently narrowed to the heights the node has
+func (s *rpcServer) blockchain(minHeight, maxHeight int64) *coretypes.ResultBlockchainInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	maxHeight = min(maxHeight, s.latest())
+	minHeight = max(minHeight, maxHeight-maxBlockMetas+1)
+
+	result := &coretypes.ResultBlockchainInfo{LastHeight: s.latest()}
+	for height := maxHeight; height >= minHeight; height-- {
+		if !s.omit[height] {
+			result.BlockMetas = append(result.BlockMetas, s.metas[height-1])
+		}
+	}
+	return result
+}
+
+func (s *rpcServer) callCount(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[method]
+}
+
+func newTestRPCClient(t *testing.T, url string) *CosmosSDKClient {
+	c, err := NewCosmosSDKClient(&types.ChainConfig{
+		RPCEndpoint: url,
+		Timeout:     5 * time.Second,
+		MaxRetries:  1,
+		RetryDelay:  time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCosmosSDKClientGetBlockRange(t *testing.T) {
+	metas := testChain(100)
+
+	tests := []struct {
+		name      string
+		start     int64
+		end       int64
+		wantCalls int
+	}{
+		{"single height", 7, 7, 1},
+		{"one batch", 1, 20, 1},
+		{"batch boundary", 20, 21, 2},
+		{"several batches", 3, 67, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newRPCServer(t, metas)
+			c := newTestRPCClient(t, server.URL)
+
+			blocks, err := c.GetBlockRange(context.Background(), tt.start, tt.end)
+			if err != nil {
+				t.Fatalf("GetBlockRange: %v", err)
+			}
+			if got := server.callCount("blockchain"); got != tt.wantCalls {
+				t.Errorf("got %d blockchain calls, want %d", got, tt.wantCalls)
+			}
+			if len(blocks) != int(tt.end-tt.start+1) {
+				t.Fatalf("got %d blocks, want %d", len(blocks), tt.end-tt.start+1)
+			}
+
+			for i, block := range blocks {
+				meta := metas[tt.start-1+int64(i)]
+				if block.Height != meta.Header.Height || !block.Time.Equal(meta.Header.Time) {
+					t.Fatalf("block %d: got height %d at %s, want %d at %s", i, block.Height, block.Time, meta.Header.Height, meta.Header.Time)
+				}
+				if block.Hash != meta.BlockID.Hash.String() || block.ParentHash != meta.Header.LastBlockID.Hash.String() {
+					t.Errorf("block %d: hashes %s/%s do not match the header", block.Height, block.Hash, block.ParentHash)
+				}
+				if block.Proposer != meta.Header.ProposerAddress.String() || block.TxCount != meta.NumTxs {
+					t.Errorf("block %d: got proposer %s with %d txs", block.Height, block.Proposer, block.TxCount)
+				}
+
+				want := 0.0
+				if i > 0 {
+					want = meta.Header.Time.Sub(metas[tt.start-2+int64(i)].Header.Time).Seconds()
+				}
+				if block.BlockTime != want {
+					t.Errorf("block %d: got block time %v, want %v", block.Height, block.BlockTime, want)
+				}
+			}
+
+			if err := VerifyLinkage(blocks); err != nil {
+				t.Errorf("fetched blocks do not link: %v", err)
+			}
+		})
+	}
+}
+
+func TestCosmosSDKClientMissingMetas(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(s *rpcServer)
+		start   int64
+		end     int64
+		wantErr string
+	}{
+		{
+			name:    "hole in the response",
+			setup:   func(s *rpcServer) { s.omit[13] = true },
+			start:   1,
+			end:     20,
+			wantErr: "node did not return block 13",
+		},
+		{
+			name:    "range narrowed to the latest height",
+			setup:   func(s *rpcServer) { s.limit = 15 },
+			start:   10,
+			end:     20,
+			wantErr: "node did not return block 16",
+		},
+		{
+			name:    "hole in a later batch",
+			setup:   func(s *rpcServer) { s.omit[45] = true },
+			start:   1,
+			end:     60,
+			wantErr: "node did not return block 45",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newRPCServer(t, testChain(100))
+			tt.setup(server)
+			c := newTestRPCClient(t, server.URL)
+
+			_, err := c.GetBlockRange(context.Background(), tt.start, tt.end)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCosmosSDKClientGetBlockByHeight(t *testing.T) {
+	metas := testChain(30)
+	server := newRPCServer(t, metas)
+	c := newTestRPCClient(t, server.URL)
+
+	block, err := c.GetBlockByHeight(context.Background(), 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.Height != 12 || block.Hash != metas[11].BlockID.Hash.String() {
+		t.Errorf("got block %d with hash %s", block.Height, block.Hash)
+	}
+	if server.callCount("block") != 0 {
+		t.Errorf("full blocks were requested for a header lookup")
+	}
+
+	if _, err := c.GetBlockByHeight(context.Background(), 31); err == nil {
+		t.Error("expected an error above the latest height")
+	}
+}
+
+func TestCosmosSDKClientGetStatus(t *testing.T) {
+	server := newRPCServer(t, testChain(50))
+	server.earliest = 11
+	c := newTestRPCClient(t, server.URL)
+
+	status, err := c.GetStatus(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.ChainID != testChainID || status.LatestHeight != 50 || status.EarliestHeight != 11 || status.CatchingUp {
+		t.Errorf("got status %+v", status)
+	}
+}
@@ -0,0 +1,161 @@
+package client
+
+import (
+	"context"
+	"sync"
+
+	tmtypes "github.com/cometbft/cometbft/types"
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+// maxCachedValidatorSets is the number of validator sets kept for signed power
+const maxCachedValidatorSets = 8
+
+// commitVote is the vote of one validator in a commit
+type commitVote struct {
+	flag    tmtypes.BlockIDFlag
+	address string // hex consensus address, empty for absent validators
+}
+
+// validatorPower is the voting power of a validator at some height
+type validatorPower struct {
+	address string // hex consensus address
+	power   int64
+}
+
+// votesFromCommit lists the votes of a CometBFT commit in validator set order
+func votesFromCommit(commit *tmtypes.Commit) []commitVote {
+	votes := make([]commitVote, len(commit.Signatures))
+	for i, sig := range commit.Signatures {
+		votes[i] = commitVote{flag: sig.BlockIDFlag, address: sig.ValidatorAddress.String()}
+	}
+	return votes
+}
+
+// newCommitInfo counts the votes of a last commit. Signed power is left to
+// commitValidators, which knows the voting power
+func newCommitInfo(round int32, votes []commitVote) *types.CommitInfo {
+	info := &types.CommitInfo{Round: round}
+	for _, vote := range votes {
+		switch vote.flag {
+		case tmtypes.BlockIDFlagCommit:
+			info.Signatures++
+		case tmtypes.BlockIDFlagNil:
+			info.Nil++
+		default:
+			info.Absent++
+		}
+	}
+	return info
+}
+
+// commitValidators resolves the validator sets that signed commits, so the
+// fraction of voting power behind each commit can be computed. A set is
+// fetched once and reused for every commit whose signers match it in order,
+// so a change of voting power that keeps the order of the validators is
+// only picked up once the set changes otherwise. When a set cannot be
+// fetched, signed power is left unknown from then on instead of failing blocks
+type commitValidators struct {
+	fetch func(ctx context.Context, height int64) ([]validatorPower, error)
+	logf  func(format string, args ...any)
+
+	mu     sync.Mutex
+	sets   [][]validatorPower // most recently used first
+	failed bool
+}
+
+// newCommitValidators creates a resolver fetching validator sets with fetch
+func newCommitValidators(config *types.ChainConfig, fetch func(ctx context.Context, height int64) ([]validatorPower, error)) *commitValidators {
+	return &commitValidators{fetch: fetch, logf: config.Logf}
+}
+
+// record sets the last commit of block from the votes cast at height in round
+func (v *commitValidators) record(ctx context.Context, block *types.BlockInfo, height int64, round int32, votes []commitVote) {
+	block.Commit = newCommitInfo(round, votes)
+	v.apply(ctx, block.Commit, height, votes)
+}
+
+// apply sets the signed power of info from the validators that voted in the
+// commit of height
+func (v *commitValidators) apply(ctx context.Context, info *types.CommitInfo, height int64, votes []commitVote) {
+	if len(votes) == 0 {
+		return
+	}
+
+	set := v.setFor(ctx, height, votes)
+	if set == nil {
+		return
+	}
+
+	var signed, total int64
+	for i, val := range set {
+		total += val.power
+		if votes[i].flag == tmtypes.BlockIDFlagCommit {
+			signed += val.power
+		}
+	}
+	if total > 0 {
+		info.SignedPower = float64(signed) / float64(total)
+	}
+}
+
+// setFor returns the validator set that cast votes at height, or nil when it is unknown
+func (v *commitValidators) setFor(ctx context.Context, height int64, votes []commitVote) []validatorPower {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for i, set := range v.sets {
+		if matchesVotes(set, votes) {
+			copy(v.sets[1:i+1], v.sets[:i])
+			v.sets[0] = set
+			return set
+		}
+	}
+	if v.failed {
+		return nil
+	}
+
+	set, err := v.fetch(ctx, height)
+	if err != nil {
+		// A cancelled request says nothing about the node
+		if ctx.Err() == nil {
+			v.failed = true
+			if v.logf != nil {
+				v.logf("signed voting power unknown: failed to get the validators of height %d: %v", height, err)
+			}
+		}
+		return nil
+	}
+	if !matchesVotes(set, votes) {
+		return nil
+	}
+
+	v.sets = append([][]validatorPower{set}, v.sets...)
+	if len(v.sets) > maxCachedValidatorSets {
+		v.sets = v.sets[:maxCachedValidatorSets]
+	}
+	return set
+}
+
+// matchesVotes reports whether set is the validator set that cast votes,
+// by the addresses of the validators that voted
+func matchesVotes(set []validatorPower, votes []commitVote) bool {
+	if len(set) != len(votes) {
+		return false
+	}
+	for i, vote := range votes {
+		if vote.address != "" && vote.address != set[i].address {
+			return false
+		}
+	}
+	return true
+}
+
+// validatorPowers converts a CometBFT validator set
+func validatorPowers(vals []*tmtypes.Validator) []validatorPower {
+	set := make([]validatorPower, len(vals))
+	for i, val := range vals {
+		set[i] = validatorPower{address: val.Address.String(), power: val.VotingPower}
+	}
+	return set
+}
@@ -0,0 +1,118 @@
+package client
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/cometbft/cometbft/crypto/tmhash"
+	tmproto "github.com/cometbft/cometbft/proto/tendermint/types"
+	tmtypes "github.com/cometbft/cometbft/types"
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+// testValidators is a set of 150 validators of power 150 down to 1, more
+// than a node returns in one page
+func testValidators() []validatorPower {
+	set := make([]validatorPower, 150)
+	for i := range set {
+		set[i] = validatorPower{
+			address: tmtypes.Address(tmhash.SumTruncated([]byte{byte(i)})).String(),
+			power:   int64(150 - i),
+		}
+	}
+	return set
+}
+
+// testCommit is a commit of testValidators in round 1. Of every 10
+// validators, the ninth voted nil and the tenth is absent
+func testCommit(height int64) *tmproto.Commit {
+	commit := &tmproto.Commit{Height: height, Round: 1}
+	for i, val := range testValidators() {
+		sig := tmproto.CommitSig{BlockIdFlag: tmproto.BlockIDFlagCommit}
+		switch i % 10 {
+		case 8:
+			sig.BlockIdFlag = tmproto.BlockIDFlagNil
+		case 9:
+			sig.BlockIdFlag = tmproto.BlockIDFlagAbsent
+		}
+		if sig.BlockIdFlag != tmproto.BlockIDFlagAbsent {
+			sig.ValidatorAddress, _ = hex.DecodeString(val.address)
+		}
+		commit.Signatures = append(commit.Signatures, sig)
+	}
+	return commit
+}
+
+// testCommitInfo is the commit info of testCommit: the nil voters hold 1080
+// and the absent validators 1065 of the total power of 11325
+var testCommitInfo = types.CommitInfo{Round: 1, Signatures: 120, Absent: 15, Nil: 15, SignedPower: 9180.0 / 11325}
+
+func TestNewCommitInfo(t *testing.T) {
+	commit := testCommit(10)
+	if got := newCommitInfo(commit.Round, votesFromProto(commit)); *got != (types.CommitInfo{Round: 1, Signatures: 120, Absent: 15, Nil: 15}) {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestCommitValidators(t *testing.T) {
+	setA := testValidators()
+	setB := append([]validatorPower{setA[1], setA[0]}, setA[2:]...) // first two validators swapped
+
+	var fetches []int64
+	var logs []string
+	var fetchErr error
+	v := newCommitValidators(&types.ChainConfig{Logf: func(format string, args ...any) {
+		logs = append(logs, fmt.Sprintf(format, args...))
+	}}, func(ctx context.Context, height int64) ([]validatorPower, error) {
+		fetches = append(fetches, height)
+		if fetchErr != nil {
+			return nil, fetchErr
+		}
+		if height > 100 {
+			return setB, nil
+		}
+		return setA, nil
+	})
+
+	votesA := votesFromProto(testCommit(10))
+	votesB := append([]commitVote{votesA[1], votesA[0]}, votesA[2:]...)
+
+	tests := []struct {
+		name        string
+		height      int64
+		votes       []commitVote
+		fetchErr    error
+		wantFetches []int64
+		wantPower   float64
+	}{
+		{"first commit fetches its set", 10, votesA, nil, []int64{10}, testCommitInfo.SignedPower},
+		{"same signers reuse the set", 20, votesA, nil, nil, testCommitInfo.SignedPower},
+		{"other signers fetch again", 150, votesB, nil, []int64{150}, testCommitInfo.SignedPower},
+		{"earlier set is still cached", 30, votesA, nil, nil, testCommitInfo.SignedPower},
+		{"set not matching the votes is rejected", 40, votesA[1:], nil, []int64{40}, 0},
+		{"failed fetch leaves power unknown", 50, votesA[2:], errors.New("node down"), []int64{50}, 0},
+		{"no fetches after a failure", 60, votesA[3:], nil, nil, 0},
+		{"cached sets still apply after a failure", 70, votesB, nil, nil, testCommitInfo.SignedPower},
+	}
+
+	for _, tt := range tests {
+		fetches, fetchErr = nil, tt.fetchErr
+		info := newCommitInfo(1, tt.votes)
+		v.apply(context.Background(), info, tt.height, tt.votes)
+
+		if fmt.Sprint(fetches) != fmt.Sprint(tt.wantFetches) {
+			t.Errorf("%s: got fetches %v, want %v", tt.name, fetches, tt.wantFetches)
+		}
+		if info.SignedPower != tt.wantPower {
+			t.Errorf("%s: got signed power %v, want %v", tt.name, info.SignedPower, tt.wantPower)
+		}
+	}
+
+	if len(logs) != 1 || !strings.Contains(logs[0], "failed to get the validators of height 50: node down") {
+		t.Errorf("got logs %q", logs)
+	}
+}
@@ -0,0 +1,383 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+// evmBatchSize is the number of blocks requested per JSON-RPC batch, well
+// below the batch limits of common nodes and providers
+const evmBatchSize = 50
+
+// evmRequest is a JSON-RPC 2.0 request
+type evmRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      int    `json:"id"`
+	Method  string `json:"method"`
+	Params  []any  `json:"params"`
+}
+
+// evmResponse is a JSON-RPC 2.0 response
+type evmResponse struct {
+	ID     int             `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *evmError       `json:"error"`
+}
+
+// evmError is a JSON-RPC 2.0 error object
+type evmError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *evmError) Error() string {
+	return fmt.Sprintf("JSON-RPC error %d: %s", e.Code, e.Message)
+}
+
+// evmBlock is the part of an eth_getBlockByNumber result this tool uses
+type evmBlock struct {
+	Number       string            `json:"number"`
+	Hash         string            `json:"hash"`
+	ParentHash   string            `json:"parentHash"`
+	Timestamp    string            `json:"timestamp"`
+	Miner        string            `json:"miner"`
+	Transactions []json.RawMessage `json:"transactions"`
+}
+
+// EVMClient implements BlockchainClient over the Ethereum JSON-RPC API of EVM
+// chains and Cosmos EVM (Ethermint) chains. Block timestamps have second
+// granularity, so block times are whole seconds and may be zero
+type EVMClient struct {
+	config *types.ChainConfig
+	url    string
+	http   *http.Client
+	retry  *retrier
+}
+
+// NewEVMClient creates a new EVM JSON-RPC blockchain client
+func NewEVMClient(config *types.ChainConfig) (*EVMClient, error) {
+	if config.EVMEndpoint == "" {
+		return nil, fmt.Errorf("EVM JSON-RPC endpoint is required")
+	}
+
+	applyDefaults(config)
+
+	url := config.EVMEndpoint
+	if !strings.Contains(url, "://") {
+		url = "http://" + url
+	}
+
+	return &EVMClient{
+		config: config,
+		url:    url,
+		http:   &http.Client{},
+		retry:  newRetrier(config, url),
+	}, nil
+}
+
+// GetLatestBlockHeight gets the latest block number
+func (c *EVMClient) GetLatestBlockHeight(ctx context.Context) (int64, error) {
+	results, err := c.call(ctx, []evmRequest{newEVMRequest("eth_blockNumber")})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get latest block number: %w", err)
+	}
+
+	return decodeQuantity(results[0])
+}
+
+// GetStatus gets the chain ID, latest height and sync state of the node. The
+// chain ID is the decimal EIP-155 chain ID, and the earliest available height
+// is not reported, so EarliestHeight is left unknown
+func (c *EVMClient) GetStatus(ctx context.Context) (*types.NodeStatus, error) {
+	results, err := c.call(ctx, []evmRequest{
+		newEVMRequest("eth_chainId"),
+		newEVMRequest("eth_blockNumber"),
+		newEVMRequest("eth_syncing"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get status: %w", err)
+	}
+
+	chainID, err := decodeQuantity(results[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid chain ID: %w", err)
+	}
+
+	latestHeight, err := decodeQuantity(results[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid block number: %w", err)
+	}
+
+	// eth_syncing returns false, or an object describing the sync progress
+	catchingUp := strings.TrimSpace(string(results[2])) != "false"
+
+	return &types.NodeStatus{
+		ChainID:      strconv.FormatInt(chainID, 10),
+		LatestHeight: latestHeight,
+		CatchingUp:   catchingUp,
+	}, nil
+}
+
+// GetBlockByHeight gets block information by height
+func (c *EVMClient) GetBlockByHeight(ctx context.Context, height int64) (*types.BlockInfo, error) {
+	blocks, err := c.getBlocks(ctx, height, height)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get block at height %d: %w", height, err)
+	}
+
+	return blocks[0], nil
+}
+
+// GetBlockRange gets a range of blocks, fetching evmBatchSize blocks per
+// batch request. The first failed batch cancels the batches in flight and
+// stops further ones from starting
+func (c *EVMClient) GetBlockRange(ctx context.Context, startHeight, endHeight int64) ([]*types.BlockInfo, error) {
+	if startHeight > endHeight {
+		return nil, fmt.Errorf("invalid range: start height %d > end height %d", startHeight, endHeight)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	blocks := make([]*types.BlockInfo, endHeight-startHeight+1)
+
+	// Fetch batches in parallel, the limiter adapts how many run at once
+	maxConcurrent := c.config.MaxConcurrency
+	semaphore := make(chan struct{}, maxConcurrent)
+	errChan := make(chan error, 1)
+
+	for batchStart := startHeight; batchStart <= endHeight && ctx.Err() == nil; batchStart += evmBatchSize {
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+			continue
+		}
+
+		batchEnd := batchStart + evmBatchSize - 1
+		if batchEnd > endHeight {
+			batchEnd = endHeight
+		}
+
+		go func(minHeight, maxHeight int64) {
+			defer func() { <-semaphore }()
+
+			batch, err := c.getBlocks(ctx, minHeight, maxHeight)
+			if err != nil {
+				select {
+				case errChan <- fmt.Errorf("failed to get blocks %d-%d: %w", minHeight, maxHeight, err):
+					cancel()
+				default:
+				}
+				return
+			}
+
+			// Each batch writes a disjoint part of the slice
+			copy(blocks[minHeight-startHeight:], batch)
+		}(batchStart, batchEnd)
+	}
+
+	// Wait for all goroutines to complete
+	for i := 0; i < maxConcurrent; i++ {
+		semaphore <- struct{}{}
+	}
+
+	close(errChan)
+
+	// Check for errors, a failed batch wins over the cancellation it caused
+	if err := <-errChan; err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	FillBlockTimes(blocks)
+	return blocks, nil
+}
+
+// Stats returns the request and retry counters of the client
+func (c *EVMClient) Stats() Stats {
+	return c.retry.stats()
+}
+
+// Close closes the client
+func (c *EVMClient) Close() error {
+	c.http.CloseIdleConnections()
+	return nil
+}
+
+// getBlocks fetches the blocks minHeight..maxHeight with one batch request
+func (c *EVMClient) getBlocks(ctx context.Context, minHeight, maxHeight int64) ([]*types.BlockInfo, error) {
+	requests := make([]evmRequest, 0, maxHeight-minHeight+1)
+	for height := minHeight; height <= maxHeight; height++ {
+		// false returns transaction hashes only, which is all the count needs
+		requests = append(requests, newEVMRequest("eth_getBlockByNumber", "0x"+strconv.FormatInt(height, 16), false))
+	}
+
+	results, err := c.call(ctx, requests)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks := make([]*types.BlockInfo, len(results))
+	for i, result := range results {
+		height := minHeight + int64(i)
+
+		var block *evmBlock
+		if err := json.Unmarshal(result, &block); err != nil {
+			return nil, fmt.Errorf("invalid block %d: %w", height, err)
+		}
+		if block == nil {
+			return nil, fmt.Errorf("node did not return block %d", height)
+		}
+
+		blocks[i], err = blockInfoFromEVM(block)
+		if err != nil {
+			return nil, err
+		}
+		if blocks[i].Height != height {
+			return nil, fmt.Errorf("node returned block %d for height %d", blocks[i].Height, height)
+		}
+	}
+
+	return blocks, nil
+}
+
+// call sends the requests as one JSON-RPC batch with retries and returns the
+// results in request order. Any failed request fails the whole batch
+func (c *EVMClient) call(ctx context.Context, requests []evmRequest) ([]json.RawMessage, error) {
+	for i := range requests {
+		requests[i].ID = i
+	}
+
+	body, err := json.Marshal(requests)
+	if err != nil {
+		return nil, err
+	}
+
+	var responses []evmResponse
+	err = c.retry.do(ctx, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			if len(data) > maxRESTErrorBody {
+				data = data[:maxRESTErrorBody]
+			}
+			return &httpStatusError{Code: resp.StatusCode, Body: strings.TrimSpace(string(data))}
+		}
+
+		// Nodes that reject a batch as a whole answer with a single response
+		if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+			var single evmResponse
+			if err := json.Unmarshal(trimmed, &single); err != nil {
+				return fmt.Errorf("failed to decode response: %w", err)
+			}
+			if single.Error != nil {
+				return single.Error
+			}
+			return fmt.Errorf("expected a batch response")
+		}
+
+		responses = nil
+		if err := json.Unmarshal(data, &responses); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Responses of a batch may come in any order
+	results := make([]json.RawMessage, len(requests))
+	for _, resp := range responses {
+		if resp.ID < 0 || resp.ID >= len(requests) {
+			continue
+		}
+		if resp.Error != nil {
+			return nil, fmt.Errorf("%s: %w", requests[resp.ID].Method, resp.Error)
+		}
+		results[resp.ID] = resp.Result
+	}
+
+	for i, result := range results {
+		if result == nil {
+			return nil, fmt.Errorf("no response to %s", requests[i].Method)
+		}
+	}
+
+	return results, nil
+}
+
+func newEVMRequest(method string, params ...any) evmRequest {
+	if params == nil {
+		params = []any{}
+	}
+	return evmRequest{JSONRPC: "2.0", Method: method, Params: params}
+}
+
+// blockInfoFromEVM converts a JSON-RPC block into BlockInfo. Hashes and the
+// miner address keep the 0x-prefixed form EVM tooling uses
+func blockInfoFromEVM(block *evmBlock) (*types.BlockInfo, error) {
+	height, err := parseQuantity(block.Number)
+	if err != nil {
+		return nil, fmt.Errorf("invalid block number %q: %w", block.Number, err)
+	}
+
+	timestamp, err := parseQuantity(block.Timestamp)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp of block %d: %w", height, err)
+	}
+
+	return &types.BlockInfo{
+		Height:     height,
+		Time:       time.Unix(timestamp, 0).UTC(),
+		Hash:       block.Hash,
+		ParentHash: block.ParentHash,
+		Proposer:   block.Miner,
+		TxCount:    len(block.Transactions),
+	}, nil
+}
+
+// decodeQuantity decodes a JSON-RPC quantity result
+func decodeQuantity(raw json.RawMessage) (int64, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return 0, fmt.Errorf("expected a hex quantity, got %s", raw)
+	}
+
+	return parseQuantity(s)
+}
+
+// parseQuantity parses a JSON-RPC quantity, a 0x-prefixed hex number
+func parseQuantity(s string) (int64, error) {
+	if !strings.HasPrefix(s, "0x") {
+		return 0, fmt.Errorf("expected a hex quantity, got %q", s)
+	}
+
+	return strconv.ParseInt(s[2:], 16, 64)
+}
@@ -0,0 +1,277 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+// evmServer is an Ethereum JSON-RPC stand-in serving a chain of n blocks with
+// whole-second timestamps
+type evmServer struct {
+	*httptest.Server
+
+	latest int64
+	timeOf func(height int64) int64 // unix timestamp of a block
+
+	mu          sync.Mutex
+	batches     int
+	reverse     bool          // answer batches in reverse order
+	rejectBatch string        // answer every batch with this single error object
+	nullAt      int64         // height answered with a null block
+	delay       time.Duration // added to every batch
+}
+
+func newEVMServer(t *testing.T, latest int64) *evmServer {
+	s := &evmServer{
+		latest: latest,
+		// Alternating 1 and 2 second blocks
+		timeOf: func(height int64) int64 { return 1700000000 + height + height/2 },
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *evmServer) handle(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var requests []evmRequest
+	if err := json.Unmarshal(data, &requests); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.batches++
+	reverse, rejectBatch, nullAt, delay := s.reverse, s.rejectBatch, s.nullAt, s.delay
+	s.mu.Unlock()
+
+	select {
+	case <-time.After(delay):
+	case <-r.Context().Done():
+		return
+	}
+
+	if rejectBatch != "" {
+		json.NewEncoder(w).Encode(map[string]any{
+			"jsonrpc": "2.0",
+			"id":      nil,
+			"error":   map[string]any{"code": -32600, "message": rejectBatch},
+		})
+		return
+	}
+
+	responses := make([]map[string]any, 0, len(requests))
+	for _, req := range requests {
+		resp := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+		switch req.Method {
+		case "eth_chainId":
+			resp["result"] = "0x2328"
+		case "eth_blockNumber":
+			resp["result"] = "0x" + strconv.FormatInt(s.latest, 16)
+		case "eth_syncing":
+			resp["result"] = false
+		case "eth_getBlockByNumber":
+			height, _ := parseQuantity(req.Params[0].(string))
+			switch {
+			case height == nullAt, height > s.latest:
+				resp["result"] = nil
+			default:
+				resp["result"] = s.block(height)
+			}
+		default:
+			resp["error"] = map[string]any{"code": -32601, "message": "method not found"}
+		}
+		responses = append(responses, resp)
+	}
+
+	if reverse {
+		slices.Reverse(responses)
+	}
+	json.NewEncoder(w).Encode(responses)
+}
+
+func (s *evmServer) block(height int64) map[string]any {
+	transactions := make([]string, height%3)
+	for i := range transactions {
+		transactions[i] = fmt.Sprintf("0x%064x", height*10+int64(i))
+	}
+	return map[string]any{
+		"number":       "0x" + strconv.FormatInt(height, 16),
+		"hash":         evmHash(height),
+		"parentHash":   evmHash(height - 1),
+		"timestamp":    "0x" + strconv.FormatInt(s.timeOf(height), 16),
+		"miner":        fmt.Sprintf("0x%040x", height%4),
+		"transactions": transactions,
+	}
+}
+
+func (s *evmServer) batchCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.batches
+}
+
+func evmHash(height int64) string {
+	return fmt.Sprintf("0x%064x", height+0xb10c)
+}
+
+func newTestEVMClient(t *testing.T, url string) *EVMClient {
+	c, err := NewEVMClient(&types.ChainConfig{
+		EVMEndpoint:    url,
+		Timeout:        5 * time.Second,
+		MaxRetries:     2,
+		RetryDelay:     time.Millisecond,
+		MaxConcurrency: 4,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestEVMClientGetStatus(t *testing.T) {
+	server := newEVMServer(t, 120)
+	c := newTestEVMClient(t, server.URL)
+
+	status, err := c.GetStatus(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.ChainID != "9000" || status.LatestHeight != 120 || status.CatchingUp || status.EarliestHeight != 0 {
+		t.Errorf("got status %+v", status)
+	}
+	if server.batchCount() != 1 {
+		t.Errorf("got %d requests, want the status in one batch", server.batchCount())
+	}
+}
+
+func TestEVMClientGetBlockRange(t *testing.T) {
+	for _, reverse := range []bool{false, true} {
+		t.Run("reverse="+strconv.FormatBool(reverse), func(t *testing.T) {
+			server := newEVMServer(t, 120)
+			server.reverse = reverse
+			c := newTestEVMClient(t, server.URL)
+
+			blocks, err := c.GetBlockRange(context.Background(), 3, 112)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(blocks) != 110 {
+				t.Fatalf("got %d blocks, want 110", len(blocks))
+			}
+			if server.batchCount() != 3 {
+				t.Errorf("got %d batches, want 3 of up to %d blocks", server.batchCount(), evmBatchSize)
+			}
+
+			for i, block := range blocks {
+				height := 3 + int64(i)
+				if block.Height != height || block.Hash != evmHash(height) || block.TxCount != int(height%3) {
+					t.Fatalf("got block %d with hash %s and %d txs at index %d", block.Height, block.Hash, block.TxCount, i)
+				}
+				if !block.Time.Equal(time.Unix(server.timeOf(height), 0)) || block.Proposer != fmt.Sprintf("0x%040x", height%4) {
+					t.Errorf("got block %d at %s proposed by %s", height, block.Time, block.Proposer)
+				}
+			}
+			if err := VerifyLinkage(blocks); err != nil {
+				t.Errorf("fetched blocks do not link: %v", err)
+			}
+		})
+	}
+}
+
+func TestEVMClientErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(s *evmServer)
+		wantErr string
+	}{
+		{
+			name:    "batch rejected",
+			setup:   func(s *evmServer) { s.rejectBatch = "batch too large" },
+			wantErr: "JSON-RPC error -32600: batch too large",
+		},
+		{
+			name:    "null block",
+			setup:   func(s *evmServer) { s.nullAt = 40 },
+			wantErr: "node did not return block 40",
+		},
+		{
+			name:    "above the tip",
+			setup:   func(s *evmServer) { s.latest = 45 },
+			wantErr: "node did not return block 46",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newEVMServer(t, 120)
+			tt.setup(server)
+			c := newTestEVMClient(t, server.URL)
+
+			_, err := c.GetBlockRange(context.Background(), 1, 50)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+			// JSON-RPC errors are answers, not transient failures
+			if server.batchCount() != 1 {
+				t.Errorf("got %d requests, want no retries", server.batchCount())
+			}
+		})
+	}
+}
+
+func TestEVMClientGetBlockRangeStopsOnError(t *testing.T) {
+	server := newEVMServer(t, 10000)
+	server.nullAt = 60
+	server.delay = 5 * time.Millisecond
+	c := newTestEVMClient(t, server.URL)
+
+	_, err := c.GetBlockRange(context.Background(), 1, 10000)
+	if err == nil || !strings.Contains(err.Error(), "node did not return block 60") {
+		t.Fatalf("got error %v, want the null block 60", err)
+	}
+
+	// Batches in flight are cancelled and no new ones start
+	if batches := server.batchCount(); batches > 10 {
+		t.Errorf("%d batches were requested for a range failing in its second batch", batches)
+	}
+}
+
+func TestEVMClientGetBlockRangeCancel(t *testing.T) {
+	server := newEVMServer(t, 10000)
+	server.delay = 20 * time.Millisecond
+	c := newTestEVMClient(t, server.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := c.GetBlockRange(ctx, 1, 10000)
+	if err == nil {
+		t.Fatal("expected an error after the caller's deadline")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("range took %s after the deadline passed", elapsed)
+	}
+	if batches := server.batchCount(); batches > 20 {
+		t.Errorf("%d batches were requested before the deadline", batches)
+	}
+}
@@ -0,0 +1,286 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+// maxJSONLLine is the longest line read from a JSONL blocks file
+const maxJSONLLine = 1 << 20
+
+// csvColumns parses the CSV columns of an export into a block, by column name
+var csvColumns = map[string]func(block *types.BlockInfo, value string) error{
+	"height": func(block *types.BlockInfo, value string) (err error) {
+		block.Height, err = strconv.ParseInt(value, 10, 64)
+		return err
+	},
+	"time": func(block *types.BlockInfo, value string) (err error) {
+		block.Time, err = time.Parse(time.RFC3339Nano, value)
+		return err
+	},
+	"hash":        func(block *types.BlockInfo, value string) error { block.Hash = value; return nil },
+	"parent_hash": func(block *types.BlockInfo, value string) error { block.ParentHash = value; return nil },
+	"proposer":    func(block *types.BlockInfo, value string) error { block.Proposer = value; return nil },
+	"tx_count": func(block *types.BlockInfo, value string) (err error) {
+		block.TxCount, err = strconv.Atoi(value)
+		return err
+	},
+	"commit_round": commitColumn(func(commit *types.CommitInfo, value string) error {
+		round, err := strconv.ParseInt(value, 10, 32)
+		commit.Round = int32(round)
+		return err
+	}),
+	"commit_signatures": commitColumn(func(commit *types.CommitInfo, value string) (err error) {
+		commit.Signatures, err = strconv.Atoi(value)
+		return err
+	}),
+	"commit_absent": commitColumn(func(commit *types.CommitInfo, value string) (err error) {
+		commit.Absent, err = strconv.Atoi(value)
+		return err
+	}),
+	"commit_nil": commitColumn(func(commit *types.CommitInfo, value string) (err error) {
+		commit.Nil, err = strconv.Atoi(value)
+		return err
+	}),
+	"commit_signed_power": commitColumn(func(commit *types.CommitInfo, value string) (err error) {
+		commit.SignedPower, err = strconv.ParseFloat(value, 64)
+		return err
+	}),
+	"gas_used": loadColumn(func(load *types.LoadInfo, value string) (err error) {
+		load.GasUsed, err = strconv.ParseInt(value, 10, 64)
+		return err
+	}),
+	"gas_wanted": loadColumn(func(load *types.LoadInfo, value string) (err error) {
+		load.GasWanted, err = strconv.ParseInt(value, 10, 64)
+		return err
+	}),
+	"events": loadColumn(func(load *types.LoadInfo, value string) (err error) {
+		load.Events, err = strconv.Atoi(value)
+		return err
+	}),
+	"size": loadColumn(func(load *types.LoadInfo, value string) (err error) {
+		load.Size, err = strconv.Atoi(value)
+		return err
+	}),
+}
+
+// commitColumn parses a column of the last commit, which is empty for blocks
+// exported without it
+func commitColumn(parse func(commit *types.CommitInfo, value string) error) func(*types.BlockInfo, string) error {
+	return func(block *types.BlockInfo, value string) error {
+		if value == "" {
+			return nil
+		}
+		if block.Commit == nil {
+			block.Commit = &types.CommitInfo{}
+		}
+		return parse(block.Commit, value)
+	}
+}
+
+// loadColumn parses a column of the block load, which is empty for blocks
+// exported without it
+func loadColumn(parse func(load *types.LoadInfo, value string) error) func(*types.BlockInfo, string) error {
+	return func(block *types.BlockInfo, value string) error {
+		if value == "" {
+			return nil
+		}
+		if block.Load == nil {
+			block.Load = &types.LoadInfo{}
+		}
+		return parse(block.Load, value)
+	}
+}
+
+// FileClient implements BlockchainClient over a JSONL or CSV file of blocks
+// as written by export, so analyses can be reproduced without a node. Block
+// times are computed from the block timestamps like for any other client,
+// and the verified flag of the file is not trusted: replayed headers are
+// never verified.
+type FileClient struct {
+	path    string
+	chainID string
+	blocks  []*types.BlockInfo // ordered by height
+}
+
+// NewFileClient loads the blocks in path, which are assumed to belong to
+// chainID as the file does not record its chain. CSV files are recognized
+// by their extension
+func NewFileClient(path, chainID string) (*FileClient, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open blocks file: %w", err)
+	}
+	defer file.Close()
+
+	var blocks []*types.BlockInfo
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		blocks, err = readCSVBlocks(file)
+	case ".parquet":
+		return nil, fmt.Errorf("parquet files cannot be replayed, export the blocks as jsonl or csv")
+	default:
+		blocks, err = readJSONLBlocks(file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("%s holds no blocks", path)
+	}
+
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].Height < blocks[j].Height })
+	for i, block := range blocks {
+		block.Verified = false
+		if i > 0 && block.Height == blocks[i-1].Height {
+			return nil, fmt.Errorf("%s holds block %d twice", path, block.Height)
+		}
+	}
+
+	return &FileClient{path: path, chainID: chainID, blocks: blocks}, nil
+}
+
+// GetLatestBlockHeight gets the highest height in the file
+func (c *FileClient) GetLatestBlockHeight(ctx context.Context) (int64, error) {
+	return c.blocks[len(c.blocks)-1].Height, nil
+}
+
+// GetStatus gets the height window of the file
+func (c *FileClient) GetStatus(ctx context.Context) (*types.NodeStatus, error) {
+	return &types.NodeStatus{
+		ChainID:        c.chainID,
+		LatestHeight:   c.blocks[len(c.blocks)-1].Height,
+		EarliestHeight: c.blocks[0].Height,
+	}, nil
+}
+
+// GetBlockByHeight gets block information by height
+func (c *FileClient) GetBlockByHeight(ctx context.Context, height int64) (*types.BlockInfo, error) {
+	block := c.find(height)
+	if block == nil {
+		return nil, fmt.Errorf("block %d is not in %s", height, c.path)
+	}
+
+	copied := *block
+	copied.BlockTime = 0
+	return &copied, nil
+}
+
+// GetBlockRange gets a range of blocks. Heights missing from the file fail
+// the range like a node failing to serve them
+func (c *FileClient) GetBlockRange(ctx context.Context, startHeight, endHeight int64) ([]*types.BlockInfo, error) {
+	if startHeight > endHeight {
+		return nil, fmt.Errorf("invalid range: start height %d > end height %d", startHeight, endHeight)
+	}
+
+	blocks := make([]*types.BlockInfo, 0, endHeight-startHeight+1)
+	for height := startHeight; height <= endHeight; height++ {
+		block, err := c.GetBlockByHeight(ctx, height)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+	}
+
+	FillBlockTimes(blocks)
+	return blocks, nil
+}
+
+// Close releases nothing, the file is read when the client is created
+func (c *FileClient) Close() error {
+	return nil
+}
+
+// find returns the block at height, or nil when the file does not hold it
+func (c *FileClient) find(height int64) *types.BlockInfo {
+	i := sort.Search(len(c.blocks), func(i int) bool { return c.blocks[i].Height >= height })
+	if i == len(c.blocks) || c.blocks[i].Height != height {
+		return nil
+	}
+	return c.blocks[i]
+}
+
+// readJSONLBlocks reads one block per line, skipping blank lines
+func readJSONLBlocks(r io.Reader) ([]*types.BlockInfo, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxJSONLLine)
+
+	var blocks []*types.BlockInfo
+	for line := 1; scanner.Scan(); line++ {
+		data := strings.TrimSpace(scanner.Text())
+		if data == "" {
+			continue
+		}
+
+		var block types.BlockInfo
+		if err := json.Unmarshal([]byte(data), &block); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		blocks = append(blocks, &block)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+// readCSVBlocks reads a CSV file with a header row. Columns are matched by
+// name, unknown ones are ignored, and height and time are required
+func readCSVBlocks(r io.Reader) ([]*types.BlockInfo, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, required := range []string{"height", "time"} {
+		if !slices.Contains(header, required) {
+			return nil, fmt.Errorf("missing %s column", required)
+		}
+	}
+
+	var blocks []*types.BlockInfo
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		block := &types.BlockInfo{}
+		for i, value := range record {
+			if i >= len(header) {
+				break
+			}
+			parse, ok := csvColumns[header[i]]
+			if !ok {
+				continue
+			}
+			if err := parse(block, value); err != nil {
+				return nil, fmt.Errorf("row %d: invalid %s %q: %w", row, header[i], value, err)
+			}
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
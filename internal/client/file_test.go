@@ -0,0 +1,120 @@
+package client
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeBlocksFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFileClientJSONL(t *testing.T) {
+	// Out of order, with a blank line, a missing height and a verified flag
+	path := writeBlocksFile(t, "blocks.jsonl", `{"height":12,"time":"2026-03-01T00:01:12Z","hash":"C","parent_hash":"B","proposer":"VAL2","tx_count":3,"block_time":99,"verified":true}
+{"height":10,"time":"2026-03-01T00:01:00Z","hash":"A","parent_hash":"9","proposer":"VAL0","tx_count":1}
+
+{"height":11,"time":"2026-03-01T00:01:06.5Z","hash":"B","parent_hash":"A","proposer":"VAL1","tx_count":2}
+{"height":14,"time":"2026-03-01T00:01:24Z","hash":"E","parent_hash":"D","proposer":"VAL0","tx_count":0}
+`)
+	c, err := NewFileClient(path, testChainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	status, err := c.GetStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.ChainID != testChainID || status.EarliestHeight != 10 || status.LatestHeight != 14 {
+		t.Errorf("got status %+v", status)
+	}
+
+	blocks, err := c.GetBlockRange(ctx, 10, 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantTimes := []float64{0, 6.5, 5.5}
+	for i, block := range blocks {
+		if block.Height != 10+int64(i) || block.BlockTime != wantTimes[i] || block.Verified {
+			t.Errorf("got block %d with block time %v, verified %v", block.Height, block.BlockTime, block.Verified)
+		}
+	}
+	if err := VerifyLinkage(blocks); err != nil {
+		t.Errorf("replayed blocks do not link: %v", err)
+	}
+
+	// A single block has no block before it in the response
+	block, err := c.GetBlockByHeight(ctx, 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.BlockTime != 0 || block.TxCount != 3 || !block.Time.Equal(time.Date(2026, 3, 1, 0, 1, 12, 0, time.UTC)) {
+		t.Errorf("got block %+v", block)
+	}
+
+	_, err = c.GetBlockRange(ctx, 12, 14)
+	if err == nil || !strings.Contains(err.Error(), "block 13 is not in "+path) {
+		t.Errorf("got error %v, want the missing height reported", err)
+	}
+}
+
+func TestFileClientCSV(t *testing.T) {
+	// Columns in another order, with one this version does not know
+	path := writeBlocksFile(t, "blocks.csv", `time,height,proposer,app_version,tx_count,hash,parent_hash
+2026-03-01T00:00:06Z,1,VAL1,100,4,A,
+2026-03-01T00:00:12.25Z,2,VAL2,200,5,B,A
+`)
+	c, err := NewFileClient(path, testChainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocks, err := c.GetBlockRange(context.Background(), 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blocks[1].Height != 2 || blocks[1].Proposer != "VAL2" || blocks[1].TxCount != 5 || blocks[1].BlockTime != 6.25 || blocks[1].ParentHash != "A" {
+		t.Errorf("got block %+v", blocks[1])
+	}
+}
+
+func TestNewFileClientErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		wantErr string
+	}{
+		{"empty", "blocks.jsonl", "\n", "holds no blocks"},
+		{"invalid line", "blocks.jsonl", `{"height":1,"time":"2026-03-01T00:00:00Z"}` + "\nnot json\n", "line 2:"},
+		{"duplicate height", "blocks.jsonl", `{"height":1,"time":"2026-03-01T00:00:00Z"}` + "\n" + `{"height":1,"time":"2026-03-01T00:00:06Z"}` + "\n", "holds block 1 twice"},
+		{"csv without time", "blocks.csv", "height,hash\n1,A\n", "missing time column"},
+		{"csv invalid height", "blocks.csv", "height,time\none,2026-03-01T00:00:00Z\n", `row 2: invalid height "one"`},
+		{"csv invalid commit round", "blocks.csv", "height,time,commit_round\n1,2026-03-01T00:00:00Z,late\n", `row 2: invalid commit_round "late"`},
+		{"csv invalid gas", "blocks.csv", "height,time,gas_used\n1,2026-03-01T00:00:00Z,1e6\n", `row 2: invalid gas_used "1e6"`},
+		{"parquet", "blocks.parquet", "PAR1", "parquet files cannot be replayed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewFileClient(writeBlocksFile(t, tt.file, tt.content), testChainID)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := NewFileClient(filepath.Join(t.TempDir(), "missing.jsonl"), testChainID); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
@@ -0,0 +1,373 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+
+	cmtbytes "github.com/cometbft/cometbft/libs/bytes"
+	tmproto "github.com/cometbft/cometbft/proto/tendermint/types"
+	tmtypes "github.com/cometbft/cometbft/types"
+	"github.com/cosmos/cosmos-sdk/client/grpc/cmtservice"
+	"github.com/cosmos/cosmos-sdk/types/bech32"
+	"github.com/cosmos/cosmos-sdk/types/query"
+	stakingtypes "github.com/cosmos/cosmos-sdk/x/staking/types"
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// gogoMessage is implemented by messages generated with gogoproto
+type gogoMessage interface {
+	Marshal() ([]byte, error)
+	Unmarshal([]byte) error
+}
+
+// gogoCodec encodes gRPC messages with the methods generated by gogoproto,
+// which the Cosmos SDK service types require
+type gogoCodec struct{}
+
+func (gogoCodec) Marshal(v any) ([]byte, error) {
+	msg, ok := v.(gogoMessage)
+	if !ok {
+		return nil, fmt.Errorf("cannot marshal %T: not a gogoproto message", v)
+	}
+	return msg.Marshal()
+}
+
+func (gogoCodec) Unmarshal(data []byte, v any) error {
+	msg, ok := v.(gogoMessage)
+	if !ok {
+		return fmt.Errorf("cannot unmarshal into %T: not a gogoproto message", v)
+	}
+	return msg.Unmarshal(data)
+}
+
+func (gogoCodec) Name() string {
+	return "proto"
+}
+
+// GRPCClient implements BlockchainClient over the Cosmos SDK
+// cosmos.base.tendermint.v1beta1.Service gRPC service
+type GRPCClient struct {
+	config  *types.ChainConfig
+	conn    *grpc.ClientConn
+	service cmtservice.ServiceClient
+	staking stakingtypes.QueryClient
+	retry   *retrier
+
+	validators *commitValidators // nil unless commits are recorded
+}
+
+// NewGRPCClient creates a new gRPC blockchain client. Endpoints given as
+// https:// or on port 443 use TLS, all others plaintext
+func NewGRPCClient(config *types.ChainConfig) (*GRPCClient, error) {
+	if config.GRPCEndpoint == "" {
+		return nil, fmt.Errorf("gRPC endpoint is required")
+	}
+
+	applyDefaults(config)
+
+	target, creds := grpcTarget(config.GRPCEndpoint)
+	conn, err := grpc.NewClient(target,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(gogoCodec{})),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gRPC client: %w", err)
+	}
+
+	c := &GRPCClient{
+		config:  config,
+		conn:    conn,
+		service: cmtservice.NewServiceClient(conn),
+		staking: stakingtypes.NewQueryClient(conn),
+		retry:   newRetrier(config, config.GRPCEndpoint),
+	}
+	if config.Commits {
+		c.validators = newCommitValidators(config, c.getValidators)
+	}
+	return c, nil
+}
+
+// grpcTarget splits an endpoint into a dial target and transport credentials
+func grpcTarget(endpoint string) (string, credentials.TransportCredentials) {
+	switch {
+	case strings.HasPrefix(endpoint, "https://"):
+		return strings.TrimPrefix(endpoint, "https://"), credentials.NewTLS(&tls.Config{})
+	case strings.HasPrefix(endpoint, "http://"):
+		return strings.TrimPrefix(endpoint, "http://"), insecure.NewCredentials()
+	}
+
+	if _, port, err := net.SplitHostPort(endpoint); err == nil && port == "443" {
+		return endpoint, credentials.NewTLS(&tls.Config{})
+	}
+	return endpoint, insecure.NewCredentials()
+}
+
+// GetLatestBlockHeight gets the latest block height
+func (c *GRPCClient) GetLatestBlockHeight(ctx context.Context) (int64, error) {
+	var resp *cmtservice.GetLatestBlockResponse
+	err := c.retry.do(ctx, func(ctx context.Context) (err error) {
+		resp, err = c.service.GetLatestBlock(ctx, &cmtservice.GetLatestBlockRequest{})
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get latest block: %w", err)
+	}
+
+	block, err := blockInfoFromGRPC(resp.BlockId, resp.Block, resp.SdkBlock)
+	if err != nil {
+		return 0, err
+	}
+
+	return block.Height, nil
+}
+
+// GetStatus gets the chain ID, latest height and sync state of the node. The
+// service does not report the earliest available height, so EarliestHeight is left unknown
+func (c *GRPCClient) GetStatus(ctx context.Context) (*types.NodeStatus, error) {
+	var resp *cmtservice.GetNodeInfoResponse
+	err := c.retry.do(ctx, func(ctx context.Context) (err error) {
+		resp, err = c.service.GetNodeInfo(ctx, &cmtservice.GetNodeInfoRequest{})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get node info: %w", err)
+	}
+	if resp.DefaultNodeInfo == nil {
+		return nil, fmt.Errorf("node info response without node info")
+	}
+
+	var syncing *cmtservice.GetSyncingResponse
+	err = c.retry.do(ctx, func(ctx context.Context) (err error) {
+		syncing, err = c.service.GetSyncing(ctx, &cmtservice.GetSyncingRequest{})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sync state: %w", err)
+	}
+
+	latestHeight, err := c.GetLatestBlockHeight(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.NodeStatus{
+		ChainID:      resp.DefaultNodeInfo.Network,
+		LatestHeight: latestHeight,
+		CatchingUp:   syncing.Syncing,
+	}, nil
+}
+
+// GetBlockByHeight gets block information by height
+func (c *GRPCClient) GetBlockByHeight(ctx context.Context, height int64) (*types.BlockInfo, error) {
+	var resp *cmtservice.GetBlockByHeightResponse
+	err := c.retry.do(ctx, func(ctx context.Context) (err error) {
+		resp, err = c.service.GetBlockByHeight(ctx, &cmtservice.GetBlockByHeightRequest{Height: height})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get block at height %d: %w", height, err)
+	}
+
+	block, err := blockInfoFromGRPC(resp.BlockId, resp.Block, resp.SdkBlock)
+	if err != nil {
+		return nil, err
+	}
+	if commit := lastCommitFromGRPC(resp.Block, resp.SdkBlock); c.config.Commits && commit != nil {
+		c.validators.record(ctx, block, commit.Height, commit.Round, votesFromProto(commit))
+	}
+	return block, nil
+}
+
+// GetBlockRange gets a range of blocks. The service has no batch call, so
+// blocks are fetched one by one with controlled concurrency
+func (c *GRPCClient) GetBlockRange(ctx context.Context, startHeight, endHeight int64) ([]*types.BlockInfo, error) {
+	return getBlockRangeByHeight(ctx, c, startHeight, endHeight, c.config.MaxConcurrency)
+}
+
+// getValidators fetches the validator set of height page by page
+func (c *GRPCClient) getValidators(ctx context.Context, height int64) ([]validatorPower, error) {
+	var set []validatorPower
+	for {
+		var resp *cmtservice.GetValidatorSetByHeightResponse
+		err := c.retry.do(ctx, func(ctx context.Context) (err error) {
+			resp, err = c.service.GetValidatorSetByHeight(ctx, &cmtservice.GetValidatorSetByHeightRequest{
+				Height:     height,
+				Pagination: &query.PageRequest{Offset: uint64(len(set)), Limit: maxValidatorsPerPage},
+			})
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, val := range resp.Validators {
+			_, address, err := bech32.DecodeAndConvert(val.Address)
+			if err != nil {
+				return nil, fmt.Errorf("invalid validator address %q: %w", val.Address, err)
+			}
+			set = append(set, validatorPower{address: cmtbytes.HexBytes(address).String(), power: val.VotingPower})
+		}
+		if len(resp.Validators) == 0 || resp.Pagination == nil || uint64(len(set)) >= resp.Pagination.Total {
+			return set, nil
+		}
+	}
+}
+
+// GetValidatorSet gets the validator set of height
+func (c *GRPCClient) GetValidatorSet(ctx context.Context, height int64) ([]types.ValidatorInfo, error) {
+	set, err := c.getValidators(ctx, height)
+	if err != nil {
+		return nil, err
+	}
+	return validatorInfos(set), nil
+}
+
+// GetStakingValidators queries the validators of the staking module
+func (c *GRPCClient) GetStakingValidators(ctx context.Context) ([]types.ValidatorInfo, error) {
+	return stakingValidators(ctx, func(ctx context.Context, req *stakingtypes.QueryValidatorsRequest) (resp *stakingtypes.QueryValidatorsResponse, err error) {
+		err = c.retry.do(ctx, func(ctx context.Context) (err error) {
+			resp, err = c.staking.Validators(ctx, req)
+			return err
+		})
+		return resp, err
+	})
+}
+
+// Stats returns the request and retry counters of the client
+func (c *GRPCClient) Stats() Stats {
+	return c.retry.stats()
+}
+
+// Close closes the client
+func (c *GRPCClient) Close() error {
+	return c.conn.Close()
+}
+
+// getBlockRangeByHeight fetches a range with one GetBlockByHeight call per
+// height, running up to maxConcurrent calls at once. The first failure
+// cancels the calls in flight and stops further ones from starting
+func getBlockRangeByHeight(ctx context.Context, c BlockchainClient, startHeight, endHeight int64, maxConcurrent int) ([]*types.BlockInfo, error) {
+	if startHeight > endHeight {
+		return nil, fmt.Errorf("invalid range: start height %d > end height %d", startHeight, endHeight)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	blocks := make([]*types.BlockInfo, endHeight-startHeight+1)
+
+	// Fetch blocks in parallel, the limiter adapts how many run at once
+	semaphore := make(chan struct{}, maxConcurrent)
+	errChan := make(chan error, 1)
+
+	for height := startHeight; height <= endHeight && ctx.Err() == nil; height++ {
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+			continue
+		}
+
+		go func(h int64) {
+			defer func() { <-semaphore }()
+
+			block, err := c.GetBlockByHeight(ctx, h)
+			if err != nil {
+				select {
+				case errChan <- err:
+					cancel()
+				default:
+				}
+				return
+			}
+
+			blocks[h-startHeight] = block
+		}(height)
+	}
+
+	// Wait for all goroutines to complete
+	for i := 0; i < maxConcurrent; i++ {
+		semaphore <- struct{}{}
+	}
+
+	close(errChan)
+
+	// Check for errors, a failed call wins over the cancellation it caused
+	if err := <-errChan; err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	FillBlockTimes(blocks)
+	return blocks, nil
+}
+
+// blockInfoFromGRPC converts a service block into BlockInfo. The CometBFT
+// block is preferred; nodes that only fill the SDK block report the proposer
+// as a bech32 consensus address, which is decoded to match the RPC client
+func blockInfoFromGRPC(blockID *tmproto.BlockID, block *tmproto.Block, sdkBlock *cmtservice.Block) (*types.BlockInfo, error) {
+	var hash string
+	if blockID != nil {
+		hash = cmtbytes.HexBytes(blockID.Hash).String()
+	}
+
+	if block != nil {
+		return &types.BlockInfo{
+			Height:     block.Header.Height,
+			Time:       block.Header.Time,
+			Hash:       hash,
+			ParentHash: cmtbytes.HexBytes(block.Header.LastBlockId.Hash).String(),
+			Proposer:   cmtbytes.HexBytes(block.Header.ProposerAddress).String(),
+			TxCount:    len(block.Data.Txs),
+		}, nil
+	}
+
+	if sdkBlock == nil {
+		return nil, fmt.Errorf("response without block")
+	}
+
+	proposer := sdkBlock.Header.ProposerAddress
+	if _, address, err := bech32.DecodeAndConvert(proposer); err == nil {
+		proposer = cmtbytes.HexBytes(address).String()
+	}
+
+	return &types.BlockInfo{
+		Height:     sdkBlock.Header.Height,
+		Time:       sdkBlock.Header.Time,
+		Hash:       hash,
+		ParentHash: cmtbytes.HexBytes(sdkBlock.Header.LastBlockId.Hash).String(),
+		Proposer:   proposer,
+		TxCount:    len(sdkBlock.Data.Txs),
+	}, nil
+}
+
+// lastCommitFromGRPC returns the last commit of a service block, nil when the
+// response carries none
+func lastCommitFromGRPC(block *tmproto.Block, sdkBlock *cmtservice.Block) *tmproto.Commit {
+	switch {
+	case block != nil:
+		return block.LastCommit
+	case sdkBlock != nil:
+		return sdkBlock.LastCommit
+	}
+	return nil
+}
+
+// votesFromProto lists the votes of a protobuf commit in validator set order
+func votesFromProto(commit *tmproto.Commit) []commitVote {
+	votes := make([]commitVote, len(commit.Signatures))
+	for i, sig := range commit.Signatures {
+		votes[i] = commitVote{
+			flag:    tmtypes.BlockIDFlag(sig.BlockIdFlag),
+			address: cmtbytes.HexBytes(sig.ValidatorAddress).String(),
+		}
+	}
+	return votes
+}
@@ -0,0 +1,376 @@
+package client
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	tmp2p "github.com/cometbft/cometbft/proto/tendermint/p2p"
+	tmproto "github.com/cometbft/cometbft/proto/tendermint/types"
+	tmtypes "github.com/cometbft/cometbft/types"
+	"github.com/cosmos/cosmos-sdk/client/grpc/cmtservice"
+	"github.com/cosmos/cosmos-sdk/types/bech32"
+	"github.com/cosmos/cosmos-sdk/types/query"
+	stakingtypes "github.com/cosmos/cosmos-sdk/x/staking/types"
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// cmtServer is an in-memory cosmos.base.tendermint.v1beta1.Service
+type cmtServer struct {
+	cmtservice.UnimplementedServiceServer
+
+	metas   []*tmtypes.BlockMeta
+	syncing bool
+	delay   time.Duration // added to every block call
+	commits bool          // blocks carry testCommit, signed by testValidators
+
+	mu         sync.Mutex
+	fail       map[int64]codes.Code // heights answered with an error
+	calls      atomic.Int64         // block calls served
+	validators atomic.Int64         // validator set calls served
+}
+
+func (s *cmtServer) GetNodeInfo(ctx context.Context, req *cmtservice.GetNodeInfoRequest) (*cmtservice.GetNodeInfoResponse, error) {
+	return &cmtservice.GetNodeInfoResponse{DefaultNodeInfo: &tmp2p.DefaultNodeInfo{Network: testChainID}}, nil
+}
+
+func (s *cmtServer) GetSyncing(ctx context.Context, req *cmtservice.GetSyncingRequest) (*cmtservice.GetSyncingResponse, error) {
+	return &cmtservice.GetSyncingResponse{Syncing: s.syncing}, nil
+}
+
+func (s *cmtServer) GetLatestBlock(ctx context.Context, req *cmtservice.GetLatestBlockRequest) (*cmtservice.GetLatestBlockResponse, error) {
+	blockID, block := s.block(s.metas[len(s.metas)-1])
+	return &cmtservice.GetLatestBlockResponse{BlockId: blockID, Block: block}, nil
+}
+
+func (s *cmtServer) GetBlockByHeight(ctx context.Context, req *cmtservice.GetBlockByHeightRequest) (*cmtservice.GetBlockByHeightResponse, error) {
+	s.calls.Add(1)
+
+	select {
+	case <-time.After(s.delay):
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+
+	s.mu.Lock()
+	code, fail := s.fail[req.Height]
+	s.mu.Unlock()
+	if fail {
+		return nil, status.Errorf(code, "height %d failed", req.Height)
+	}
+	if req.Height < 1 || req.Height > int64(len(s.metas)) {
+		return nil, status.Errorf(codes.InvalidArgument, "requested block height %d is not available", req.Height)
+	}
+
+	blockID, block := s.block(s.metas[req.Height-1])
+	return &cmtservice.GetBlockByHeightResponse{BlockId: blockID, Block: block}, nil
+}
+
+func (s *cmtServer) GetValidatorSetByHeight(ctx context.Context, req *cmtservice.GetValidatorSetByHeightRequest) (*cmtservice.GetValidatorSetByHeightResponse, error) {
+	s.validators.Add(1)
+
+	set := testValidators()
+	offset, limit := int(req.Pagination.Offset), int(req.Pagination.Limit)
+	resp := &cmtservice.GetValidatorSetByHeightResponse{
+		BlockHeight: req.Height,
+		Pagination:  &query.PageResponse{Total: uint64(len(set))},
+	}
+	for _, val := range set[min(offset, len(set)):min(offset+limit, len(set))] {
+		address, _ := hex.DecodeString(val.address)
+		consAddress, err := bech32.ConvertAndEncode("cosmosvalcons", address)
+		if err != nil {
+			return nil, err
+		}
+		resp.Validators = append(resp.Validators, &cmtservice.Validator{Address: consAddress, VotingPower: val.power})
+	}
+	return resp, nil
+}
+
+func (s *cmtServer) block(meta *tmtypes.BlockMeta) (*tmproto.BlockID, *tmproto.Block) {
+	blockID := meta.BlockID.ToProto()
+	block := &tmproto.Block{
+		Header: *meta.Header.ToProto(),
+		Data:   tmproto.Data{Txs: make([][]byte, meta.NumTxs)},
+	}
+	if s.commits {
+		block.LastCommit = testCommit(meta.Header.Height - 1)
+	}
+	return &blockID, block
+}
+
+// stakingServer is an in-memory cosmos.staking.v1beta1.Query serving
+// testStakingValidators
+type stakingServer struct {
+	stakingtypes.UnimplementedQueryServer
+}
+
+func (stakingServer) Validators(ctx context.Context, req *stakingtypes.QueryValidatorsRequest) (*stakingtypes.QueryValidatorsResponse, error) {
+	return stakingPage(req), nil
+}
+
+// newTestGRPCClient serves s over an in-memory connection
+func newTestGRPCClient(t *testing.T, s *cmtServer, maxConcurrency int) *GRPCClient {
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(grpc.ForceServerCodec(gogoCodec{}))
+	cmtservice.RegisterServiceServer(server, s)
+	stakingtypes.RegisterQueryServer(server, stakingServer{})
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(gogoCodec{})),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &types.ChainConfig{
+		Timeout:        5 * time.Second,
+		MaxRetries:     1,
+		RetryDelay:     time.Millisecond,
+		MaxConcurrency: maxConcurrency,
+	}
+	c := &GRPCClient{
+		config:  config,
+		conn:    conn,
+		service: cmtservice.NewServiceClient(conn),
+		retry:   newRetrier(config, "bufconn"),
+	}
+	if s.commits {
+		config.Commits = true
+		c.validators = newCommitValidators(config, c.getValidators)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestGRPCClientGetStatus(t *testing.T) {
+	s := &cmtServer{metas: testChain(40), syncing: true}
+	c := newTestGRPCClient(t, s, 4)
+
+	status, err := c.GetStatus(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.ChainID != testChainID || status.LatestHeight != 40 || !status.CatchingUp || status.EarliestHeight != 0 {
+		t.Errorf("got status %+v", status)
+	}
+}
+
+func TestGRPCClientGetBlockByHeight(t *testing.T) {
+	metas := testChain(40)
+	c := newTestGRPCClient(t, &cmtServer{metas: metas}, 4)
+
+	block, err := c.GetBlockByHeight(context.Background(), 17)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta := metas[16]
+	want := &types.BlockInfo{
+		Height:     17,
+		Time:       meta.Header.Time,
+		Hash:       meta.BlockID.Hash.String(),
+		ParentHash: meta.Header.LastBlockID.Hash.String(),
+		Proposer:   meta.Header.ProposerAddress.String(),
+		TxCount:    meta.NumTxs,
+	}
+	if !block.Time.Equal(want.Time) {
+		t.Errorf("got time %s, want %s", block.Time, want.Time)
+	}
+	block.Time = want.Time
+	if *block != *want {
+		t.Errorf("got block %+v, want %+v", block, want)
+	}
+
+	if _, err := c.GetBlockByHeight(context.Background(), 41); err == nil {
+		t.Error("expected an error above the latest height")
+	}
+}
+
+func TestGRPCClientGetBlockRange(t *testing.T) {
+	metas := testChain(100)
+	s := &cmtServer{metas: metas}
+	c := newTestGRPCClient(t, s, 8)
+
+	blocks, err := c.GetBlockRange(context.Background(), 11, 90)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 80 || s.calls.Load() != 80 {
+		t.Fatalf("got %d blocks with %d calls, want 80", len(blocks), s.calls.Load())
+	}
+	for i, block := range blocks {
+		if block.Height != 11+int64(i) {
+			t.Fatalf("block %d has height %d", i, block.Height)
+		}
+		if i > 0 {
+			want := block.Time.Sub(blocks[i-1].Time).Seconds()
+			if block.BlockTime != want {
+				t.Errorf("block %d has block time %v, want %v", block.Height, block.BlockTime, want)
+			}
+		}
+	}
+	if err := VerifyLinkage(blocks); err != nil {
+		t.Errorf("fetched blocks do not link: %v", err)
+	}
+}
+
+func TestGRPCClientCommits(t *testing.T) {
+	s := &cmtServer{metas: testChain(20), commits: true}
+	c := newTestGRPCClient(t, s, 4)
+
+	blocks, err := c.GetBlockRange(context.Background(), 11, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, block := range blocks {
+		if block.Commit == nil || *block.Commit != testCommitInfo {
+			t.Fatalf("got commit %+v in block %d, want %+v", block.Commit, block.Height, testCommitInfo)
+		}
+	}
+	// Two pages of validators, fetched once for all commits
+	if got := s.validators.Load(); got != 2 {
+		t.Errorf("got %d validator set calls, want 2", got)
+	}
+}
+
+func TestGRPCClientValidators(t *testing.T) {
+	s := &cmtServer{metas: testChain(20)}
+	c := newTestGRPCClient(t, s, 4)
+
+	set, err := c.GetValidatorSet(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := testValidators()
+	if len(set) != len(want) {
+		t.Fatalf("got %d validators, want %d", len(set), len(want))
+	}
+	for i := range want {
+		if set[i].Address != want[i].address || set[i].VotingPower != want[i].power {
+			t.Errorf("got validator %+v, want %+v", set[i], want[i])
+		}
+	}
+
+	described, err := c.GetStakingValidators(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertStakingInfos(t, described)
+}
+
+func TestGRPCClientGetBlockRangeStopsOnError(t *testing.T) {
+	tests := []struct {
+		name string
+		code codes.Code
+	}{
+		{"permanent error", codes.NotFound},
+		{"retries exhausted", codes.Unavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &cmtServer{
+				metas: testChain(2000),
+				delay: 2 * time.Millisecond,
+				fail:  map[int64]codes.Code{5: tt.code},
+			}
+			c := newTestGRPCClient(t, s, 4)
+
+			_, err := c.GetBlockRange(context.Background(), 1, 2000)
+			if err == nil || !strings.Contains(err.Error(), "height 5 failed") {
+				t.Fatalf("got error %v, want the failure at height 5", err)
+			}
+
+			// Calls in flight are cancelled and no new ones start
+			if calls := s.calls.Load(); calls > 100 {
+				t.Errorf("%d block calls were made after the failure", calls)
+			}
+		})
+	}
+}
+
+func TestGRPCClientGetBlockRangeCancel(t *testing.T) {
+	s := &cmtServer{metas: testChain(1000), delay: 5 * time.Millisecond}
+	c := newTestGRPCClient(t, s, 4)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := c.GetBlockRange(ctx, 1, 1000)
+	if err == nil {
+		t.Fatal("expected an error after the caller's deadline")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("range took %s after the deadline passed", elapsed)
+	}
+}
+
+func TestBlockInfoFromGRPC(t *testing.T) {
+	meta := testChain(3)[2]
+	blockID := meta.BlockID.ToProto()
+	header := meta.Header.ToProto()
+
+	consAddress, err := bech32.ConvertAndEncode("cosmosvalcons", meta.Header.ProposerAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sdkBlock := &cmtservice.Block{
+		Header: cmtservice.Header{
+			Height:          header.Height,
+			Time:            header.Time,
+			LastBlockId:     header.LastBlockId,
+			ProposerAddress: consAddress,
+		},
+		Data: tmproto.Data{Txs: make([][]byte, meta.NumTxs)},
+	}
+
+	tests := []struct {
+		name     string
+		block    *tmproto.Block
+		sdkBlock *cmtservice.Block
+		wantErr  bool
+	}{
+		{"CometBFT block", &tmproto.Block{Header: *header, Data: tmproto.Data{Txs: make([][]byte, meta.NumTxs)}}, nil, false},
+		{"SDK block with bech32 proposer", nil, sdkBlock, false},
+		{"no block", nil, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block, err := blockInfoFromGRPC(&blockID, tt.block, tt.sdkBlock)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := fmt.Sprintf("%d %s %s %s %d", block.Height, block.Hash, block.ParentHash, block.Proposer, block.TxCount)
+			want := fmt.Sprintf("%d %s %s %s %d", meta.Header.Height, meta.BlockID.Hash, meta.Header.LastBlockID.Hash, meta.Header.ProposerAddress, meta.NumTxs)
+			if got != want || !block.Time.Equal(meta.Header.Time) {
+				t.Errorf("got %s at %s, want %s at %s", got, block.Time, want, meta.Header.Time)
+			}
+		})
+	}
+}
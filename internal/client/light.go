@@ -0,0 +1,252 @@
+package client
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	dbm "github.com/cometbft/cometbft-db"
+	"github.com/cometbft/cometbft/light"
+	lightdb "github.com/cometbft/cometbft/light/store/db"
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+// verifiedStreamChunkSize is the default chunk size of verified streams. Every
+// chunk costs a light client verification of its highest header, so chunks
+// are larger than for unverified streams
+const verifiedStreamChunkSize = 50 * maxBlockMetas
+
+// defaultTrustPeriod is how long a verified header is trusted, well below the
+// three week unbonding period of most Cosmos chains
+const defaultTrustPeriod = 168 * time.Hour
+
+// VerifyingClient implements BlockchainClient by verifying the headers of
+// another client with a CometBFT light client, so block times can be trusted
+// without trusting the node that served them.
+//
+// Only the highest block of every run of consecutive heights is verified by
+// the light client. Each verified header commits to the hash of its parent,
+// so the rest of the run is verified by hash linkage, which costs no requests.
+// This requires block hashes computed from the headers, as the RPC transport
+// does.
+type VerifyingClient struct {
+	inner BlockchainClient
+
+	mu    sync.Mutex // the light client is not safe for concurrent use
+	light *light.Client
+}
+
+// NewVerifyingClient creates a client verifying the blocks of inner against
+// the trusted header in config.Light. The primary RPC endpoint serves the
+// light blocks, the other RPC endpoints and the configured witnesses cross-check it.
+func NewVerifyingClient(ctx context.Context, inner BlockchainClient, config *types.ChainConfig) (*VerifyingClient, error) {
+	if config.Transport != "" && config.Transport != TransportRPC {
+		return nil, fmt.Errorf("light client verification requires the rpc transport")
+	}
+	if config.ChainID == "" {
+		return nil, fmt.Errorf("chain ID is required for light client verification")
+	}
+
+	trustHash, err := hex.DecodeString(config.Light.TrustHash)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trust hash: %w", err)
+	}
+
+	trustPeriod := config.Light.TrustPeriod
+	if trustPeriod == 0 {
+		trustPeriod = defaultTrustPeriod
+	}
+
+	primary := config.RPCEndpoint
+	var witnesses []string
+	for _, endpoint := range append(append([]string{}, config.RPCEndpoints...), config.Light.Witnesses...) {
+		if endpoint != primary && !slices.Contains(witnesses, endpoint) {
+			witnesses = append(witnesses, endpoint)
+		}
+	}
+	if len(witnesses) == 0 {
+		return nil, fmt.Errorf("light client verification needs at least one witness besides %s", primary)
+	}
+
+	lightClient, err := light.NewHTTPClient(
+		ctx,
+		config.ChainID,
+		light.TrustOptions{
+			Period: trustPeriod,
+			Height: config.Light.TrustHeight,
+			Hash:   trustHash,
+		},
+		primary,
+		witnesses,
+		lightdb.New(dbm.NewMemDB(), config.ChainID),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create light client: %w", err)
+	}
+
+	return &VerifyingClient{
+		inner: inner,
+		light: lightClient,
+	}, nil
+}
+
+// GetLatestBlockHeight gets the latest block height from the node
+func (c *VerifyingClient) GetLatestBlockHeight(ctx context.Context) (int64, error) {
+	return c.inner.GetLatestBlockHeight(ctx)
+}
+
+// GetStatus gets the node status from the node
+func (c *VerifyingClient) GetStatus(ctx context.Context) (*types.NodeStatus, error) {
+	return c.inner.GetStatus(ctx)
+}
+
+// GetBlockByHeight gets a block and verifies its header
+func (c *VerifyingClient) GetBlockByHeight(ctx context.Context, height int64) (*types.BlockInfo, error) {
+	block, err := c.inner.GetBlockByHeight(ctx, height)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.verify(ctx, []*types.BlockInfo{block}); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// GetBlockRange gets a range of blocks and verifies their headers
+func (c *VerifyingClient) GetBlockRange(ctx context.Context, startHeight, endHeight int64) ([]*types.BlockInfo, error) {
+	blocks, err := c.inner.GetBlockRange(ctx, startHeight, endHeight)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.verify(ctx, blocks); err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+// StreamBlockRange streams a range of blocks in chunks large enough that the
+// light client verifies few headers
+func (c *VerifyingClient) StreamBlockRange(ctx context.Context, startHeight, endHeight int64, opts StreamOptions) (<-chan *types.BlockInfo, <-chan error) {
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = verifiedStreamChunkSize
+	}
+	return StreamChunks(ctx, c, startHeight, endHeight, opts)
+}
+
+// SubscribeNewBlocks subscribes to new blocks through the client behind the
+// light client and verifies every header before delivering it. A new header
+// is not committed to by any verified one yet, so each costs a light client
+// verification. A header failing verification ends the subscription: its
+// error is the last one on the error channel
+func (c *VerifyingClient) SubscribeNewBlocks(ctx context.Context) (<-chan *types.BlockInfo, <-chan error) {
+	subscriber, ok := FindSubscriber(c.inner)
+	if !ok {
+		return failedStream(fmt.Errorf("the client behind the light client does not support subscriptions"))
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	innerBlocks, innerErrs := subscriber.SubscribeNewBlocks(ctx)
+
+	blocks := make(chan *types.BlockInfo, maxBlockMetas)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+		defer close(blocks)
+		defer cancel()
+
+		for {
+			select {
+			case block, ok := <-innerBlocks:
+				if !ok {
+					return
+				}
+
+				if err := c.verify(ctx, []*types.BlockInfo{block}); err != nil {
+					if ctx.Err() == nil {
+						// Make room for the error, connection reports matter less
+						select {
+						case <-errs:
+						default:
+						}
+						errs <- err
+					}
+					return
+				}
+
+				select {
+				case blocks <- block:
+				case <-ctx.Done():
+					return
+				}
+
+			case err, ok := <-innerErrs:
+				if !ok {
+					innerErrs = nil
+					continue
+				}
+				select {
+				case errs <- err:
+				default:
+				}
+			}
+		}
+	}()
+
+	return blocks, errs
+}
+
+// Unwrap returns the client behind the light client
+func (c *VerifyingClient) Unwrap() BlockchainClient {
+	return c.inner
+}
+
+// Close closes the client behind the light client
+func (c *VerifyingClient) Close() error {
+	return c.inner.Close()
+}
+
+// verify marks the height-ordered blocks as verified, walking down from the
+// highest block of every run: the light client verifies it, and every block
+// below must hash to the parent hash of the block above it. Any mismatch
+// fails, as the node served a header the chain never committed.
+func (c *VerifyingClient) verify(ctx context.Context, blocks []*types.BlockInfo) error {
+	var expected string
+	for i := len(blocks) - 1; i >= 0; i-- {
+		block := blocks[i]
+
+		if i == len(blocks)-1 || blocks[i+1].Height != block.Height+1 {
+			hash, err := c.verifiedHash(ctx, block.Height)
+			if err != nil {
+				return err
+			}
+			expected = hash
+		}
+
+		if block.Hash == "" || !strings.EqualFold(block.Hash, expected) {
+			return fmt.Errorf("header of block %d has hash %s, but the verified hash is %s", block.Height, block.Hash, expected)
+		}
+
+		block.Verified = true
+		expected = block.ParentHash
+	}
+	return nil
+}
+
+// verifiedHash returns the header hash at height as verified by the light client
+func (c *VerifyingClient) verifiedHash(ctx context.Context, height int64) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	lightBlock, err := c.light.VerifyLightBlockAtHeight(ctx, height, time.Now())
+	if err != nil {
+		return "", fmt.Errorf("failed to verify header %d: %w", height, err)
+	}
+	return lightBlock.Hash().String(), nil
+}
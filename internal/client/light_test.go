@@ -0,0 +1,281 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	dbm "github.com/cometbft/cometbft-db"
+	"github.com/cometbft/cometbft/crypto/ed25519"
+	"github.com/cometbft/cometbft/crypto/tmhash"
+	"github.com/cometbft/cometbft/light"
+	"github.com/cometbft/cometbft/light/provider"
+	"github.com/cometbft/cometbft/light/provider/mock"
+	lightdb "github.com/cometbft/cometbft/light/store/db"
+	cmtversion "github.com/cometbft/cometbft/proto/tendermint/version"
+	tmtypes "github.com/cometbft/cometbft/types"
+	"github.com/cometbft/cometbft/version"
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+// lightChain builds signed light blocks for heights 1..n of a chain with a
+// single validator, blocks[h-1] being height h. The block at forgeAt, if any,
+// is signed by a validator the chain never had
+func lightChain(t *testing.T, n, forgeAt int64) []*tmtypes.LightBlock {
+	key := ed25519.GenPrivKey()
+	vals := tmtypes.NewValidatorSet([]*tmtypes.Validator{tmtypes.NewValidator(key.PubKey(), 10)})
+	forgerKey := ed25519.GenPrivKey()
+	forgerVals := tmtypes.NewValidatorSet([]*tmtypes.Validator{tmtypes.NewValidator(forgerKey.PubKey(), 10)})
+
+	// Recent enough to be trusted and not in the future
+	base := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+
+	blocks := make([]*tmtypes.LightBlock, 0, n)
+	var lastID tmtypes.BlockID
+	for height := int64(1); height <= n; height++ {
+		signer, signers := key, vals
+		if height == forgeAt {
+			signer, signers = forgerKey, forgerVals
+		}
+
+		header := &tmtypes.Header{
+			Version:            cmtversion.Consensus{Block: version.BlockProtocol},
+			ChainID:            testChainID,
+			Height:             height,
+			Time:               base.Add(time.Duration(height) * 6 * time.Second),
+			LastBlockID:        lastID,
+			ValidatorsHash:     signers.Hash(),
+			NextValidatorsHash: signers.Hash(),
+			ProposerAddress:    signers.Proposer.Address,
+		}
+		blockID := tmtypes.BlockID{
+			Hash:          header.Hash(),
+			PartSetHeader: tmtypes.PartSetHeader{Total: 1, Hash: tmhash.Sum([]byte(fmt.Sprint(height)))},
+		}
+
+		commit := &tmtypes.Commit{
+			Height:  height,
+			BlockID: blockID,
+			Signatures: []tmtypes.CommitSig{{
+				BlockIDFlag:      tmtypes.BlockIDFlagCommit,
+				ValidatorAddress: signers.Proposer.Address,
+				Timestamp:        header.Time.Add(time.Second),
+			}},
+		}
+		signature, err := signer.Sign(tmtypes.VoteSignBytes(testChainID, commit.GetVote(0).ToProto()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		commit.Signatures[0].Signature = signature
+
+		blocks = append(blocks, &tmtypes.LightBlock{
+			SignedHeader: &tmtypes.SignedHeader{Header: header, Commit: commit},
+			ValidatorSet: signers,
+		})
+		lastID = blockID
+	}
+	return blocks
+}
+
+// lightProvider serves chain to the light client like a node's RPC would
+func lightProvider(chain []*tmtypes.LightBlock) provider.Provider {
+	headers := make(map[int64]*tmtypes.SignedHeader, len(chain))
+	vals := make(map[int64]*tmtypes.ValidatorSet, len(chain))
+	for _, lightBlock := range chain {
+		headers[lightBlock.Height] = lightBlock.SignedHeader
+		vals[lightBlock.Height] = lightBlock.ValidatorSet
+	}
+	return mock.New(testChainID, headers, vals)
+}
+
+// lightChainClient serves the headers of a light chain as blocks and streams
+// the blocks sent on subscription
+type lightChainClient struct {
+	blocks       []*types.BlockInfo
+	subscription chan *types.BlockInfo
+}
+
+func newLightChainClient(chain []*tmtypes.LightBlock) *lightChainClient {
+	c := &lightChainClient{subscription: make(chan *types.BlockInfo, len(chain))}
+	for _, lightBlock := range chain {
+		c.blocks = append(c.blocks, &types.BlockInfo{
+			Height:     lightBlock.Height,
+			Time:       lightBlock.Time,
+			Hash:       lightBlock.Hash().String(),
+			ParentHash: lightBlock.LastBlockID.Hash.String(),
+			Proposer:   lightBlock.ProposerAddress.String(),
+		})
+	}
+	return c
+}
+
+func (c *lightChainClient) GetLatestBlockHeight(ctx context.Context) (int64, error) {
+	return int64(len(c.blocks)), nil
+}
+
+func (c *lightChainClient) GetStatus(ctx context.Context) (*types.NodeStatus, error) {
+	return &types.NodeStatus{ChainID: testChainID, LatestHeight: int64(len(c.blocks)), EarliestHeight: 1}, nil
+}
+
+func (c *lightChainClient) GetBlockByHeight(ctx context.Context, height int64) (*types.BlockInfo, error) {
+	blocks, err := c.GetBlockRange(ctx, height, height)
+	if err != nil {
+		return nil, err
+	}
+	return blocks[0], nil
+}
+
+func (c *lightChainClient) GetBlockRange(ctx context.Context, startHeight, endHeight int64) ([]*types.BlockInfo, error) {
+	if startHeight < 1 || endHeight > int64(len(c.blocks)) {
+		return nil, fmt.Errorf("heights %d-%d are not available", startHeight, endHeight)
+	}
+
+	blocks := make([]*types.BlockInfo, 0, endHeight-startHeight+1)
+	for height := startHeight; height <= endHeight; height++ {
+		block := *c.blocks[height-1]
+		blocks = append(blocks, &block)
+	}
+	return blocks, nil
+}
+
+func (c *lightChainClient) SubscribeNewBlocks(ctx context.Context) (<-chan *types.BlockInfo, <-chan error) {
+	return c.subscription, make(chan error)
+}
+
+func (c *lightChainClient) Close() error {
+	return nil
+}
+
+// newTestVerifyingClient verifies the blocks of inner against chain, trusting
+// its first header. Primary and witness both serve chain
+func newTestVerifyingClient(t *testing.T, chain []*tmtypes.LightBlock, inner BlockchainClient) *VerifyingClient {
+	lightClient, err := light.NewClient(
+		context.Background(),
+		testChainID,
+		light.TrustOptions{
+			Period: defaultTrustPeriod,
+			Height: 1,
+			Hash:   chain[0].Hash(),
+		},
+		lightProvider(chain),
+		[]provider.Provider{lightProvider(chain)},
+		lightdb.New(dbm.NewMemDB(), testChainID),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &VerifyingClient{inner: inner, light: lightClient}
+}
+
+func TestVerifyingClientGetBlockRange(t *testing.T) {
+	chain := lightChain(t, 60, 0)
+	c := newTestVerifyingClient(t, chain, newLightChainClient(chain))
+
+	blocks, err := c.GetBlockRange(context.Background(), 11, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 40 {
+		t.Fatalf("got %d blocks, want 40", len(blocks))
+	}
+	for _, block := range blocks {
+		if !block.Verified {
+			t.Errorf("block %d is not verified", block.Height)
+		}
+	}
+
+	block, err := c.GetBlockByHeight(context.Background(), 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !block.Verified {
+		t.Error("block 60 is not verified")
+	}
+}
+
+func TestVerifyingClientLinkageBreak(t *testing.T) {
+	chain := lightChain(t, 60, 0)
+	inner := newLightChainClient(chain)
+
+	// The node serves a header at 30 the chain never committed
+	inner.blocks[29].Hash = strings.Repeat("AB", 32)
+	c := newTestVerifyingClient(t, chain, inner)
+
+	_, err := c.GetBlockRange(context.Background(), 11, 50)
+	want := fmt.Sprintf("header of block 30 has hash %s, but the verified hash is %s", inner.blocks[29].Hash, chain[29].Hash())
+	if err == nil || err.Error() != want {
+		t.Fatalf("got error %v, want %q", err, want)
+	}
+
+	// Ranges ending below the break are not affected
+	if _, err := c.GetBlockRange(context.Background(), 11, 29); err != nil {
+		t.Errorf("unexpected error below the break: %v", err)
+	}
+}
+
+func TestVerifyingClientForgedHeader(t *testing.T) {
+	// Primary and witness both serve a header signed by a stranger at 50
+	chain := lightChain(t, 50, 50)
+	c := newTestVerifyingClient(t, chain, newLightChainClient(chain))
+
+	// The chain up to the forgery verifies
+	blocks, err := c.GetBlockRange(context.Background(), 41, 49)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, block := range blocks {
+		if !block.Verified {
+			t.Errorf("block %d is not verified", block.Height)
+		}
+	}
+
+	_, err = c.GetBlockRange(context.Background(), 41, 50)
+	if err == nil || !strings.Contains(err.Error(), "failed to verify header 50") {
+		t.Fatalf("got error %v, want header 50 to fail verification", err)
+	}
+}
+
+func TestVerifyingClientSubscribeNewBlocks(t *testing.T) {
+	chain := lightChain(t, 60, 0)
+	inner := newLightChainClient(chain)
+	c := newTestVerifyingClient(t, chain, inner)
+
+	forged := *inner.blocks[45]
+	forged.Hash = strings.Repeat("AB", 32)
+	for _, block := range inner.blocks[40:45] {
+		copied := *block
+		inner.subscription <- &copied
+	}
+	inner.subscription <- &forged
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Every delivered block is verified, the forged one ends the subscription
+	blockChan, errChan := c.SubscribeNewBlocks(ctx)
+	var heights []int64
+	for block := range blockChan {
+		if !block.Verified {
+			t.Errorf("block %d was delivered unverified", block.Height)
+		}
+		heights = append(heights, block.Height)
+	}
+	if fmt.Sprint(heights) != "[41 42 43 44 45]" {
+		t.Errorf("got heights %v, want 41-45", heights)
+	}
+
+	var last error
+	for err := range errChan {
+		last = err
+	}
+	if last == nil || !strings.Contains(last.Error(), "header of block 46 has hash") {
+		t.Errorf("got error %v, want block 46 rejected", last)
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		t.Error("subscription did not end on the forged header")
+	}
+}
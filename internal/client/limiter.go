@@ -0,0 +1,237 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// defaultMaxConcurrency is the default upper bound of concurrent requests per node
+	defaultMaxConcurrency = 10
+
+	// throttleFactor shrinks the concurrency limit when the node rate limits or times out
+	throttleFactor = 0.5
+
+	// slowFactor shrinks the concurrency limit when responses slow down
+	slowFactor = 0.9
+
+	// A response is slow when it takes slowLatencyFactor times the usual
+	// latency, and at least minSlowLatency
+	slowLatencyFactor = 3
+	minSlowLatency    = 250 * time.Millisecond
+
+	// latencyWeight is the weight of the latest sample in the usual latency
+	latencyWeight = 0.1
+)
+
+// limiter adapts the number of concurrent requests to a node with additive
+// increase and multiplicative decrease: every success raises the limit by
+// 1/limit, so it grows by about one per round of requests, while rate limit
+// responses, timeouts and slow responses cut it. Requests are additionally
+// paced by a token bucket when a request rate is configured
+type limiter struct {
+	maxLimit float64
+	bucket   *tokenBucket
+	logf     func(format string, args ...any) // logs every cut of the limit when set
+
+	mu           sync.Mutex
+	limit        float64
+	inflight     int
+	latency      time.Duration // usual latency of successful requests
+	lastDecrease time.Time
+	throttles    int64
+	changed      chan struct{} // closed and replaced whenever a slot may have freed up
+}
+
+// newLimiter creates a limiter allowing up to maxConcurrency concurrent
+// requests and requestsPerSecond requests per second, 0 meaning unlimited
+func newLimiter(maxConcurrency int, requestsPerSecond float64) *limiter {
+	if maxConcurrency <= 0 {
+		maxConcurrency = defaultMaxConcurrency
+	}
+
+	l := &limiter{
+		maxLimit: float64(maxConcurrency),
+		limit:    float64(maxConcurrency),
+		changed:  make(chan struct{}),
+	}
+	if requestsPerSecond > 0 {
+		l.bucket = newTokenBucket(requestsPerSecond)
+	}
+	return l
+}
+
+// acquire waits for a free slot and, if a rate is configured, for a token
+func (l *limiter) acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if l.inflight < int(l.limit) {
+			l.inflight++
+			l.mu.Unlock()
+			break
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+
+	if l.bucket != nil {
+		if err := l.bucket.wait(ctx); err != nil {
+			l.mu.Lock()
+			l.inflight--
+			l.notify()
+			l.mu.Unlock()
+			return err
+		}
+	}
+	return nil
+}
+
+// release frees the slot of a finished request and adapts the limit to its outcome
+func (l *limiter) release(latency time.Duration, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inflight--
+	defer l.notify()
+
+	switch {
+	case err == nil:
+		slow := l.latency > 0 && latency > slowLatencyFactor*l.latency && latency > minSlowLatency
+		if l.latency == 0 {
+			l.latency = latency
+		} else {
+			l.latency = time.Duration((1-latencyWeight)*float64(l.latency) + latencyWeight*float64(latency))
+		}
+
+		if slow {
+			l.decrease(slowFactor, fmt.Sprintf("slow response after %s", latency.Round(time.Millisecond)))
+		} else {
+			l.limit = math.Min(l.limit+1/l.limit, l.maxLimit)
+		}
+
+	case isThrottled(err):
+		l.decrease(throttleFactor, err.Error())
+	}
+}
+
+// decrease shrinks the limit by factor because of reason. Requests that were
+// already in flight report the same congestion, so the limit is cut at most
+// once per usual latency
+func (l *limiter) decrease(factor float64, reason string) {
+	now := time.Now()
+	if now.Sub(l.lastDecrease) < max(l.latency, 100*time.Millisecond) {
+		return
+	}
+
+	previous := l.limit
+	l.lastDecrease = now
+	l.limit = math.Max(l.limit*factor, 1)
+	l.throttles++
+
+	if l.logf != nil {
+		l.logf("concurrency limit cut from %d to %d: %s", int(previous), int(l.limit), reason)
+	}
+}
+
+// notify wakes up waiting requests
+func (l *limiter) notify() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// stats returns the number of times the limit was cut and the current limit
+func (l *limiter) stats() (throttles int64, limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.throttles, int(l.limit)
+}
+
+// isThrottled reports whether err shows the node is overloaded or limiting us:
+// HTTP 429, gRPC ResourceExhausted or a timeout
+func isThrottled(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	if httpStatusCode(err) == 429 {
+		return true
+	}
+
+	if s, ok := status.FromError(err); ok {
+		switch s.Code() {
+		case codes.ResourceExhausted, codes.DeadlineExceeded:
+			return true
+		}
+	}
+
+	return false
+}
+
+// tokenBucket paces requests to a steady rate with bursts of up to one second
+type tokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64) *tokenBucket {
+	burst := math.Max(rate, 1)
+	return &tokenBucket{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// wait takes a token, waiting until one is available. Tokens are reserved in
+// arrival order, so the balance goes negative while requests are queued. A
+// request cancelled while queued gives its token back
+func (b *tokenBucket) wait(ctx context.Context) error {
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens = math.Min(b.tokens+now.Sub(b.last).Seconds()*b.rate, b.burst)
+	b.last = now
+	b.tokens--
+	delay := time.Duration(-b.tokens / b.rate * float64(time.Second))
+	b.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		b.mu.Lock()
+		b.tokens++
+		b.mu.Unlock()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
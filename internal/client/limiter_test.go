@@ -0,0 +1,108 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+func TestLimiterDecrease(t *testing.T) {
+	l := newLimiter(8, 0)
+
+	// Additive increase never goes above the configured maximum
+	l.release(10*time.Millisecond, nil)
+	if _, limit := l.stats(); limit != 8 {
+		t.Fatalf("got limit %d, want 8", limit)
+	}
+
+	l.inflight = 2
+	l.release(10*time.Millisecond, &httpStatusError{Code: 429})
+	// Requests in flight during the same congestion don't cut it again
+	l.release(10*time.Millisecond, &httpStatusError{Code: 429})
+
+	throttles, limit := l.stats()
+	if throttles != 1 || limit != 4 {
+		t.Errorf("got %d cuts to %d, want 1 cut to 4", throttles, limit)
+	}
+
+	// Failures that don't show congestion leave it alone
+	l.inflight = 1
+	l.lastDecrease = time.Time{}
+	l.release(10*time.Millisecond, &httpStatusError{Code: 400})
+	if throttles, _ := l.stats(); throttles != 1 {
+		t.Errorf("got %d cuts after a bad request, want 1", throttles)
+	}
+}
+
+func TestRetrierLogsDecreases(t *testing.T) {
+	var logs []string
+	config := &types.ChainConfig{
+		Timeout:        time.Second,
+		MaxConcurrency: 8,
+		Logf: func(format string, args ...any) {
+			logs = append(logs, fmt.Sprintf(format, args...))
+		},
+	}
+	r := newRetrier(config, "http://node:26657")
+
+	r.limiter.inflight = 1
+	r.limiter.release(10*time.Millisecond, &httpStatusError{Code: 429})
+	if len(logs) != 1 || !strings.HasPrefix(logs[0], "http://node:26657: concurrency limit cut from 8 to 4: unexpected HTTP status 429") {
+		t.Fatalf("got logs %q", logs)
+	}
+
+	// A slow response after the usual latency is established
+	r.limiter.lastDecrease = time.Time{}
+	r.limiter.inflight = 2
+	r.limiter.release(10*time.Millisecond, nil)
+	r.limiter.release(time.Second, nil)
+	if len(logs) != 2 || !strings.HasSuffix(logs[1], "cut from 4 to 3: slow response after 1s") {
+		t.Errorf("got logs %q", logs)
+	}
+
+	// Without Logf nothing is logged
+	quiet := newRetrier(&types.ChainConfig{MaxConcurrency: 8}, "http://node:26657")
+	quiet.limiter.inflight = 1
+	quiet.limiter.release(10*time.Millisecond, &httpStatusError{Code: 429})
+	if throttles, _ := quiet.limiter.stats(); throttles != 1 {
+		t.Errorf("got %d cuts without logging, want 1", throttles)
+	}
+}
+
+func TestTokenBucketCancel(t *testing.T) {
+	b := newTokenBucket(10)
+	for i := 0; i < 10; i++ {
+		if err := b.wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A cancelled range fetch leaves 50 requests queued for 5 seconds
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := b.wait(ctx); err == nil {
+				t.Error("queued request was not cancelled")
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Their tokens are back, so the next request waits for one token only
+	start := time.Now()
+	if err := b.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(start); waited > 500*time.Millisecond {
+		t.Errorf("waited %s after the queued requests were cancelled", waited)
+	}
+}
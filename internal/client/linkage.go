@@ -0,0 +1,35 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+// CheckLink verifies that block is the child of parent: its header's
+// LastBlockID must name the parent's hash. Blocks that are not consecutive
+// or lack a hash cannot be checked and pass
+func CheckLink(parent, block *types.BlockInfo) error {
+	if parent == nil || block.Height != parent.Height+1 || parent.Hash == "" || block.ParentHash == "" {
+		return nil
+	}
+
+	if !strings.EqualFold(block.ParentHash, parent.Hash) {
+		return fmt.Errorf("block %d does not link to block %d: parent hash %s, but block %d has hash %s",
+			block.Height, parent.Height, block.ParentHash, parent.Height, parent.Hash)
+	}
+	return nil
+}
+
+// VerifyLinkage verifies that consecutive blocks of a height-ordered slice link
+// to each other, which catches nodes serving inconsistent data and lets
+// stored blocks be validated later
+func VerifyLinkage(blocks []*types.BlockInfo) error {
+	for i := 1; i < len(blocks); i++ {
+		if err := CheckLink(blocks[i-1], blocks[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+func fakeBlock(height int64) *types.BlockInfo {
+	return &types.BlockInfo{
+		Height:     height,
+		Time:       time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(height) * 6 * time.Second),
+		Hash:       fmt.Sprintf("%064X", height),
+		ParentHash: fmt.Sprintf("%064X", height-1),
+	}
+}
+
+func TestCheckLink(t *testing.T) {
+	parent := fakeBlock(10)
+	child := fakeBlock(11)
+
+	lowercase := fakeBlock(11)
+	lowercase.ParentHash = strings.ToLower(parent.Hash)
+
+	forked := fakeBlock(11)
+	forked.ParentHash = fakeBlock(99).Hash
+
+	noParentHash := fakeBlock(11)
+	noParentHash.ParentHash = ""
+
+	noHash := fakeBlock(10)
+	noHash.Hash = ""
+
+	tests := []struct {
+		name    string
+		parent  *types.BlockInfo
+		block   *types.BlockInfo
+		wantErr string
+	}{
+		{"linked", parent, child, ""},
+		{"hex case differs", parent, lowercase, ""},
+		{"no parent", nil, child, ""},
+		{"not consecutive", parent, fakeBlock(13), ""},
+		{"parent hash unknown", parent, noParentHash, ""},
+		{"parent without hash", noHash, forked, ""},
+		{"forked", parent, forked, "block 11 does not link to block 10: parent hash " + forked.ParentHash + ", but block 10 has hash " + parent.Hash},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckLink(tt.parent, tt.block)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyLinkage(t *testing.T) {
+	chain := func(heights ...int64) []*types.BlockInfo {
+		blocks := make([]*types.BlockInfo, len(heights))
+		for i, height := range heights {
+			blocks[i] = fakeBlock(height)
+		}
+		return blocks
+	}
+
+	tests := []struct {
+		name    string
+		blocks  []*types.BlockInfo
+		breakAt int64 // height that does not link, 0 for none
+	}{
+		{"empty", nil, 0},
+		{"single block", chain(5), 0},
+		{"consecutive", chain(1, 2, 3, 4, 5), 0},
+		{"gap", chain(1, 2, 5, 6), 0},
+		{"break", chain(1, 2, 3, 4, 5), 4},
+		{"break after a gap", chain(1, 2, 5, 6, 7), 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, block := range tt.blocks {
+				if block.Height == tt.breakAt {
+					block.ParentHash = "FORK"
+				}
+			}
+
+			err := VerifyLinkage(tt.blocks)
+			if tt.breakAt == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), fmt.Sprintf("block %d does not link", tt.breakAt)) {
+				t.Errorf("got error %v, want a break at %d", err, tt.breakAt)
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package client
+
+import (
+	abci "github.com/cometbft/cometbft/abci/types"
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+// loadFromResults sums the gas of the transaction results of a block and
+// counts the events it emitted, transaction and block events alike
+func loadFromResults(txs []*abci.ExecTxResult, events []abci.Event, size int) *types.LoadInfo {
+	load := &types.LoadInfo{Events: len(events), Size: size}
+	for _, tx := range txs {
+		if tx == nil {
+			continue
+		}
+		load.GasUsed += tx.GasUsed
+		load.GasWanted += tx.GasWanted
+		load.Events += len(tx.Events)
+	}
+	return load
+}
@@ -0,0 +1,719 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+const (
+	// rangeChunkSize is the number of heights handed to one endpoint at a time
+	rangeChunkSize = 10 * maxBlockMetas
+
+	// maxHeightLag is how far an endpoint may trail the highest endpoint before it is ejected
+	maxHeightLag = 20
+
+	// ejectAfterFailures is the number of consecutive failures that ejects an endpoint
+	ejectAfterFailures = 3
+
+	baseEjectDuration = 30 * time.Second
+	maxEjectDuration  = 5 * time.Minute
+
+	// healthWeight is the weight of the latest sample in the latency and error rate averages
+	healthWeight = 0.2
+)
+
+// EndpointStats represents the observed health of one endpoint
+type EndpointStats struct {
+	URL       string        `json:"url"`
+	Requests  int64         `json:"requests"`
+	Errors    int64         `json:"errors"`
+	ErrorRate float64       `json:"error_rate"`
+	Latency   time.Duration `json:"latency"`
+	Status    string        `json:"status"`
+}
+
+// EndpointStatsProvider is implemented by clients that spread requests over several endpoints
+type EndpointStatsProvider interface {
+	EndpointStats() []EndpointStats
+}
+
+// endpoint tracks the health of a single upstream client
+type endpoint struct {
+	url    string
+	client BlockchainClient
+
+	mu                  sync.Mutex
+	requests            int64
+	errors              int64
+	errorRate           float64
+	latency             time.Duration
+	consecutiveFailures int
+	ejections           int
+	ejectedUntil        time.Time
+	disabled            string // reason the endpoint is permanently excluded
+	earliestHeight      int64  // lowest height the endpoint has, 0 if unknown
+}
+
+// record updates the health of the endpoint after a request
+func (e *endpoint) record(latency time.Duration, err error) {
+	// A request cancelled by the caller says nothing about the endpoint
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.requests++
+	if err == nil {
+		e.consecutiveFailures = 0
+		e.errorRate *= 1 - healthWeight
+		if latency > 0 {
+			if e.latency == 0 {
+				e.latency = latency
+			} else {
+				e.latency = time.Duration((1-healthWeight)*float64(e.latency) + healthWeight*float64(latency))
+			}
+		}
+		return
+	}
+
+	e.errors++
+	e.errorRate = (1-healthWeight)*e.errorRate + healthWeight
+	e.consecutiveFailures++
+	if e.consecutiveFailures >= ejectAfterFailures {
+		e.ejectLocked()
+	}
+}
+
+// eject removes the endpoint from rotation for a while
+func (e *endpoint) eject() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.ejectLocked()
+}
+
+func (e *endpoint) ejectLocked() {
+	e.ejections++
+	duration := baseEjectDuration << (e.ejections - 1)
+	if duration <= 0 || duration > maxEjectDuration {
+		duration = maxEjectDuration
+	}
+	e.ejectedUntil = time.Now().Add(duration)
+
+	// A single failure after the ejection ends puts the endpoint back out
+	e.consecutiveFailures = ejectAfterFailures - 1
+}
+
+// disable permanently excludes the endpoint
+func (e *endpoint) disable(reason string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.disabled = reason
+}
+
+// setEarliestHeight records the lowest height the endpoint still has
+func (e *endpoint) setEarliestHeight(height int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.earliestHeight = height
+}
+
+// earliest returns the lowest height the endpoint has, 0 if unknown
+func (e *endpoint) earliest() int64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.earliestHeight
+}
+
+// hasHeight reports whether the endpoint keeps blocks down to height, and
+// whether that is known at all: an endpoint that does not report its earliest
+// height may be an archive or a pruned node. A height of 0 matches every endpoint
+func (e *endpoint) hasHeight(height int64) (has, known bool) {
+	earliest := e.earliest()
+	switch {
+	case height <= 0:
+		return true, true
+	case earliest == 0:
+		return false, false
+	}
+	return earliest <= height, true
+}
+
+// available reports whether the endpoint may be used at all
+func (e *endpoint) available() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.disabled == ""
+}
+
+// healthy reports whether the endpoint is in rotation
+func (e *endpoint) healthy(now time.Time) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.disabled == "" && !now.Before(e.ejectedUntil)
+}
+
+// score ranks healthy endpoints, lower is better. Endpoints without latency
+// samples score zero so that they get probed
+func (e *endpoint) score() float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return float64(e.latency) * (1 + 4*e.errorRate)
+}
+
+// stats returns a snapshot of the endpoint health
+func (e *endpoint) stats(now time.Time) EndpointStats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	status := "healthy"
+	if e.disabled != "" {
+		status = "disabled: " + e.disabled
+	} else if now.Before(e.ejectedUntil) {
+		status = fmt.Sprintf("ejected for %s", e.ejectedUntil.Sub(now).Round(time.Second))
+	}
+
+	return EndpointStats{
+		URL:       e.url,
+		Requests:  e.requests,
+		Errors:    e.errors,
+		ErrorRate: e.errorRate,
+		Latency:   e.latency,
+		Status:    status,
+	}
+}
+
+// MultiClient implements BlockchainClient over several endpoints of the same chain.
+// Requests go to the healthiest endpoint and fail over to the others, range
+// fetches are spread across all healthy endpoints
+type MultiClient struct {
+	config    *types.ChainConfig
+	endpoints []*endpoint
+
+	checkOnce sync.Once
+	checkErr  error
+}
+
+// NewMultiClient creates a client with one CosmosSDKClient per configured RPC endpoint
+func NewMultiClient(config *types.ChainConfig) (*MultiClient, error) {
+	if len(config.RPCEndpoints) == 0 {
+		return nil, fmt.Errorf("at least one RPC endpoint is required")
+	}
+
+	return newFailoverClient(config, config.RPCEndpoints, func(url string) (BlockchainClient, error) {
+		endpointConfig := *config
+		endpointConfig.RPCEndpoint = url
+		endpointConfig.RPCEndpoints = nil
+		return NewCosmosSDKClient(&endpointConfig)
+	})
+}
+
+// newFailoverClient creates a client for every url with create and spreads
+// requests over them. Any client failing to be created fails them all
+func newFailoverClient(config *types.ChainConfig, urls []string, create func(url string) (BlockchainClient, error)) (*MultiClient, error) {
+	clients := make([]BlockchainClient, 0, len(urls))
+	for _, url := range urls {
+		client, err := create(url)
+		if err != nil {
+			for _, c := range clients {
+				c.Close()
+			}
+			return nil, fmt.Errorf("failed to create client for %s: %w", url, err)
+		}
+		clients = append(clients, client)
+	}
+
+	return newMultiClient(config, urls, clients), nil
+}
+
+// newMultiClient wraps already created clients, urls[i] naming clients[i]
+func newMultiClient(config *types.ChainConfig, urls []string, clients []BlockchainClient) *MultiClient {
+	endpoints := make([]*endpoint, len(clients))
+	for i, client := range clients {
+		endpoints[i] = &endpoint{url: urls[i], client: client}
+	}
+
+	return &MultiClient{
+		config:    config,
+		endpoints: endpoints,
+	}
+}
+
+// GetLatestBlockHeight gets the latest block height
+func (m *MultiClient) GetLatestBlockHeight(ctx context.Context) (int64, error) {
+	status, err := m.GetStatus(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return status.LatestHeight, nil
+}
+
+// GetStatus gets the node status from the healthiest endpoint. The earliest
+// height is the lowest one any endpoint has, since range fetches are routed
+// to the endpoints that keep the requested history
+func (m *MultiClient) GetStatus(ctx context.Context) (*types.NodeStatus, error) {
+	if err := m.check(ctx); err != nil {
+		return nil, err
+	}
+
+	var status *types.NodeStatus
+	err := m.try(ctx, 0, func(e *endpoint) (err error) {
+		status, err = e.client.GetStatus(ctx)
+		if err == nil && status.EarliestHeight > 0 {
+			e.setEarliestHeight(status.EarliestHeight)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Endpoints whose earliest height is unknown say nothing about it
+	for _, e := range m.endpoints {
+		if !e.available() {
+			continue
+		}
+		if earliest := e.earliest(); earliest > 0 && (status.EarliestHeight == 0 || earliest < status.EarliestHeight) {
+			status.EarliestHeight = earliest
+		}
+	}
+
+	return status, nil
+}
+
+// GetBlockByHeight gets block information by height
+func (m *MultiClient) GetBlockByHeight(ctx context.Context, height int64) (*types.BlockInfo, error) {
+	if err := m.check(ctx); err != nil {
+		return nil, err
+	}
+
+	var block *types.BlockInfo
+	err := m.try(ctx, height, func(e *endpoint) (err error) {
+		block, err = e.client.GetBlockByHeight(ctx, height)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return block, nil
+}
+
+// GetBlockRange gets a range of blocks. The range is split into chunks that
+// healthy endpoints pull from a shared queue, so faster endpoints take more
+// of the work, and chunks that fail are handed to another endpoint. Only
+// endpoints that keep the start of the range take part, so deep history is
+// fetched from archive nodes while pruned nodes serve recent ranges
+func (m *MultiClient) GetBlockRange(ctx context.Context, startHeight, endHeight int64) ([]*types.BlockInfo, error) {
+	if startHeight > endHeight {
+		return nil, fmt.Errorf("invalid range: start height %d > end height %d", startHeight, endHeight)
+	}
+
+	if err := m.check(ctx); err != nil {
+		return nil, err
+	}
+
+	type chunk struct {
+		index      int
+		start, end int64
+		attempts   int
+	}
+
+	numChunks := int((endHeight-startHeight)/rangeChunkSize) + 1
+	queue := make(chan *chunk, numChunks)
+	for i := 0; i < numChunks; i++ {
+		start := startHeight + int64(i)*rangeChunkSize
+		end := start + rangeChunkSize - 1
+		if end > endHeight {
+			end = endHeight
+		}
+		queue <- &chunk{index: i, start: start, end: end}
+	}
+
+	workers, err := m.serving(time.Now(), startHeight)
+	if err != nil {
+		return nil, err
+	}
+	maxAttempts := 2 * len(m.endpoints)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([][]*types.BlockInfo, numChunks)
+	var (
+		mu       sync.Mutex
+		pending  = numChunks
+		active   = len(workers)
+		firstErr error
+	)
+
+	// fail stops all workers with err unless an error was already recorded
+	fail := func(err error) {
+		if firstErr == nil {
+			firstErr = err
+		}
+		cancel()
+	}
+
+	var wg sync.WaitGroup
+	for _, e := range workers {
+		wg.Add(1)
+		go func(e *endpoint) {
+			defer wg.Done()
+			defer func() {
+				mu.Lock()
+				defer mu.Unlock()
+				active--
+				if active == 0 && pending > 0 {
+					fail(fmt.Errorf("no healthy endpoints left with %d chunks pending", pending))
+				}
+			}()
+
+			for {
+				var c *chunk
+				select {
+				case <-ctx.Done():
+					return
+				case c = <-queue:
+				}
+
+				// Chunk durations depend on the chunk size, so only errors are recorded
+				blocks, err := e.client.GetBlockRange(ctx, c.start, c.end)
+				e.record(0, err)
+
+				mu.Lock()
+				if err == nil {
+					results[c.index] = blocks
+					pending--
+					if pending == 0 {
+						cancel()
+					}
+					mu.Unlock()
+					continue
+				}
+
+				if ctx.Err() != nil {
+					mu.Unlock()
+					return
+				}
+
+				c.attempts++
+				if c.attempts >= maxAttempts {
+					fail(fmt.Errorf("failed to get blocks %d-%d from %s: %w", c.start, c.end, e.url, err))
+					mu.Unlock()
+					return
+				}
+				queue <- c
+				mu.Unlock()
+
+				// Leave the remaining work to the others once this endpoint is ejected
+				if !e.healthy(time.Now()) {
+					return
+				}
+			}
+		}(e)
+	}
+	wg.Wait()
+
+	if pending > 0 {
+		if firstErr != nil {
+			return nil, firstErr
+		}
+		return nil, ctx.Err()
+	}
+
+	// Join the chunks and recalculate block times across chunk boundaries
+	blocks := make([]*types.BlockInfo, 0, endHeight-startHeight+1)
+	for _, chunkBlocks := range results {
+		if len(chunkBlocks) > 0 && len(blocks) > 0 {
+			chunkBlocks[0].BlockTime = chunkBlocks[0].Time.Sub(blocks[len(blocks)-1].Time).Seconds()
+		}
+		blocks = append(blocks, chunkBlocks...)
+	}
+
+	return blocks, nil
+}
+
+// StreamBlockRange streams a range of blocks with two chunks in flight per
+// endpoint that keeps the start of the range, so every one of them stays busy
+func (m *MultiClient) StreamBlockRange(ctx context.Context, startHeight, endHeight int64, opts StreamOptions) (<-chan *types.BlockInfo, <-chan error) {
+	if opts.Window <= 0 {
+		if err := m.check(ctx); err != nil {
+			return failedStream(err)
+		}
+		serving, err := m.serving(time.Now(), startHeight)
+		if err != nil {
+			return failedStream(err)
+		}
+		opts.Window = max(2*len(serving), defaultStreamWindow)
+	}
+
+	return StreamChunks(ctx, m, startHeight, endHeight, opts)
+}
+
+// SubscribeNewBlocks subscribes to new blocks on the healthiest endpoint that supports subscriptions
+func (m *MultiClient) SubscribeNewBlocks(ctx context.Context) (<-chan *types.BlockInfo, <-chan error) {
+	for _, e := range m.ordered(time.Now()) {
+		if subscriber, ok := FindSubscriber(e.client); ok {
+			return subscriber.SubscribeNewBlocks(ctx)
+		}
+	}
+
+	return failedStream(fmt.Errorf("no available endpoint supports subscriptions"))
+}
+
+// GetValidatorSet gets the validator set of height from the healthiest endpoint that has it
+func (m *MultiClient) GetValidatorSet(ctx context.Context, height int64) ([]types.ValidatorInfo, error) {
+	if err := m.check(ctx); err != nil {
+		return nil, err
+	}
+
+	var set []types.ValidatorInfo
+	err := m.try(ctx, height, func(e *endpoint) (err error) {
+		sets, ok := findClient[ValidatorSetClient](e.client)
+		if !ok {
+			return fmt.Errorf("validator sets are not available")
+		}
+		set, err = sets.GetValidatorSet(ctx, height)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// GetStakingValidators queries the staking module on the healthiest endpoint
+func (m *MultiClient) GetStakingValidators(ctx context.Context) ([]types.ValidatorInfo, error) {
+	if err := m.check(ctx); err != nil {
+		return nil, err
+	}
+
+	var described []types.ValidatorInfo
+	err := m.try(ctx, 0, func(e *endpoint) (err error) {
+		staking, ok := findClient[StakingClient](e.client)
+		if !ok {
+			return fmt.Errorf("the staking module cannot be queried")
+		}
+		described, err = staking.GetStakingValidators(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return described, nil
+}
+
+// Stats returns the request and retry counters summed over all endpoints
+func (m *MultiClient) Stats() Stats {
+	var total Stats
+	for _, e := range m.endpoints {
+		if statsProvider, ok := e.client.(StatsProvider); ok {
+			stats := statsProvider.Stats()
+			total.Requests += stats.Requests
+			total.Retries += stats.Retries
+			total.Failures += stats.Failures
+			total.Throttles += stats.Throttles
+			total.Concurrency += stats.Concurrency
+		}
+	}
+	return total
+}
+
+// EndpointStats returns the observed health of every endpoint
+func (m *MultiClient) EndpointStats() []EndpointStats {
+	now := time.Now()
+	stats := make([]EndpointStats, len(m.endpoints))
+	for i, e := range m.endpoints {
+		stats[i] = e.stats(now)
+	}
+	return stats
+}
+
+// Close closes all endpoint clients
+func (m *MultiClient) Close() error {
+	var errs []error
+	for _, e := range m.endpoints {
+		if err := e.client.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", e.url, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// check verifies once that the endpoints serve the same chain and are close
+// to the same height. Endpoints on another chain are disabled, lagging ones ejected
+func (m *MultiClient) check(ctx context.Context) error {
+	m.checkOnce.Do(func() {
+		m.checkErr = m.checkAgreement(ctx)
+	})
+	return m.checkErr
+}
+
+func (m *MultiClient) checkAgreement(ctx context.Context) error {
+	statuses := make([]*types.NodeStatus, len(m.endpoints))
+
+	var wg sync.WaitGroup
+	for i, e := range m.endpoints {
+		wg.Add(1)
+		go func(i int, e *endpoint) {
+			defer wg.Done()
+
+			start := time.Now()
+			status, err := e.client.GetStatus(ctx)
+			e.record(time.Since(start), err)
+			if err != nil {
+				e.eject()
+				return
+			}
+			statuses[i] = status
+		}(i, e)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// The chain ID served by most endpoints wins, ties go to the first configured
+	votes := make(map[string]int)
+	chainID := ""
+	for _, status := range statuses {
+		if status == nil {
+			continue
+		}
+		votes[status.ChainID]++
+		if chainID == "" || votes[status.ChainID] > votes[chainID] {
+			chainID = status.ChainID
+		}
+	}
+	if chainID == "" {
+		return fmt.Errorf("none of the %d endpoints responded", len(m.endpoints))
+	}
+
+	var maxHeight int64
+	for i, status := range statuses {
+		if status == nil {
+			continue
+		}
+		if status.ChainID != chainID {
+			m.endpoints[i].disable(fmt.Sprintf("serves chain %s, others serve %s", status.ChainID, chainID))
+			continue
+		}
+		m.endpoints[i].setEarliestHeight(status.EarliestHeight)
+		if status.LatestHeight > maxHeight {
+			maxHeight = status.LatestHeight
+		}
+	}
+
+	for i, status := range statuses {
+		if status != nil && status.ChainID == chainID && maxHeight-status.LatestHeight > maxHeightLag {
+			m.endpoints[i].eject()
+		}
+	}
+
+	return nil
+}
+
+// try runs fn against the endpoints that have height in order of preference
+// until one succeeds
+func (m *MultiClient) try(ctx context.Context, height int64, fn func(e *endpoint) error) error {
+	endpoints, err := m.serving(time.Now(), height)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, e := range endpoints {
+		start := time.Now()
+		err := fn(e)
+		e.record(time.Since(start), err)
+		if err == nil {
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", e.url, err))
+	}
+
+	return fmt.Errorf("all endpoints failed: %w", errors.Join(errs...))
+}
+
+// serving returns the endpoints to use for requests starting at height, best
+// first, or an error naming the earliest height available when none has it.
+// Endpoints whose earliest height is unknown come after those known to have
+// height, and are left out when any endpoint is known to have pruned it, as
+// they are likely pruned too
+func (m *MultiClient) serving(now time.Time, height int64) ([]*endpoint, error) {
+	endpoints := m.ordered(now)
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no available endpoints")
+	}
+
+	var serving, unknown []*endpoint
+	var earliest int64
+	for _, e := range endpoints {
+		has, known := e.hasHeight(height)
+		switch {
+		case has:
+			serving = append(serving, e)
+		case !known:
+			unknown = append(unknown, e)
+		case earliest == 0 || e.earliest() < earliest:
+			earliest = e.earliest()
+		}
+	}
+	if earliest == 0 {
+		serving = append(serving, unknown...)
+	}
+
+	if len(serving) == 0 {
+		return nil, fmt.Errorf("height %d is pruned on all endpoints, earliest available height is %d", height, earliest)
+	}
+	return serving, nil
+}
+
+// ordered returns the endpoints to use, best first. Healthy endpoints are
+// ranked by score; when none is healthy the ejected ones are returned,
+// those closest to the end of their ejection first
+func (m *MultiClient) ordered(now time.Time) []*endpoint {
+	var healthy, ejected []*endpoint
+	for _, e := range m.endpoints {
+		if !e.available() {
+			continue
+		}
+		if e.healthy(now) {
+			healthy = append(healthy, e)
+		} else {
+			ejected = append(ejected, e)
+		}
+	}
+
+	if len(healthy) > 0 {
+		sort.SliceStable(healthy, func(i, j int) bool {
+			return healthy[i].score() < healthy[j].score()
+		})
+		return healthy
+	}
+
+	sort.SliceStable(ejected, func(i, j int) bool {
+		ejected[i].mu.Lock()
+		until := ejected[i].ejectedUntil
+		ejected[i].mu.Unlock()
+
+		ejected[j].mu.Lock()
+		defer ejected[j].mu.Unlock()
+		return until.Before(ejected[j].ejectedUntil)
+	})
+	return ejected
+}
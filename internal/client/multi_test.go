@@ -0,0 +1,294 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/simulate"
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+// testChain generates a chain of blocks 6 seconds apart up to latest
+func testChain(t *testing.T, chainID string, latest int64) *simulate.Chain {
+	t.Helper()
+
+	chain, err := simulate.New(simulate.Spec{
+		ChainID:      chainID,
+		LatestHeight: latest,
+		BlockTime:    simulate.Distribution{Distribution: simulate.DistributionConstant, Mean: 6 * time.Second},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chain
+}
+
+// newTestNode serves a chain of testChainID up to latest
+func newTestNode(t *testing.T, latest int64) *simulate.Node {
+	return &simulate.Node{Chain: testChain(t, testChainID, latest)}
+}
+
+func newTestMultiClient(clients ...*simulate.Node) *MultiClient {
+	urls := make([]string, len(clients))
+	wrapped := make([]BlockchainClient, len(clients))
+	for i, c := range clients {
+		urls[i] = fmt.Sprintf("http://node%d:26657", i)
+		wrapped[i] = c
+	}
+	return newMultiClient(&types.ChainConfig{}, urls, wrapped)
+}
+
+func TestEndpointEjection(t *testing.T) {
+	e := &endpoint{url: "http://node:26657"}
+	now := time.Now()
+	failure := errors.New("connection refused")
+
+	for i := 1; i < ejectAfterFailures; i++ {
+		e.record(time.Millisecond, failure)
+		if !e.healthy(now) {
+			t.Fatalf("ejected after %d failures, want %d", i, ejectAfterFailures)
+		}
+	}
+
+	// Cancelled requests say nothing about the endpoint
+	e.record(0, context.Canceled)
+	if !e.healthy(now) {
+		t.Fatal("ejected after a cancelled request")
+	}
+
+	e.record(time.Millisecond, failure)
+	if e.healthy(time.Now()) {
+		t.Fatalf("still healthy after %d failures", ejectAfterFailures)
+	}
+	if until := e.ejectedUntil; until.Sub(now) < baseEjectDuration-time.Second {
+		t.Errorf("ejected for %s, want %s", until.Sub(now), baseEjectDuration)
+	}
+	if stats := e.stats(time.Now()); !strings.HasPrefix(stats.Status, "ejected") || stats.Errors != ejectAfterFailures {
+		t.Errorf("got stats %+v", stats)
+	}
+
+	// A single failure after the ejection ends ejects again, twice as long
+	after := e.ejectedUntil.Add(time.Second)
+	if !e.healthy(after) {
+		t.Fatal("not healthy after the ejection ended")
+	}
+	e.record(time.Millisecond, failure)
+	if e.ejections != 2 || e.ejectedUntil.Sub(time.Now()) < 2*baseEjectDuration-time.Second {
+		t.Errorf("got %d ejections until %s, want 2 for %s", e.ejections, e.ejectedUntil, 2*baseEjectDuration)
+	}
+
+	// Ejections are capped
+	for i := 0; i < 10; i++ {
+		e.eject()
+	}
+	if d := e.ejectedUntil.Sub(time.Now()); d > maxEjectDuration {
+		t.Errorf("ejected for %s, more than %s", d, maxEjectDuration)
+	}
+}
+
+func TestMultiClientCheckAgreement(t *testing.T) {
+	good := newTestNode(t, 1000)
+	lagging := newTestNode(t, 1000-maxHeightLag-1)
+	otherChain := &simulate.Node{Chain: testChain(t, "other-1", 1000)}
+	down := newTestNode(t, 1000)
+	down.Err = errors.New("connection refused")
+
+	m := newTestMultiClient(good, lagging, otherChain, down)
+	if _, err := m.GetStatus(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := m.EndpointStats()
+	want := []string{"healthy", "ejected", "disabled: serves chain other-1", "ejected"}
+	for i, prefix := range want {
+		if !strings.HasPrefix(stats[i].Status, prefix) {
+			t.Errorf("endpoint %d: got status %q, want %q", i, stats[i].Status, prefix)
+		}
+	}
+}
+
+func TestMultiClientNoEndpointResponds(t *testing.T) {
+	a, b := newTestNode(t, 100), newTestNode(t, 100)
+	a.Err = errors.New("connection refused")
+	b.Err = errors.New("connection refused")
+
+	m := newTestMultiClient(a, b)
+	if _, err := m.GetStatus(context.Background()); err == nil || !strings.Contains(err.Error(), "none of the 2 endpoints") {
+		t.Fatalf("got error %v", err)
+	}
+}
+
+func TestMultiClientFailover(t *testing.T) {
+	flaky := newTestNode(t, 1000)
+	healthy := newTestNode(t, 1000)
+	m := newTestMultiClient(flaky, healthy)
+	ctx := context.Background()
+
+	if _, err := m.GetStatus(ctx); err != nil {
+		t.Fatal(err)
+	}
+	flaky.Err = errors.New("connection reset")
+
+	for i := 0; i < ejectAfterFailures+2; i++ {
+		block, err := m.GetBlockByHeight(ctx, 500)
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		if block.Height != 500 {
+			t.Fatalf("got block %d, want 500", block.Height)
+		}
+	}
+
+	// The failing endpoint is ranked down or ejected before it sees many requests
+	if calls := len(flaky.Ranges()); calls > ejectAfterFailures {
+		t.Errorf("ejected endpoint got %d requests, want at most %d", calls, ejectAfterFailures)
+	}
+}
+
+func TestMultiClientGetBlockRange(t *testing.T) {
+	clients := []*simulate.Node{newTestNode(t, 5000), newTestNode(t, 5000), newTestNode(t, 5000)}
+	m := newTestMultiClient(clients...)
+	if _, err := m.GetStatus(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Chunks failing on one endpoint are handed to the others
+	clients[1].Err = errors.New("connection reset")
+	blocks, err := m.GetBlockRange(context.Background(), 10, 2009)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 2000 {
+		t.Fatalf("got %d blocks, want 2000", len(blocks))
+	}
+	for i, block := range blocks {
+		if block.Height != 10+int64(i) {
+			t.Fatalf("block %d has height %d", i, block.Height)
+		}
+		// Block times are recalculated across chunk boundaries
+		if i > 0 && block.BlockTime != 6 {
+			t.Fatalf("block %d has block time %v, want 6", block.Height, block.BlockTime)
+		}
+	}
+
+	for _, c := range clients {
+		for _, r := range c.Ranges() {
+			if r[1]-r[0]+1 > rangeChunkSize {
+				t.Errorf("chunk %d-%d is larger than %d", r[0], r[1], rangeChunkSize)
+			}
+		}
+	}
+}
+
+func TestMultiClientGetBlockRangeAllFailing(t *testing.T) {
+	a, b := newTestNode(t, 1000), newTestNode(t, 1000)
+	m := newTestMultiClient(a, b)
+	if _, err := m.GetStatus(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	a.Err = errors.New("connection reset")
+	b.Err = errors.New("connection reset")
+
+	_, err := m.GetBlockRange(context.Background(), 1, 900)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if !strings.Contains(err.Error(), "connection reset") && !strings.Contains(err.Error(), "no healthy endpoints left") {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestMultiClientServingWindow(t *testing.T) {
+	pruned := newTestNode(t, 10000)
+	pruned.Earliest = 8000
+	archive := newTestNode(t, 10000)
+
+	m := newTestMultiClient(pruned, archive)
+	ctx := context.Background()
+
+	status, err := m.GetStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.EarliestHeight != 1 {
+		t.Errorf("got earliest height %d, want the archive's 1", status.EarliestHeight)
+	}
+
+	// Deep history only goes to the archive node
+	blocks, err := m.GetBlockRange(ctx, 100, 1099)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 1000 {
+		t.Fatalf("got %d blocks, want 1000", len(blocks))
+	}
+	if calls := pruned.Ranges(); len(calls) != 0 {
+		t.Errorf("pruned node was asked for %v", calls)
+	}
+
+	if _, err := m.GetBlockByHeight(ctx, 50); err != nil {
+		t.Fatal(err)
+	}
+	if calls := pruned.Ranges(); len(calls) != 0 {
+		t.Errorf("pruned node was asked for %v", calls)
+	}
+
+	// Recent blocks may come from either
+	if _, err := m.GetBlockRange(ctx, 9000, 9999); err != nil {
+		t.Fatal(err)
+	}
+
+	// Once the archive node is gone, deep history is reported as pruned
+	m.endpoints[1].disable("test")
+	_, err = m.GetBlockRange(ctx, 100, 200)
+	if err == nil || !strings.Contains(err.Error(), "earliest available height is 8000") {
+		t.Errorf("got error %v, want the earliest available height", err)
+	}
+}
+
+func TestMultiClientUnknownEarliestHeight(t *testing.T) {
+	pruned := newTestNode(t, 10000)
+	pruned.Earliest = 8000
+	down := newTestNode(t, 10000)
+	down.Err = errors.New("connection refused")
+
+	m := newTestMultiClient(pruned, down)
+	ctx := context.Background()
+
+	// The endpoint that was down when the endpoints were checked comes back
+	// without reporting its earliest height, like gRPC and REST endpoints
+	if _, err := m.GetStatus(ctx); err != nil {
+		t.Fatal(err)
+	}
+	down.Err = nil
+	down.NoEarliest = true
+	m.endpoints[1].mu.Lock()
+	m.endpoints[1].ejectedUntil = time.Time{}
+	m.endpoints[1].mu.Unlock()
+
+	status, err := m.GetStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.EarliestHeight != 8000 {
+		t.Errorf("got earliest height %d, want the pruned node's 8000", status.EarliestHeight)
+	}
+
+	// Heights the pruned node lacks are not trusted to the unknown endpoint
+	_, err = m.GetBlockRange(ctx, 100, 200)
+	if err == nil || !strings.Contains(err.Error(), "earliest available height is 8000") {
+		t.Errorf("got error %v, want the earliest available height", err)
+	}
+	if calls := down.Ranges(); len(calls) != 0 {
+		t.Errorf("endpoint of unknown history was asked for %v", calls)
+	}
+
+	// Recent heights may come from either
+	if _, err := m.GetBlockRange(ctx, 9000, 9999); err != nil {
+		t.Fatal(err)
+	}
+}
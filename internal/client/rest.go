@@ -0,0 +1,416 @@
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	cmtbytes "github.com/cometbft/cometbft/libs/bytes"
+	tmproto "github.com/cometbft/cometbft/proto/tendermint/types"
+	tmtypes "github.com/cometbft/cometbft/types"
+	"github.com/cosmos/cosmos-sdk/types/bech32"
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+// restBasePath is the REST gateway path of the Cosmos SDK tendermint service
+const restBasePath = "/cosmos/base/tendermint/v1beta1"
+
+// maxRESTErrorBody limits how much of an error response ends up in the error message
+const maxRESTErrorBody = 512
+
+// restBlockResponse is the JSON form of GetBlockByHeightResponse and GetLatestBlockResponse
+type restBlockResponse struct {
+	BlockID struct {
+		Hash string `json:"hash"`
+	} `json:"block_id"`
+	Block    *restBlock `json:"block"`
+	SdkBlock *restBlock `json:"sdk_block"`
+}
+
+type restBlock struct {
+	Header struct {
+		Height      string    `json:"height"`
+		Time        time.Time `json:"time"`
+		LastBlockID struct {
+			Hash string `json:"hash"`
+		} `json:"last_block_id"`
+		ProposerAddress string `json:"proposer_address"`
+	} `json:"header"`
+	Data struct {
+		Txs []string `json:"txs"`
+	} `json:"data"`
+	LastCommit *restCommit `json:"last_commit"`
+}
+
+type restCommit struct {
+	Height     string `json:"height"`
+	Round      int32  `json:"round"`
+	Signatures []struct {
+		BlockIDFlag      restBlockIDFlag `json:"block_id_flag"`
+		ValidatorAddress string          `json:"validator_address"`
+	} `json:"signatures"`
+}
+
+// restBlockIDFlag is a block ID flag, which gateways encode by enum name or number
+type restBlockIDFlag tmtypes.BlockIDFlag
+
+func (f *restBlockIDFlag) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		var number int32
+		if err := json.Unmarshal(data, &number); err != nil {
+			return fmt.Errorf("invalid block ID flag %s", data)
+		}
+		*f = restBlockIDFlag(number)
+		return nil
+	}
+
+	number, ok := tmproto.BlockIDFlag_value[name]
+	if !ok {
+		return fmt.Errorf("unknown block ID flag %q", name)
+	}
+	*f = restBlockIDFlag(number)
+	return nil
+}
+
+// restValidatorSetResponse is the JSON form of GetValidatorSetByHeightResponse
+type restValidatorSetResponse struct {
+	Validators []struct {
+		Address     string `json:"address"`
+		VotingPower string `json:"voting_power"`
+	} `json:"validators"`
+	Pagination *struct {
+		Total string `json:"total"`
+	} `json:"pagination"`
+}
+
+// restStakingValidatorsResponse is the JSON form of the staking QueryValidatorsResponse
+type restStakingValidatorsResponse struct {
+	Validators []struct {
+		OperatorAddress string `json:"operator_address"`
+		ConsensusPubkey struct {
+			Type string `json:"@type"`
+			Key  []byte `json:"key"`
+		} `json:"consensus_pubkey"`
+		Description struct {
+			Moniker string `json:"moniker"`
+		} `json:"description"`
+	} `json:"validators"`
+	Pagination *struct {
+		NextKey []byte `json:"next_key"`
+	} `json:"pagination"`
+}
+
+// restSyncingResponse is the JSON form of GetSyncingResponse
+type restSyncingResponse struct {
+	Syncing bool `json:"syncing"`
+}
+
+// restNodeInfoResponse is the JSON form of GetNodeInfoResponse
+type restNodeInfoResponse struct {
+	DefaultNodeInfo *struct {
+		Network string `json:"network"`
+	} `json:"default_node_info"`
+}
+
+// RESTClient implements BlockchainClient over the Cosmos SDK REST (LCD) gateway
+type RESTClient struct {
+	config  *types.ChainConfig
+	baseURL string
+	http    *http.Client
+	retry   *retrier
+
+	validators *commitValidators // nil unless commits are recorded
+}
+
+// NewRESTClient creates a new REST blockchain client
+func NewRESTClient(config *types.ChainConfig) (*RESTClient, error) {
+	if config.RESTEndpoint == "" {
+		return nil, fmt.Errorf("REST endpoint is required")
+	}
+
+	applyDefaults(config)
+
+	baseURL := strings.TrimSuffix(config.RESTEndpoint, "/")
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "http://" + baseURL
+	}
+
+	c := &RESTClient{
+		config:  config,
+		baseURL: baseURL,
+		http:    &http.Client{},
+		retry:   newRetrier(config, baseURL),
+	}
+	if config.Commits {
+		c.validators = newCommitValidators(config, c.getValidators)
+	}
+	return c, nil
+}
+
+// GetLatestBlockHeight gets the latest block height
+func (c *RESTClient) GetLatestBlockHeight(ctx context.Context) (int64, error) {
+	block, err := c.getBlock(ctx, "latest")
+	if err != nil {
+		return 0, fmt.Errorf("failed to get latest block: %w", err)
+	}
+
+	return block.Height, nil
+}
+
+// GetStatus gets the chain ID, latest height and sync state of the node. The
+// gateway does not report the earliest available height, so EarliestHeight is left unknown
+func (c *RESTClient) GetStatus(ctx context.Context) (*types.NodeStatus, error) {
+	var resp restNodeInfoResponse
+	if err := c.get(ctx, restBasePath+"/node_info", &resp); err != nil {
+		return nil, fmt.Errorf("failed to get node info: %w", err)
+	}
+	if resp.DefaultNodeInfo == nil {
+		return nil, fmt.Errorf("node info response without node info")
+	}
+
+	var syncing restSyncingResponse
+	if err := c.get(ctx, restBasePath+"/syncing", &syncing); err != nil {
+		return nil, fmt.Errorf("failed to get sync state: %w", err)
+	}
+
+	latestHeight, err := c.GetLatestBlockHeight(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.NodeStatus{
+		ChainID:      resp.DefaultNodeInfo.Network,
+		LatestHeight: latestHeight,
+		CatchingUp:   syncing.Syncing,
+	}, nil
+}
+
+// GetBlockByHeight gets block information by height
+func (c *RESTClient) GetBlockByHeight(ctx context.Context, height int64) (*types.BlockInfo, error) {
+	block, err := c.getBlock(ctx, strconv.FormatInt(height, 10))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get block at height %d: %w", height, err)
+	}
+
+	return block, nil
+}
+
+// getValidators fetches the validator set of height page by page
+func (c *RESTClient) getValidators(ctx context.Context, height int64) ([]validatorPower, error) {
+	var set []validatorPower
+	for {
+		var resp restValidatorSetResponse
+		path := fmt.Sprintf("%s/validatorsets/%d?pagination.offset=%d&pagination.limit=%d", restBasePath, height, len(set), maxValidatorsPerPage)
+		if err := c.get(ctx, path, &resp); err != nil {
+			return nil, err
+		}
+
+		for _, val := range resp.Validators {
+			_, address, err := bech32.DecodeAndConvert(val.Address)
+			if err != nil {
+				return nil, fmt.Errorf("invalid validator address %q: %w", val.Address, err)
+			}
+			power, err := strconv.ParseInt(val.VotingPower, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid voting power of validator %s: %w", val.Address, err)
+			}
+			set = append(set, validatorPower{address: cmtbytes.HexBytes(address).String(), power: power})
+		}
+		if len(resp.Validators) == 0 || resp.Pagination == nil {
+			return set, nil
+		}
+		if total, err := strconv.Atoi(resp.Pagination.Total); err != nil || len(set) >= total {
+			return set, nil
+		}
+	}
+}
+
+// GetValidatorSet gets the validator set of height
+func (c *RESTClient) GetValidatorSet(ctx context.Context, height int64) ([]types.ValidatorInfo, error) {
+	set, err := c.getValidators(ctx, height)
+	if err != nil {
+		return nil, err
+	}
+	return validatorInfos(set), nil
+}
+
+// GetStakingValidators queries the validators of the staking module page by
+// page. Validators whose consensus key cannot be decoded are left out
+func (c *RESTClient) GetStakingValidators(ctx context.Context) ([]types.ValidatorInfo, error) {
+	var described []types.ValidatorInfo
+	var next []byte
+	for {
+		path := fmt.Sprintf("/cosmos/staking/v1beta1/validators?pagination.limit=%d", maxValidatorsPerPage)
+		if len(next) > 0 {
+			path += "&pagination.key=" + url.QueryEscape(base64.StdEncoding.EncodeToString(next))
+		}
+		var resp restStakingValidatorsResponse
+		if err := c.get(ctx, path, &resp); err != nil {
+			return nil, err
+		}
+
+		for _, val := range resp.Validators {
+			address, err := consensusAddress(val.ConsensusPubkey.Type, val.ConsensusPubkey.Key)
+			if err != nil {
+				continue
+			}
+			described = append(described, types.ValidatorInfo{
+				Address:         address,
+				Moniker:         val.Description.Moniker,
+				OperatorAddress: val.OperatorAddress,
+			})
+		}
+		if len(resp.Validators) == 0 || resp.Pagination == nil || len(resp.Pagination.NextKey) == 0 {
+			return described, nil
+		}
+		next = resp.Pagination.NextKey
+	}
+}
+
+// GetBlockRange gets a range of blocks. The gateway has no batch call, so
+// blocks are fetched one by one with controlled concurrency
+func (c *RESTClient) GetBlockRange(ctx context.Context, startHeight, endHeight int64) ([]*types.BlockInfo, error) {
+	return getBlockRangeByHeight(ctx, c, startHeight, endHeight, c.config.MaxConcurrency)
+}
+
+// Stats returns the request and retry counters of the client
+func (c *RESTClient) Stats() Stats {
+	return c.retry.stats()
+}
+
+// Close closes the client
+func (c *RESTClient) Close() error {
+	c.http.CloseIdleConnections()
+	return nil
+}
+
+// getBlock fetches /blocks/{height}, where height may also be "latest"
+func (c *RESTClient) getBlock(ctx context.Context, height string) (*types.BlockInfo, error) {
+	var resp restBlockResponse
+	if err := c.get(ctx, restBasePath+"/blocks/"+height, &resp); err != nil {
+		return nil, err
+	}
+
+	block, err := blockInfoFromREST(resp.BlockID.Hash, resp.Block, resp.SdkBlock)
+	if err != nil || !c.config.Commits {
+		return block, err
+	}
+
+	raw := resp.Block
+	if raw == nil {
+		raw = resp.SdkBlock
+	}
+	if raw.LastCommit != nil {
+		if err := c.recordCommit(ctx, block, raw.LastCommit); err != nil {
+			return nil, err
+		}
+	}
+	return block, nil
+}
+
+// recordCommit sets the last commit of block from its JSON form
+func (c *RESTClient) recordCommit(ctx context.Context, block *types.BlockInfo, commit *restCommit) error {
+	height, err := strconv.ParseInt(commit.Height, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid commit height %q in block %d: %w", commit.Height, block.Height, err)
+	}
+
+	votes := make([]commitVote, len(commit.Signatures))
+	for i, sig := range commit.Signatures {
+		address, err := base64.StdEncoding.DecodeString(sig.ValidatorAddress)
+		if err != nil {
+			return fmt.Errorf("invalid validator address in the commit of block %d: %w", block.Height, err)
+		}
+		votes[i] = commitVote{flag: tmtypes.BlockIDFlag(sig.BlockIDFlag), address: cmtbytes.HexBytes(address).String()}
+	}
+
+	c.validators.record(ctx, block, height, commit.Round, votes)
+	return nil
+}
+
+// get requests path with retries and decodes the JSON response into v
+func (c *RESTClient) get(ctx context.Context, path string, v any) error {
+	return c.retry.do(ctx, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "application/json")
+
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, maxRESTErrorBody))
+			return &httpStatusError{Code: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+		}
+
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+		return nil
+	})
+}
+
+// blockInfoFromREST converts a gateway block into BlockInfo. Byte fields are
+// base64 in JSON and converted to the hex used by the RPC client; the SDK
+// block reports the proposer as a bech32 consensus address instead
+func blockInfoFromREST(blockHash string, block, sdkBlock *restBlock) (*types.BlockInfo, error) {
+	bech32Proposer := false
+	if block == nil {
+		block = sdkBlock
+		bech32Proposer = true
+	}
+	if block == nil {
+		return nil, fmt.Errorf("response without block")
+	}
+
+	height, err := strconv.ParseInt(block.Header.Height, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid block height %q: %w", block.Header.Height, err)
+	}
+
+	hash, err := base64.StdEncoding.DecodeString(blockHash)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hash of block %d: %w", height, err)
+	}
+
+	parentHash, err := base64.StdEncoding.DecodeString(block.Header.LastBlockID.Hash)
+	if err != nil {
+		return nil, fmt.Errorf("invalid parent hash in block %d: %w", height, err)
+	}
+
+	var proposer string
+	if bech32Proposer {
+		proposer = block.Header.ProposerAddress
+		if _, address, err := bech32.DecodeAndConvert(proposer); err == nil {
+			proposer = cmtbytes.HexBytes(address).String()
+		}
+	} else {
+		address, err := base64.StdEncoding.DecodeString(block.Header.ProposerAddress)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proposer address in block %d: %w", height, err)
+		}
+		proposer = cmtbytes.HexBytes(address).String()
+	}
+
+	return &types.BlockInfo{
+		Height:     height,
+		Time:       block.Header.Time,
+		Hash:       cmtbytes.HexBytes(hash).String(),
+		ParentHash: cmtbytes.HexBytes(parentHash).String(),
+		Proposer:   proposer,
+		TxCount:    len(block.Data.Txs),
+	}, nil
+}
@@ -0,0 +1,462 @@
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tmtypes "github.com/cometbft/cometbft/types"
+	"github.com/cosmos/cosmos-sdk/types/bech32"
+	"github.com/cosmos/cosmos-sdk/types/query"
+	stakingtypes "github.com/cosmos/cosmos-sdk/x/staking/types"
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+// lcdServer is a Cosmos SDK REST gateway stand-in serving the tendermint service
+type lcdServer struct {
+	*httptest.Server
+
+	metas   []*tmtypes.BlockMeta
+	sdkOnly bool // answer with sdk_block only, like newer gateways
+	commits bool // blocks carry testCommit, signed by testValidators
+	pageCap int  // largest page of staking validators served when set
+
+	mu       sync.Mutex
+	requests map[string]int
+	throttle int    // number of requests answered with 429 before serving
+	status   int    // status of every response when set
+	body     string // raw body of every response when set
+}
+
+func newLCDServer(t *testing.T, metas []*tmtypes.BlockMeta) *lcdServer {
+	s := &lcdServer{metas: metas, requests: make(map[string]int)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *lcdServer) handle(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, restBasePath)
+
+	s.mu.Lock()
+	s.requests[path]++
+	throttled := s.throttle > 0
+	if throttled {
+		s.throttle--
+	}
+	status, body := s.status, s.body
+	s.mu.Unlock()
+
+	switch {
+	case throttled:
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+		return
+	case status != 0:
+		http.Error(w, body, status)
+		return
+	case body != "":
+		w.Write([]byte(body))
+		return
+	}
+
+	var resp any
+	switch {
+	case path == "/node_info":
+		resp = map[string]any{"default_node_info": map[string]string{"network": testChainID}}
+	case path == "/syncing":
+		resp = map[string]bool{"syncing": false}
+	case strings.HasPrefix(path, "/blocks/"):
+		height := int64(len(s.metas))
+		if param := strings.TrimPrefix(path, "/blocks/"); param != "latest" {
+			height, _ = strconv.ParseInt(param, 10, 64)
+		}
+		if height < 1 || height > int64(len(s.metas)) {
+			http.Error(w, `{"code":3,"message":"requested block height is bigger then the chain length"}`, http.StatusBadRequest)
+			return
+		}
+		resp = s.block(s.metas[height-1])
+	case strings.HasPrefix(path, "/validatorsets/"):
+		resp = s.validatorSet(r.URL.Query())
+	case path == "/cosmos/staking/v1beta1/validators":
+		resp = s.stakingValidators(r.URL.Query())
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	json.NewEncoder(w).Encode(resp)
+}
+
+// block renders meta like the gateway does: bytes as base64, integers as strings
+func (s *lcdServer) block(meta *tmtypes.BlockMeta) map[string]any {
+	proposer := base64.StdEncoding.EncodeToString(meta.Header.ProposerAddress)
+	key := "block"
+	if s.sdkOnly {
+		proposer, _ = bech32.ConvertAndEncode("cosmosvalcons", meta.Header.ProposerAddress)
+		key = "sdk_block"
+	}
+
+	block := map[string]any{
+		"header": map[string]any{
+			"height":           strconv.FormatInt(meta.Header.Height, 10),
+			"time":             meta.Header.Time.Format(time.RFC3339Nano),
+			"last_block_id":    map[string]string{"hash": base64.StdEncoding.EncodeToString(meta.Header.LastBlockID.Hash)},
+			"proposer_address": proposer,
+		},
+		"data": map[string]any{"txs": make([]string, meta.NumTxs)},
+	}
+	if s.commits {
+		commit := testCommit(meta.Header.Height - 1)
+		var signatures []map[string]string
+		for _, sig := range commit.Signatures {
+			signatures = append(signatures, map[string]string{
+				"block_id_flag":     sig.BlockIdFlag.String(),
+				"validator_address": base64.StdEncoding.EncodeToString(sig.ValidatorAddress),
+			})
+		}
+		block["last_commit"] = map[string]any{
+			"height":     strconv.FormatInt(commit.Height, 10),
+			"round":      commit.Round,
+			"signatures": signatures,
+		}
+	}
+
+	return map[string]any{
+		"block_id": map[string]string{"hash": base64.StdEncoding.EncodeToString(meta.BlockID.Hash)},
+		key:        block,
+	}
+}
+
+// validatorSet renders the page of testValidators that query asks for
+func (s *lcdServer) validatorSet(query url.Values) map[string]any {
+	set := testValidators()
+	offset, _ := strconv.Atoi(query.Get("pagination.offset"))
+	limit, _ := strconv.Atoi(query.Get("pagination.limit"))
+
+	var validators []map[string]string
+	for _, val := range set[min(offset, len(set)):min(offset+limit, len(set))] {
+		address, _ := hex.DecodeString(val.address)
+		consAddress, _ := bech32.ConvertAndEncode("cosmosvalcons", address)
+		validators = append(validators, map[string]string{
+			"address":      consAddress,
+			"voting_power": strconv.FormatInt(val.power, 10),
+		})
+	}
+	return map[string]any{
+		"validators": validators,
+		"pagination": map[string]any{"next_key": nil, "total": strconv.Itoa(len(set))},
+	}
+}
+
+// stakingValidators renders the page of testStakingValidators that params
+// ask for, with consensus keys as the gateway renders them
+func (s *lcdServer) stakingValidators(params url.Values) map[string]any {
+	limit, _ := strconv.ParseUint(params.Get("pagination.limit"), 10, 64)
+	if s.pageCap != 0 {
+		limit = min(limit, uint64(s.pageCap))
+	}
+	key, _ := base64.StdEncoding.DecodeString(params.Get("pagination.key"))
+	page := stakingPage(&stakingtypes.QueryValidatorsRequest{Pagination: &query.PageRequest{Key: key, Limit: limit}})
+
+	var validators []map[string]any
+	for _, val := range page.Validators {
+		pubkey := map[string]any{"@type": val.ConsensusPubkey.TypeUrl}
+		if key, err := consensusKey(val.ConsensusPubkey); err == nil {
+			pubkey["key"] = key
+		}
+		validators = append(validators, map[string]any{
+			"operator_address": val.OperatorAddress,
+			"consensus_pubkey": pubkey,
+			"description":      map[string]string{"moniker": val.Description.Moniker},
+		})
+	}
+	return map[string]any{
+		"validators": validators,
+		"pagination": map[string]any{"next_key": page.Pagination.NextKey, "total": strconv.FormatUint(page.Pagination.Total, 10)},
+	}
+}
+
+func (s *lcdServer) requestCount(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+func newTestRESTClient(t *testing.T, url string) *RESTClient {
+	c, err := NewRESTClient(&types.ChainConfig{
+		RESTEndpoint:   url + "/",
+		Timeout:        5 * time.Second,
+		MaxRetries:     2,
+		RetryDelay:     time.Millisecond,
+		MaxConcurrency: 4,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestRESTClientGetStatus(t *testing.T) {
+	server := newLCDServer(t, testChain(25))
+	c := newTestRESTClient(t, server.URL)
+
+	status, err := c.GetStatus(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.ChainID != testChainID || status.LatestHeight != 25 || status.CatchingUp {
+		t.Errorf("got status %+v", status)
+	}
+}
+
+func TestRESTClientGetBlockByHeight(t *testing.T) {
+	metas := testChain(25)
+
+	for _, sdkOnly := range []bool{false, true} {
+		t.Run("sdk_block="+strconv.FormatBool(sdkOnly), func(t *testing.T) {
+			server := newLCDServer(t, metas)
+			server.sdkOnly = sdkOnly
+			c := newTestRESTClient(t, server.URL)
+
+			block, err := c.GetBlockByHeight(context.Background(), 9)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			meta := metas[8]
+			if block.Height != 9 || !block.Time.Equal(meta.Header.Time) || block.TxCount != meta.NumTxs {
+				t.Errorf("got block %d at %s with %d txs", block.Height, block.Time, block.TxCount)
+			}
+			if block.Hash != meta.BlockID.Hash.String() || block.ParentHash != meta.Header.LastBlockID.Hash.String() {
+				t.Errorf("got hashes %s/%s", block.Hash, block.ParentHash)
+			}
+			// Both forms report the proposer as the hex address the RPC client uses
+			if block.Proposer != meta.Header.ProposerAddress.String() {
+				t.Errorf("got proposer %s, want %s", block.Proposer, meta.Header.ProposerAddress)
+			}
+		})
+	}
+}
+
+func TestRESTClientGetBlockRange(t *testing.T) {
+	server := newLCDServer(t, testChain(60))
+	c := newTestRESTClient(t, server.URL)
+
+	blocks, err := c.GetBlockRange(context.Background(), 3, 52)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 50 {
+		t.Fatalf("got %d blocks, want 50", len(blocks))
+	}
+	for i, block := range blocks {
+		if block.Height != 3+int64(i) {
+			t.Fatalf("block %d has height %d", i, block.Height)
+		}
+	}
+	if err := VerifyLinkage(blocks); err != nil {
+		t.Errorf("fetched blocks do not link: %v", err)
+	}
+}
+
+func TestRESTClientCommits(t *testing.T) {
+	for _, sdkOnly := range []bool{false, true} {
+		t.Run("sdk_block="+strconv.FormatBool(sdkOnly), func(t *testing.T) {
+			server := newLCDServer(t, testChain(20))
+			server.sdkOnly = sdkOnly
+			server.commits = true
+			c, err := NewRESTClient(&types.ChainConfig{
+				RESTEndpoint:   server.URL,
+				Timeout:        5 * time.Second,
+				MaxRetries:     2,
+				RetryDelay:     time.Millisecond,
+				MaxConcurrency: 4,
+				Commits:        true,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			blocks, err := c.GetBlockRange(context.Background(), 11, 20)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, block := range blocks {
+				if block.Commit == nil || *block.Commit != testCommitInfo {
+					t.Fatalf("got commit %+v in block %d, want %+v", block.Commit, block.Height, testCommitInfo)
+				}
+			}
+
+			// Two pages of validators, fetched once for all commits
+			var calls int
+			for height := 10; height < 20; height++ {
+				calls += server.requestCount(fmt.Sprintf("/validatorsets/%d", height))
+			}
+			if calls != 2 {
+				t.Errorf("got %d validator set requests, want 2", calls)
+			}
+		})
+	}
+}
+
+func TestRESTClientValidators(t *testing.T) {
+	server := newLCDServer(t, testChain(20))
+	server.pageCap = 3
+	c := newTestRESTClient(t, server.URL)
+
+	set, err := c.GetValidatorSet(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := testValidators()
+	if len(set) != len(want) {
+		t.Fatalf("got %d validators, want %d", len(set), len(want))
+	}
+	for i := range want {
+		if set[i].Address != want[i].address || set[i].VotingPower != want[i].power {
+			t.Errorf("got validator %+v, want %+v", set[i], want[i])
+		}
+	}
+
+	described, err := c.GetStakingValidators(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertStakingInfos(t, described)
+	if got := server.requestCount("/cosmos/staking/v1beta1/validators"); got != 2 {
+		t.Errorf("got %d staking validator requests, want 2", got)
+	}
+}
+
+func TestRESTClientErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		setup        func(s *lcdServer)
+		wantErr      string // empty for success
+		wantRequests int
+	}{
+		{
+			name:         "rate limited then served",
+			setup:        func(s *lcdServer) { s.throttle = 2 },
+			wantRequests: 3,
+		},
+		{
+			name:         "rate limited throughout",
+			setup:        func(s *lcdServer) { s.throttle = 10 },
+			wantErr:      "unexpected HTTP status 429 Too Many Requests",
+			wantRequests: 3,
+		},
+		{
+			name:         "server error",
+			setup:        func(s *lcdServer) { s.status = http.StatusBadGateway },
+			wantErr:      "unexpected HTTP status 502",
+			wantRequests: 3,
+		},
+		{
+			name:         "not found",
+			setup:        func(s *lcdServer) { s.status, s.body = http.StatusNotFound, `{"code":5,"message":"Not Implemented"}` },
+			wantErr:      `unexpected HTTP status 404 Not Found: {"code":5,"message":"Not Implemented"}`,
+			wantRequests: 1,
+		},
+		{
+			name:         "invalid JSON",
+			setup:        func(s *lcdServer) { s.body = "<html>" },
+			wantErr:      "failed to decode response",
+			wantRequests: 1,
+		},
+		{
+			name:         "no block",
+			setup:        func(s *lcdServer) { s.body = `{"block_id":{"hash":""}}` },
+			wantErr:      "response without block",
+			wantRequests: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newLCDServer(t, testChain(25))
+			tt.setup(server)
+			c := newTestRESTClient(t, server.URL)
+
+			block, err := c.GetBlockByHeight(context.Background(), 7)
+			if tt.wantErr == "" {
+				if err != nil || block.Height != 7 {
+					t.Fatalf("got block %v, error %v", block, err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want it to contain %q", err, tt.wantErr)
+			}
+
+			if got := server.requestCount("/blocks/7"); got != tt.wantRequests {
+				t.Errorf("got %d requests, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestRESTClientThrottles(t *testing.T) {
+	server := newLCDServer(t, testChain(25))
+	server.throttle = 1
+	c := newTestRESTClient(t, server.URL)
+
+	if _, err := c.GetBlockByHeight(context.Background(), 3); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := c.Stats()
+	if stats.Requests != 2 || stats.Retries != 1 || stats.Throttles != 1 || stats.Failures != 0 {
+		t.Errorf("got stats %+v, want 2 requests, 1 retry and 1 throttle", stats)
+	}
+	if stats.Concurrency >= 4 {
+		t.Errorf("concurrency limit %d was not cut after a 429", stats.Concurrency)
+	}
+}
+
+func TestNewClientRESTFailover(t *testing.T) {
+	down := newLCDServer(t, testChain(60))
+	down.status = http.StatusServiceUnavailable
+	up := newLCDServer(t, testChain(60))
+
+	c, err := NewClient(&types.ChainConfig{
+		Transport:      TransportREST,
+		RESTEndpoints:  []string{down.URL, up.URL},
+		Timeout:        5 * time.Second,
+		MaxRetries:     1,
+		RetryDelay:     time.Millisecond,
+		MaxConcurrency: 4,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	multi, ok := c.(*MultiClient)
+	if !ok {
+		t.Fatalf("got %T, want a client failing over across both endpoints", c)
+	}
+
+	blocks, err := c.GetBlockRange(context.Background(), 3, 52)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 50 {
+		t.Fatalf("got %d blocks, want 50", len(blocks))
+	}
+
+	stats := multi.EndpointStats()
+	if len(stats) != 2 || stats[0].URL != down.URL || stats[0].Errors == 0 || stats[1].Errors != 0 {
+		t.Errorf("got endpoint stats %+v, want the failing endpoint to take the errors", stats)
+	}
+}
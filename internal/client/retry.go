@@ -0,0 +1,220 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxRetryDelay caps the exponential backoff between two attempts
+const maxRetryDelay = 30 * time.Second
+
+// httpStatusPattern extracts the HTTP status code from CometBFT JSON-RPC client errors,
+// which only carry the response status as text
+var httpStatusPattern = regexp.MustCompile(`Status: (\d{3})`)
+
+// Stats holds request counters of a client
+type Stats struct {
+	Requests    int64 `json:"requests"`
+	Retries     int64 `json:"retries"`
+	Failures    int64 `json:"failures"`
+	Throttles   int64 `json:"throttles"`   // times the concurrency limit was cut
+	Concurrency int   `json:"concurrency"` // current concurrency limit
+}
+
+// StatsProvider is implemented by clients that track request statistics
+type StatsProvider interface {
+	Stats() Stats
+}
+
+// retrier retries transient request failures with exponential backoff and
+// jitter. Every attempt waits for the limiter, which adapts concurrency to the node
+type retrier struct {
+	maxRetries   int
+	baseDelay    time.Duration
+	callTimeout  time.Duration
+	totalTimeout time.Duration
+	limiter      *limiter
+
+	requests atomic.Int64
+	retries  atomic.Int64
+	failures atomic.Int64
+}
+
+// newRetrier creates a retrier for endpoint from the chain configuration. Each
+// attempt is bounded by Timeout and the whole call including retries by
+// Timeout * (MaxRetries + 1)
+func newRetrier(config *types.ChainConfig, endpoint string) *retrier {
+	limiter := newLimiter(config.MaxConcurrency, config.RequestsPerSecond)
+	if logf := config.Logf; logf != nil {
+		limiter.logf = func(format string, args ...any) {
+			logf(endpoint+": "+format, args...)
+		}
+	}
+
+	return &retrier{
+		maxRetries:   config.MaxRetries,
+		baseDelay:    config.RetryDelay,
+		callTimeout:  config.Timeout,
+		totalTimeout: config.Timeout * time.Duration(config.MaxRetries+1),
+		limiter:      limiter,
+	}
+}
+
+// do runs fn until it succeeds, fails with an error that cannot be retried,
+// or runs out of attempts
+func (r *retrier) do(ctx context.Context, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, r.totalTimeout)
+	defer cancel()
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err := r.limiter.acquire(ctx); err != nil {
+			r.failures.Add(1)
+			return err
+		}
+		r.requests.Add(1)
+
+		start := time.Now()
+		callCtx, callCancel := context.WithTimeout(ctx, r.callTimeout)
+		err = fn(callCtx)
+		callCancel()
+		r.limiter.release(time.Since(start), err)
+
+		if err == nil {
+			return nil
+		}
+
+		// Stop when the caller gave up, the error is permanent or attempts are exhausted
+		if ctx.Err() != nil || !isRetryable(err) || attempt >= r.maxRetries {
+			break
+		}
+
+		r.retries.Add(1)
+
+		select {
+		case <-ctx.Done():
+			r.failures.Add(1)
+			return err
+		case <-time.After(r.backoff(attempt)):
+		}
+	}
+
+	r.failures.Add(1)
+	return err
+}
+
+// backoff returns the delay before the next attempt: the base delay doubled
+// per attempt, capped at maxRetryDelay, with jitter over its upper half
+func (r *retrier) backoff(attempt int) time.Duration {
+	delay := r.baseDelay << attempt
+	if delay <= 0 || delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+
+	half := int64(delay / 2)
+	if half == 0 {
+		return delay
+	}
+	return time.Duration(half + rand.Int64N(half+1))
+}
+
+// stats returns a snapshot of the request counters
+func (r *retrier) stats() Stats {
+	throttles, concurrency := r.limiter.stats()
+	return Stats{
+		Requests:    r.requests.Load(),
+		Retries:     r.retries.Load(),
+		Failures:    r.failures.Load(),
+		Throttles:   throttles,
+		Concurrency: concurrency,
+	}
+}
+
+// isRetryable reports whether err is a transient failure: a timeout, a
+// dropped connection, HTTP 429, an HTTP 5xx response or a transient gRPC status
+func isRetryable(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	if code := httpStatusCode(err); code == 429 || code >= 500 {
+		return true
+	}
+
+	if s, ok := status.FromError(err); ok {
+		switch s.Code() {
+		case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+			return true
+		}
+	}
+
+	return false
+}
+
+// isNodeFailure reports whether err is a failure of the node as a whole
+// rather than of the request: a transient failure that outlasted the retries
+// or a connection that could not be made
+func isNodeFailure(err error) bool {
+	if isRetryable(err) {
+		return true
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.As(err, &dnsErr)
+}
+
+// httpStatusError is returned for HTTP responses with an unexpected status
+type httpStatusError struct {
+	Code int
+	Body string
+}
+
+func (e *httpStatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("unexpected HTTP status %d %s", e.Code, http.StatusText(e.Code))
+	}
+	return fmt.Sprintf("unexpected HTTP status %d %s: %s", e.Code, http.StatusText(e.Code), e.Body)
+}
+
+// httpStatusCode returns the HTTP status code embedded in err, or 0 if there is none
+func httpStatusCode(err error) int {
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code
+	}
+
+	match := httpStatusPattern.FindStringSubmatch(err.Error())
+	if match == nil {
+		return 0
+	}
+
+	code, _ := strconv.Atoi(match[1])
+	return code
+}
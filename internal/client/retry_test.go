@@ -0,0 +1,175 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// timeoutError is a net.Error reporting a timeout
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"deadline exceeded", context.DeadlineExceeded, true},
+		{"wrapped deadline exceeded", fmt.Errorf("call: %w", context.DeadlineExceeded), true},
+		{"network timeout", timeoutError{}, true},
+		{"connection reset", fmt.Errorf("read: %w", syscall.ECONNRESET), true},
+		{"unexpected EOF", io.ErrUnexpectedEOF, true},
+		{"HTTP 429", &httpStatusError{Code: 429}, true},
+		{"HTTP 502", &httpStatusError{Code: 502}, true},
+		{"HTTP 503 in CometBFT error text", errors.New("error in json rpc client, with http response metadata: (Status: 503 Service Unavailable, Protocol HTTP/1.1)"), true},
+		{"HTTP 404", &httpStatusError{Code: 404}, false},
+		{"HTTP 400 in CometBFT error text", errors.New("(Status: 400 Bad Request, Protocol HTTP/1.1)"), false},
+		{"gRPC unavailable", status.Error(codes.Unavailable, "connection refused"), true},
+		{"gRPC resource exhausted", status.Error(codes.ResourceExhausted, "rate limited"), true},
+		{"gRPC invalid argument", status.Error(codes.InvalidArgument, "height must be positive"), false},
+		{"gRPC not found", status.Error(codes.NotFound, "no block"), false},
+		{"cancelled", context.Canceled, false},
+		{"other", errors.New("height 10 is not available"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryable(tt.err); got != tt.want {
+				t.Errorf("isRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func newTestRetrier(maxRetries int, timeout time.Duration) *retrier {
+	return newRetrier(&types.ChainConfig{
+		Timeout:        timeout,
+		MaxRetries:     maxRetries,
+		RetryDelay:     time.Millisecond,
+		MaxConcurrency: 4,
+	}, "http://node:26657")
+}
+
+func TestRetrierDo(t *testing.T) {
+	transient := &httpStatusError{Code: 502}
+	permanent := &httpStatusError{Code: 400}
+
+	tests := []struct {
+		name         string
+		maxRetries   int
+		errs         []error // errors of the first attempts, later attempts succeed
+		wantErr      error
+		wantAttempts int
+		wantRetries  int64
+		wantFailures int64
+	}{
+		{"success", 3, nil, nil, 1, 0, 0},
+		{"transient failures", 3, []error{transient, transient}, nil, 3, 2, 0},
+		{"permanent failure", 3, []error{permanent}, permanent, 1, 0, 1},
+		{"transient then permanent", 3, []error{transient, permanent}, permanent, 2, 1, 1},
+		{"retries exhausted", 2, []error{transient, transient, transient, transient}, transient, 3, 2, 1},
+		{"no retries", 0, []error{transient}, transient, 1, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRetrier(tt.maxRetries, time.Second)
+
+			attempts := 0
+			err := r.do(context.Background(), func(ctx context.Context) error {
+				attempts++
+				if attempts <= len(tt.errs) {
+					return tt.errs[attempts-1]
+				}
+				return nil
+			})
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("got %d attempts, want %d", attempts, tt.wantAttempts)
+			}
+
+			stats := r.stats()
+			if stats.Requests != int64(tt.wantAttempts) || stats.Retries != tt.wantRetries || stats.Failures != tt.wantFailures {
+				t.Errorf("got stats %+v, want %d requests, %d retries, %d failures", stats, tt.wantAttempts, tt.wantRetries, tt.wantFailures)
+			}
+		})
+	}
+}
+
+func TestRetrierDeadlines(t *testing.T) {
+	const timeout = 20 * time.Millisecond
+	r := newTestRetrier(2, timeout)
+
+	// Every attempt hangs until its own deadline
+	attempts := 0
+	start := time.Now()
+	err := r.do(context.Background(), func(ctx context.Context) error {
+		attempts++
+		deadline, ok := ctx.Deadline()
+		if !ok || time.Until(deadline) > timeout {
+			t.Errorf("attempt %d has no per-call deadline of %s", attempts, timeout)
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got error %v, want a deadline error", err)
+	}
+	// The last attempt may not fit into the overall deadline of 3 * timeout
+	if attempts < 2 || attempts > 3 {
+		t.Errorf("got %d attempts, want 2 or 3", attempts)
+	}
+	if elapsed := time.Since(start); elapsed > 3*timeout+time.Second {
+		t.Errorf("retries took %s, more than the overall deadline", elapsed)
+	}
+}
+
+func TestRetrierCallerCancel(t *testing.T) {
+	r := newTestRetrier(5, time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	err := r.do(ctx, func(ctx context.Context) error {
+		attempts++
+		cancel()
+		return &httpStatusError{Code: 503}
+	})
+
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if attempts != 1 {
+		t.Errorf("got %d attempts after the caller cancelled, want 1", attempts)
+	}
+}
+
+func TestRetrierBackoff(t *testing.T) {
+	r := &retrier{baseDelay: 100 * time.Millisecond}
+
+	for attempt := 0; attempt < 12; attempt++ {
+		want := min(r.baseDelay<<attempt, maxRetryDelay)
+		for i := 0; i < 20; i++ {
+			delay := r.backoff(attempt)
+			if delay < want/2 || delay > want {
+				t.Fatalf("attempt %d: backoff %s outside [%s, %s]", attempt, delay, want/2, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+const (
+	// defaultMaxLookups bounds the block lookups of a height search
+	defaultMaxLookups = 64
+
+	// estimateBlocks is the number of latest blocks the block time is estimated from
+	estimateBlocks = maxBlockMetas
+)
+
+// SearchOptions configures FindHeightAtTime
+type SearchOptions struct {
+	BlockTime  time.Duration // Expected block time for the first guess, estimated from the latest blocks when 0
+	MaxLookups int           // Maximum number of block lookups before giving up
+}
+
+// SearchResult is the outcome of a height search
+type SearchResult struct {
+	Block    *types.BlockInfo `json:"block"`    // First block at or after the searched time
+	Lookups  int              `json:"lookups"`  // Block lookups the search needed
+	Verified bool             `json:"verified"` // every header looked up was verified by the light client
+}
+
+// heightSearch counts the lookups of one search against its budget
+type heightSearch struct {
+	client     BlockchainClient
+	lookups    int
+	maxLookups int
+	unverified int // lookups returning a header the light client did not verify
+}
+
+// FindHeightAtTime finds the first block with a time at or after t.
+//
+// The search guesses the height from the block time, widens a bracket around
+// the guess until it contains t and then narrows it down with interpolation,
+// falling back to bisection whenever interpolation does not halve the
+// bracket. This needs a handful of lookups on chains with a steady block time
+// and O(log n) in the worst case.
+func FindHeightAtTime(ctx context.Context, c BlockchainClient, t time.Time, opts SearchOptions) (*SearchResult, error) {
+	if opts.MaxLookups <= 0 {
+		opts.MaxLookups = defaultMaxLookups
+	}
+
+	s := &heightSearch{client: c, maxLookups: opts.MaxLookups}
+	block, err := s.find(ctx, t, opts.BlockTime)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SearchResult{Block: block, Lookups: s.lookups, Verified: s.unverified == 0}, nil
+}
+
+func (s *heightSearch) find(ctx context.Context, t time.Time, blockTime time.Duration) (*types.BlockInfo, error) {
+	status, err := s.client.GetStatus(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get node status: %w", err)
+	}
+
+	earliestHeight := status.EarliestHeight
+	if earliestHeight < 1 {
+		earliestHeight = 1
+	}
+
+	latest, err := s.block(ctx, status.LatestHeight)
+	if err != nil {
+		return nil, err
+	}
+	if latest.Time.Before(t) {
+		return nil, fmt.Errorf("%s is after the latest block %d at %s", t.Format(time.RFC3339), latest.Height, latest.Time.Format(time.RFC3339))
+	}
+
+	if blockTime <= 0 {
+		blockTime, err = s.estimateBlockTime(ctx, latest, earliestHeight)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Guess the height assuming a steady block time since t
+	guessHeight := latest.Height
+	if blockTime > 0 {
+		guessHeight -= int64(latest.Time.Sub(t) / blockTime)
+	}
+	if guessHeight < earliestHeight {
+		guessHeight = earliestHeight
+	}
+
+	guess, err := s.block(ctx, guessHeight)
+	if err != nil {
+		return nil, err
+	}
+
+	// Widen a bracket lo.Time < t <= hi.Time around the guess, doubling the step
+	var lo, hi *types.BlockInfo
+	step := int64(1)
+	if guess.Time.Before(t) {
+		lo = guess
+		for hi == nil {
+			height := lo.Height + step
+			if height >= latest.Height {
+				hi = latest
+				break
+			}
+
+			block, err := s.block(ctx, height)
+			if err != nil {
+				return nil, err
+			}
+			if block.Time.Before(t) {
+				lo = block
+			} else {
+				hi = block
+			}
+			step *= 2
+		}
+	} else {
+		hi = guess
+		for lo == nil {
+			if hi.Height <= earliestHeight {
+				if status.EarliestHeight > 1 && hi.Time.After(t) {
+					return nil, fmt.Errorf("%s is before the earliest available block %d at %s", t.Format(time.RFC3339), hi.Height, hi.Time.Format(time.RFC3339))
+				}
+				return hi, nil
+			}
+
+			height := hi.Height - step
+			if height < earliestHeight {
+				height = earliestHeight
+			}
+
+			block, err := s.block(ctx, height)
+			if err != nil {
+				return nil, err
+			}
+			if block.Time.Before(t) {
+				lo = block
+			} else {
+				hi = block
+			}
+			step *= 2
+		}
+	}
+
+	// Narrow the bracket down to two consecutive blocks
+	bisect := false
+	for hi.Height-lo.Height > 1 {
+		width := hi.Height - lo.Height
+
+		var height int64
+		if bisect {
+			height = lo.Height + width/2
+		} else {
+			fraction := float64(t.Sub(lo.Time)) / float64(hi.Time.Sub(lo.Time))
+			height = lo.Height + int64(math.Ceil(fraction*float64(width)))
+			height = max(lo.Height+1, min(height, hi.Height-1))
+		}
+
+		block, err := s.block(ctx, height)
+		if err != nil {
+			return nil, err
+		}
+		if block.Time.Before(t) {
+			lo = block
+		} else {
+			hi = block
+		}
+
+		// Bisect next when interpolation did not at least halve the bracket
+		bisect = !bisect && hi.Height-lo.Height > width/2
+	}
+
+	return hi, nil
+}
+
+// estimateBlockTime returns the mean block time of the latest blocks
+func (s *heightSearch) estimateBlockTime(ctx context.Context, latest *types.BlockInfo, earliestHeight int64) (time.Duration, error) {
+	startHeight := max(latest.Height-estimateBlocks, earliestHeight)
+	if startHeight >= latest.Height {
+		return 0, nil
+	}
+
+	start, err := s.block(ctx, startHeight)
+	if err != nil {
+		return 0, err
+	}
+
+	return latest.Time.Sub(start.Time) / time.Duration(latest.Height-startHeight), nil
+}
+
+// block looks up a single block, failing once the lookup budget is spent
+func (s *heightSearch) block(ctx context.Context, height int64) (*types.BlockInfo, error) {
+	if s.lookups >= s.maxLookups {
+		return nil, fmt.Errorf("height search gave up after %d block lookups", s.lookups)
+	}
+	s.lookups++
+
+	block, err := s.client.GetBlockByHeight(ctx, height)
+	if err != nil {
+		return nil, err
+	}
+	if !block.Verified {
+		s.unverified++
+	}
+	return block, nil
+}
@@ -0,0 +1,116 @@
+package client
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/simulate"
+)
+
+var searchGenesis = time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+// searchChain generates a chain of blocks up to height 20000 for spec
+func searchChain(t *testing.T, spec simulate.Spec) *simulate.Chain {
+	t.Helper()
+
+	spec.ChainID = testChainID
+	spec.Seed = 7
+	spec.GenesisTime = searchGenesis
+	spec.LatestHeight = 20000
+	c, err := simulate.New(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// blockTime returns the time of the block at height of c
+func blockTime(t *testing.T, c *simulate.Chain, height int64) time.Time {
+	t.Helper()
+
+	block, err := c.GetBlockByHeight(context.Background(), height)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return block.Time
+}
+
+func TestFindHeightAtTime(t *testing.T) {
+	steady := searchChain(t, simulate.Spec{
+		BlockTime: simulate.Distribution{Distribution: simulate.DistributionConstant, Mean: 6 * time.Second},
+	})
+	irregular := searchChain(t, simulate.Spec{
+		BlockTime: simulate.Distribution{Distribution: simulate.DistributionMixture, Components: []simulate.Component{
+			{Weight: 0.97, Distribution: simulate.Distribution{Distribution: simulate.DistributionNormal, Mean: 6 * time.Second, StdDev: 300 * time.Millisecond}},
+			{Weight: 0.03, Distribution: simulate.Distribution{Distribution: simulate.DistributionLogNormal, Median: 15 * time.Second, Sigma: 0.3}},
+		}},
+		Rounds: simulate.Rounds{Probability: 0.02, Timeout: 3 * time.Second},
+	})
+	halted := searchChain(t, simulate.Spec{
+		BlockTime: simulate.Distribution{Distribution: simulate.DistributionNormal, Mean: 6 * time.Second, StdDev: 300 * time.Millisecond},
+		Halts:     []simulate.Halt{{Height: 10000, Duration: 45 * time.Minute}},
+	})
+	pruned := searchChain(t, simulate.Spec{
+		BlockTime:   simulate.Distribution{Distribution: simulate.DistributionConstant, Mean: 6 * time.Second},
+		StartHeight: 5000,
+	})
+
+	tests := []struct {
+		name       string
+		chain      *simulate.Chain
+		t          time.Time
+		opts       SearchOptions
+		maxLookups int    // lookups the search may need
+		wantErr    string // error expected instead of a block
+	}{
+		{"steady block time", steady, searchGenesis.Add(50003 * time.Second), SearchOptions{}, 5, ""},
+		{"exact block time", steady, blockTime(t, steady, 12345), SearchOptions{}, 5, ""},
+		{"irregular block times", irregular, searchGenesis.Add(11 * time.Hour), SearchOptions{}, 20, ""},
+		{"irregular near genesis", irregular, searchGenesis.Add(13 * time.Minute), SearchOptions{}, 20, ""},
+		{"guess too low widens up", irregular, searchGenesis.Add(11 * time.Hour), SearchOptions{BlockTime: time.Second}, 24, ""},
+		{"guess too high widens down", irregular, searchGenesis.Add(11 * time.Hour), SearchOptions{BlockTime: time.Minute}, 24, ""},
+		{"during a halt", halted, blockTime(t, halted, 9999).Add(20 * time.Minute), SearchOptions{}, 24, ""},
+		{"after a halt", halted, blockTime(t, halted, 10000).Add(time.Second), SearchOptions{}, 24, ""},
+		{"before genesis", steady, searchGenesis.Add(-time.Hour), SearchOptions{}, 4, ""},
+		{"latest block", steady, blockTime(t, steady, 20000), SearchOptions{}, 5, ""},
+		{"pruned chain", pruned, blockTime(t, pruned, 7000).Add(-time.Second), SearchOptions{}, 5, ""},
+		{"earliest available block", pruned, searchGenesis, SearchOptions{}, 4, ""},
+		{"before the earliest available block", pruned, searchGenesis.Add(-time.Second), SearchOptions{}, 0, "is before the earliest available block 5000"},
+		{"after the latest block", steady, blockTime(t, steady, 20000).Add(time.Second), SearchOptions{}, 0, "is after the latest block 20000"},
+		{"lookup budget spent", irregular, searchGenesis.Add(11 * time.Hour), SearchOptions{MaxLookups: 4}, 0, "gave up after 4 block lookups"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := FindHeightAtTime(context.Background(), tt.chain, tt.t, tt.opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got result %+v and error %v, want an error containing %q", result, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The first block at or after t, found by a plain binary search
+			status, err := tt.chain.GetStatus(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := status.EarliestHeight + int64(sort.Search(int(status.LatestHeight-status.EarliestHeight+1), func(i int) bool {
+				return !blockTime(t, tt.chain, status.EarliestHeight+int64(i)).Before(tt.t)
+			}))
+
+			if result.Block.Height != want {
+				t.Errorf("got height %d, want %d", result.Block.Height, want)
+			}
+			if result.Lookups > tt.maxLookups {
+				t.Errorf("got %d lookups, want at most %d", result.Lookups, tt.maxLookups)
+			}
+		})
+	}
+}
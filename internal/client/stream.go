@@ -0,0 +1,252 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+const (
+	defaultStreamChunkSize = 10 * maxBlockMetas
+	defaultStreamWindow    = 3
+
+	// maxGapSplitDepth bounds how often a failing range is halved to isolate
+	// the heights that cannot be fetched
+	maxGapSplitDepth = 8
+)
+
+// StreamOptions configures StreamBlockRange and StreamChunks
+type StreamOptions struct {
+	ChunkSize int64 // Heights requested from the client per GetBlockRange call
+	Window    int   // Chunks fetched ahead of the consumer
+
+	// OnMissing makes the stream tolerate heights that cannot be fetched.
+	// They are passed to OnMissing, before the blocks of the same chunk are
+	// delivered, instead of failing the stream
+	OnMissing func(types.MissingBlock)
+
+	// VerifyLinkage fails the stream when a block does not link to the block
+	// before it by hash
+	VerifyLinkage bool
+}
+
+// BlockRange is a range of blocks that may have gaps
+type BlockRange struct {
+	Blocks  []*types.BlockInfo   `json:"blocks"`
+	Missing []types.MissingBlock `json:"missing"`
+}
+
+// BlockStreamer is implemented by clients that stream block ranges in their
+// own way, typically to tune the chunking to how they fetch
+type BlockStreamer interface {
+	StreamBlockRange(ctx context.Context, startHeight, endHeight int64, opts StreamOptions) (<-chan *types.BlockInfo, <-chan error)
+}
+
+// chunkResult is the outcome of fetching one chunk of a stream
+type chunkResult struct {
+	blocks  []*types.BlockInfo
+	missing []types.MissingBlock
+	err     error
+}
+
+// StreamBlockRange streams the blocks of a range in height order, using the
+// client's own StreamBlockRange when it implements BlockStreamer and
+// StreamChunks otherwise
+func StreamBlockRange(ctx context.Context, c BlockchainClient, startHeight, endHeight int64, opts StreamOptions) (<-chan *types.BlockInfo, <-chan error) {
+	if streamer, ok := c.(BlockStreamer); ok {
+		return streamer.StreamBlockRange(ctx, startHeight, endHeight, opts)
+	}
+	return StreamChunks(ctx, c, startHeight, endHeight, opts)
+}
+
+// StreamChunks streams the blocks of a range in height order. Chunks are
+// fetched concurrently but at most Window chunks ahead of the consumer, so
+// memory stays bounded however large the range is. Each chunk is delivered as
+// soon as it and all chunks before it have arrived, with block times set
+// across chunk boundaries. Block times are only set between consecutive
+// heights, so the block after a gap has a block time of 0.
+//
+// The block channel is closed when the range is complete or fetching failed.
+// The error channel then yields the failure, if any, and is closed. Cancel ctx
+// to stop consuming early.
+func StreamChunks(ctx context.Context, c BlockchainClient, startHeight, endHeight int64, opts StreamOptions) (<-chan *types.BlockInfo, <-chan error) {
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = defaultStreamChunkSize
+	}
+	if opts.Window <= 0 {
+		opts.Window = defaultStreamWindow
+	}
+
+	if startHeight > endHeight {
+		return failedStream(fmt.Errorf("invalid range: start height %d > end height %d", startHeight, endHeight))
+	}
+
+	blocks := make(chan *types.BlockInfo, opts.ChunkSize)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+		defer close(blocks)
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		// Results are queued in height order; the queue capacity is the window
+		pending := make(chan chan chunkResult, opts.Window)
+		go func() {
+			defer close(pending)
+
+			for start := startHeight; start <= endHeight; start += opts.ChunkSize {
+				end := start + opts.ChunkSize - 1
+				if end > endHeight {
+					end = endHeight
+				}
+
+				result := make(chan chunkResult, 1)
+				select {
+				case pending <- result:
+				case <-ctx.Done():
+					return
+				}
+
+				go func(start, end int64) {
+					chunk, err := c.GetBlockRange(ctx, start, end)
+					if err != nil && opts.OnMissing != nil && ctx.Err() == nil {
+						chunk, missing, err := fetchWithGaps(ctx, c, start, end, err, 0)
+						if err == nil {
+							err = ctx.Err()
+						}
+						result <- chunkResult{blocks: chunk, missing: missing, err: err}
+						return
+					}
+					result <- chunkResult{blocks: chunk, err: err}
+				}(start, end)
+			}
+		}()
+
+		var previous *types.BlockInfo
+		for result := range pending {
+			var chunk chunkResult
+			select {
+			case chunk = <-result:
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			}
+
+			if chunk.err != nil {
+				errs <- chunk.err
+				return
+			}
+
+			for _, missing := range chunk.missing {
+				opts.OnMissing(missing)
+			}
+
+			for _, block := range chunk.blocks {
+				if opts.VerifyLinkage {
+					if err := CheckLink(previous, block); err != nil {
+						errs <- err
+						return
+					}
+				}
+
+				block.BlockTime = 0
+				if previous != nil && previous.Height == block.Height-1 {
+					block.BlockTime = block.Time.Sub(previous.Time).Seconds()
+				}
+				previous = block
+
+				select {
+				case blocks <- block:
+				case <-ctx.Done():
+					errs <- ctx.Err()
+					return
+				}
+			}
+		}
+	}()
+
+	return blocks, errs
+}
+
+// failedStream returns a closed stream yielding err
+func failedStream(err error) (<-chan *types.BlockInfo, <-chan error) {
+	blocks := make(chan *types.BlockInfo)
+	errs := make(chan error, 1)
+	errs <- err
+	close(blocks)
+	close(errs)
+	return blocks, errs
+}
+
+// GetBlockRangeWithGaps gets a range of blocks, reporting heights that cannot
+// be fetched instead of failing. Block times are only set between consecutive heights
+func GetBlockRangeWithGaps(ctx context.Context, c BlockchainClient, startHeight, endHeight int64) (*BlockRange, error) {
+	result := &BlockRange{}
+	blockChan, errChan := StreamBlockRange(ctx, c, startHeight, endHeight, StreamOptions{
+		OnMissing: func(missing types.MissingBlock) {
+			result.Missing = append(result.Missing, missing)
+		},
+	})
+
+	for block := range blockChan {
+		result.Blocks = append(result.Blocks, block)
+	}
+	if err := <-errChan; err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// fetchWithGaps fetches startHeight..endHeight after a range request for it
+// failed with err. The range is split in halves until the heights that fail
+// on their own are isolated, so a single bad height costs a few requests
+// rather than one per height. When both halves fail because of the node
+// rather than their heights, as when it is down, the fetch fails instead of
+// reporting every height missing. After maxGapSplitDepth halvings, the
+// heights left are reported missing together
+func fetchWithGaps(ctx context.Context, c BlockchainClient, startHeight, endHeight int64, err error, depth int) ([]*types.BlockInfo, []types.MissingBlock, error) {
+	if ctx.Err() != nil {
+		return nil, nil, nil
+	}
+
+	if startHeight == endHeight || depth >= maxGapSplitDepth {
+		missing := make([]types.MissingBlock, 0, endHeight-startHeight+1)
+		for height := startHeight; height <= endHeight; height++ {
+			missing = append(missing, types.MissingBlock{Height: height, Reason: err.Error()})
+		}
+		return nil, missing, nil
+	}
+
+	mid := startHeight + (endHeight-startHeight)/2
+	halves := [][2]int64{{startHeight, mid}, {mid + 1, endHeight}}
+
+	var halfBlocks [2][]*types.BlockInfo
+	var halfErrs [2]error
+	for i, half := range halves {
+		halfBlocks[i], halfErrs[i] = c.GetBlockRange(ctx, half[0], half[1])
+	}
+	if halfErrs[0] != nil && halfErrs[1] != nil && isNodeFailure(halfErrs[0]) && isNodeFailure(halfErrs[1]) {
+		return nil, nil, fmt.Errorf("failed to get blocks %d-%d: %w", startHeight, endHeight, halfErrs[1])
+	}
+
+	var blocks []*types.BlockInfo
+	var missing []types.MissingBlock
+	for i, half := range halves {
+		var halfMissing []types.MissingBlock
+		if halfErrs[i] != nil {
+			var err error
+			halfBlocks[i], halfMissing, err = fetchWithGaps(ctx, c, half[0], half[1], halfErrs[i], depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		blocks = append(blocks, halfBlocks[i]...)
+		missing = append(missing, halfMissing...)
+	}
+
+	return blocks, missing, nil
+}
@@ -0,0 +1,364 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/simulate"
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+// collect drains a stream
+func collect(blockChan <-chan *types.BlockInfo, errChan <-chan error) ([]*types.BlockInfo, error) {
+	var blocks []*types.BlockInfo
+	for block := range blockChan {
+		blocks = append(blocks, block)
+	}
+	return blocks, <-errChan
+}
+
+func TestStreamChunks(t *testing.T) {
+	tests := []struct {
+		name      string
+		start     int64
+		end       int64
+		chunkSize int64
+		window    int
+		wantCalls int
+	}{
+		{"single height", 5, 5, 0, 0, 1},
+		{"one chunk", 1, 200, 0, 0, 1},
+		{"default chunks", 1, 1001, 0, 0, 6},
+		{"small chunks", 10, 109, 7, 2, 15},
+		{"window of one", 1, 50, 10, 1, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestNode(t, 5000)
+			blocks, err := collect(StreamChunks(context.Background(), c, tt.start, tt.end, StreamOptions{
+				ChunkSize: tt.chunkSize,
+				Window:    tt.window,
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(blocks) != int(tt.end-tt.start+1) {
+				t.Fatalf("got %d blocks, want %d", len(blocks), tt.end-tt.start+1)
+			}
+			for i, block := range blocks {
+				if block.Height != tt.start+int64(i) {
+					t.Fatalf("block %d has height %d", i, block.Height)
+				}
+				// Block times are set across chunk boundaries, but not before the first block
+				want := 6.0
+				if i == 0 {
+					want = 0
+				}
+				if block.BlockTime != want {
+					t.Fatalf("block %d has block time %v, want %v", block.Height, block.BlockTime, want)
+				}
+			}
+
+			if calls := len(c.Ranges()); calls != tt.wantCalls {
+				t.Errorf("got %d range calls, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestStreamChunksInvalidRange(t *testing.T) {
+	blocks, err := collect(StreamChunks(context.Background(), newTestNode(t, 100), 10, 5, StreamOptions{}))
+	if err == nil || len(blocks) != 0 {
+		t.Fatalf("got %d blocks and error %v, want an invalid range error", len(blocks), err)
+	}
+}
+
+func TestStreamChunksWindow(t *testing.T) {
+	c := newTestNode(t, 100000)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const chunkSize, window = 10, 2
+	blockChan, errChan := StreamChunks(ctx, c, 1, 100000, StreamOptions{ChunkSize: chunkSize, Window: window})
+
+	// Without a consumer the stream stops fetching once the window and the
+	// block buffer are full
+	time.Sleep(50 * time.Millisecond)
+	if calls := len(c.Ranges()); calls > window+2 {
+		t.Fatalf("fetched %d chunks ahead of the consumer, want at most %d", calls, window+2)
+	}
+
+	// Consuming moves the window along
+	for i := 0; i < 5*chunkSize; i++ {
+		<-blockChan
+	}
+	time.Sleep(50 * time.Millisecond)
+	if calls := len(c.Ranges()); calls < 5 || calls > 5+window+2 {
+		t.Fatalf("got %d chunks fetched after consuming 5", calls)
+	}
+
+	cancel()
+	for range blockChan {
+	}
+	if err := <-errChan; !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v after cancelling, want context.Canceled", err)
+	}
+}
+
+func TestStreamChunksError(t *testing.T) {
+	c := newTestNode(t, 100)
+
+	// The node has no blocks after 100
+	blocks, err := collect(StreamChunks(context.Background(), c, 1, 150, StreamOptions{ChunkSize: 20}))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if len(blocks) > 100 {
+		t.Errorf("got %d blocks, more than the node has", len(blocks))
+	}
+	for i, block := range blocks {
+		if block.Height != int64(i+1) {
+			t.Fatalf("blocks before the failure are out of order at %d", i)
+		}
+	}
+}
+
+func TestStreamChunksVerifyLinkage(t *testing.T) {
+	c := &forkClient{Node: newTestNode(t, 100), forkAt: 57}
+
+	_, err := collect(StreamChunks(context.Background(), c, 1, 100, StreamOptions{ChunkSize: 10}))
+	if err != nil {
+		t.Fatalf("unexpected error without linkage checks: %v", err)
+	}
+
+	blocks, err := collect(StreamChunks(context.Background(), c, 1, 100, StreamOptions{ChunkSize: 10, VerifyLinkage: true}))
+	if err == nil || !strings.Contains(err.Error(), "block 57 does not link to block 56") {
+		t.Fatalf("got error %v, want a linkage error at 57", err)
+	}
+	if len(blocks) != 56 {
+		t.Errorf("got %d blocks before the break, want 56", len(blocks))
+	}
+}
+
+func TestStreamChunksOnMissing(t *testing.T) {
+	c := newTestNode(t, 1000)
+	c.Missing = map[int64]bool{37: true, 38: true, 500: true}
+
+	var missing []int64
+	blocks, err := collect(StreamChunks(context.Background(), c, 1, 1000, StreamOptions{
+		OnMissing: func(m types.MissingBlock) {
+			if !strings.Contains(m.Reason, fmt.Sprintf("block %d is missing", m.Height)) {
+				t.Errorf("height %d missing for %q", m.Height, m.Reason)
+			}
+			missing = append(missing, m.Height)
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(missing) != "[37 38 500]" {
+		t.Errorf("got missing heights %v, want [37 38 500]", missing)
+	}
+	if len(blocks) != 997 {
+		t.Fatalf("got %d blocks, want 997", len(blocks))
+	}
+	for i := 1; i < len(blocks); i++ {
+		if blocks[i].Height <= blocks[i-1].Height {
+			t.Fatalf("block %d follows block %d", blocks[i].Height, blocks[i-1].Height)
+		}
+		// The block after a gap has no block time, it is not one long block
+		want := 6.0
+		if blocks[i].Height != blocks[i-1].Height+1 {
+			want = 0
+		}
+		if blocks[i].BlockTime != want {
+			t.Errorf("block %d has block time %v, want %v", blocks[i].Height, blocks[i].BlockTime, want)
+		}
+	}
+
+	// Halving isolates the bad heights in a few requests per failing chunk,
+	// instead of one request per height
+	if calls := len(c.Ranges()); calls > 5+3*2*8 {
+		t.Errorf("got %d range calls for 3 missing heights", calls)
+	}
+}
+
+func TestFetchWithGaps(t *testing.T) {
+	tests := []struct {
+		name        string
+		missing     []int64
+		wantMissing string
+		wantCalls   int
+	}{
+		{"single height", []int64{5}, "[5]", 8},
+		{"first height", []int64{1}, "[1]", 8},
+		{"adjacent heights", []int64{8, 9}, "[8 9]", 14},
+		{"whole range", []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}, "[1 2 3 4 5 6 7 8 9 10 11 12 13 14 15 16]", 30},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestNode(t, 100)
+			c.Missing = make(map[int64]bool)
+			for _, height := range tt.missing {
+				c.Missing[height] = true
+			}
+
+			blocks, missing, err := fetchWithGaps(context.Background(), c, 1, 16, errors.New("range failed"), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var heights []int64
+			for _, m := range missing {
+				heights = append(heights, m.Height)
+			}
+			if fmt.Sprint(heights) != tt.wantMissing {
+				t.Errorf("got missing heights %v, want %s", heights, tt.wantMissing)
+			}
+			if len(blocks)+len(missing) != 16 {
+				t.Errorf("got %d blocks and %d missing heights for 16 heights", len(blocks), len(missing))
+			}
+			if calls := len(c.Ranges()); calls != tt.wantCalls {
+				t.Errorf("got %d range calls, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestFetchWithGapsSplitDepth(t *testing.T) {
+	c := newTestNode(t, 2000)
+	c.Missing = make(map[int64]bool)
+	for height := int64(1); height <= 1024; height++ {
+		c.Missing[height] = true
+	}
+
+	// Halving stops at ranges of 4 heights instead of single heights
+	blocks, missing, err := fetchWithGaps(context.Background(), c, 1, 1024, errors.New("range failed"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 0 || len(missing) != 1024 {
+		t.Errorf("got %d blocks and %d missing heights, want 1024 missing", len(blocks), len(missing))
+	}
+	if calls := len(c.Ranges()); calls != 2*(1<<maxGapSplitDepth-1) {
+		t.Errorf("got %d range calls, want %d", calls, 2*(1<<maxGapSplitDepth-1))
+	}
+}
+
+func TestGetBlockRangeWithGapsNodeDown(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}},
+		{"server error", &httpStatusError{Code: 503}},
+		{"throttled", &httpStatusError{Code: 429}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestNode(t, 1000)
+			c.Err = tt.err
+
+			_, err := GetBlockRangeWithGaps(context.Background(), c, 1, 1000)
+			if err == nil || !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+
+			// Every chunk fails once and its halves once, without isolating heights
+			if calls := len(c.Ranges()); calls > 3*5 {
+				t.Errorf("got %d range calls against a node that is down", calls)
+			}
+		})
+	}
+}
+
+func TestGetBlockRangeWithGaps(t *testing.T) {
+	c := newTestNode(t, 300)
+	c.Missing = map[int64]bool{250: true}
+
+	result, err := GetBlockRangeWithGaps(context.Background(), c, 101, 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Blocks) != 199 || len(result.Missing) != 1 || result.Missing[0].Height != 250 {
+		t.Errorf("got %d blocks and missing %+v", len(result.Blocks), result.Missing)
+	}
+
+	// Without gap tolerance the range fails
+	if _, err := collect(StreamChunks(context.Background(), c, 101, 300, StreamOptions{})); err == nil {
+		t.Error("expected the missing height to fail the stream")
+	}
+}
+
+// forkClient serves a block from another fork at forkAt
+type forkClient struct {
+	*simulate.Node
+	forkAt int64
+}
+
+func (c *forkClient) GetBlockRange(ctx context.Context, startHeight, endHeight int64) ([]*types.BlockInfo, error) {
+	blocks, err := c.Node.GetBlockRange(ctx, startHeight, endHeight)
+	for _, block := range blocks {
+		if block.Height == c.forkAt {
+			block.ParentHash = "FORK"
+		}
+	}
+	return blocks, err
+}
+
+// streamingClient records that its own StreamBlockRange was used
+type streamingClient struct {
+	*simulate.Node
+	streamed bool
+}
+
+func (c *streamingClient) StreamBlockRange(ctx context.Context, startHeight, endHeight int64, opts StreamOptions) (<-chan *types.BlockInfo, <-chan error) {
+	c.streamed = true
+	return StreamChunks(ctx, c, startHeight, endHeight, opts)
+}
+
+func TestStreamBlockRangeUsesStreamer(t *testing.T) {
+	c := &streamingClient{Node: newTestNode(t, 100)}
+	blocks, err := collect(StreamBlockRange(context.Background(), c, 1, 100, StreamOptions{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.streamed || len(blocks) != 100 {
+		t.Errorf("got %d blocks, streamed by the client: %v", len(blocks), c.streamed)
+	}
+}
+
+func TestMultiClientStreamWindow(t *testing.T) {
+	clients := []*simulate.Node{newTestNode(t, 100000), newTestNode(t, 100000), newTestNode(t, 100000), newTestNode(t, 100000)}
+	clients[3].Earliest = 50000
+	m := newTestMultiClient(clients...)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Three endpoints keep height 1, so six chunks are in flight
+	blockChan, _ := m.StreamBlockRange(ctx, 1, 100000, StreamOptions{ChunkSize: 10})
+	time.Sleep(50 * time.Millisecond)
+
+	var calls int
+	for _, c := range clients {
+		calls += len(c.Ranges())
+	}
+	if calls < 6 || calls > 8 {
+		t.Errorf("got %d chunks in flight, want two per serving endpoint", calls)
+	}
+
+	cancel()
+	for range blockChan {
+	}
+}
@@ -0,0 +1,201 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	rpchttp "github.com/cometbft/cometbft/rpc/client/http"
+	tmtypes "github.com/cometbft/cometbft/types"
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+// subscriberName identifies our subscriptions on the node
+const subscriberName = "blocktime-calculator"
+
+// subscriptionStallTimeout is how long the websocket may stay quiet before
+// the node is asked whether the chain moved on without us. Tests shorten it
+var subscriptionStallTimeout = 30 * time.Second
+
+// BlockSubscriber is implemented by clients that can push new blocks as they are committed
+type BlockSubscriber interface {
+	SubscribeNewBlocks(ctx context.Context) (<-chan *types.BlockInfo, <-chan error)
+}
+
+// FindSubscriber returns the first client in the wrapper chain of c that supports subscriptions
+func FindSubscriber(c BlockchainClient) (BlockSubscriber, bool) {
+	return findClient[BlockSubscriber](c)
+}
+
+// subscription tracks the last block delivered to a subscriber
+type subscription struct {
+	client *CosmosSDKClient
+	blocks chan<- *types.BlockInfo
+	last   *types.BlockInfo
+}
+
+// SubscribeNewBlocks streams every new block over the node's websocket as it is
+// committed. When the websocket drops, or stays quiet while the chain advances,
+// the subscription reconnects with backoff and backfills the heights committed
+// in between, so blocks are delivered in height order without gaps.
+//
+// Connection problems are reported on the error channel without ending the
+// subscription; reports are dropped if nobody reads them. Both channels are
+// closed when ctx is cancelled.
+func (c *CosmosSDKClient) SubscribeNewBlocks(ctx context.Context) (<-chan *types.BlockInfo, <-chan error) {
+	blocks := make(chan *types.BlockInfo, maxBlockMetas)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+		defer close(blocks)
+
+		sub := &subscription{client: c, blocks: blocks}
+		for attempt := 0; ctx.Err() == nil; attempt++ {
+			last := sub.last
+			err := sub.run(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+
+			select {
+			case errs <- fmt.Errorf("subscription to %s interrupted: %w", c.config.RPCEndpoint, err):
+			default:
+			}
+
+			// Start the backoff over once a connection delivered blocks
+			if sub.last != last {
+				attempt = 0
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(c.retry.backoff(attempt)):
+			}
+		}
+	}()
+
+	return blocks, errs
+}
+
+// run holds one websocket connection until it fails or ctx is cancelled
+func (s *subscription) run(ctx context.Context) error {
+	wsClient, err := rpchttp.New(s.client.config.RPCEndpoint, "/websocket")
+	if err != nil {
+		return fmt.Errorf("failed to create websocket client: %w", err)
+	}
+	if err := wsClient.Start(); err != nil {
+		return fmt.Errorf("failed to connect websocket: %w", err)
+	}
+	defer wsClient.Stop()
+
+	subscribeCtx, cancel := context.WithTimeout(ctx, s.client.config.Timeout)
+	events, err := wsClient.Subscribe(subscribeCtx, subscriberName, tmtypes.EventQueryNewBlock.String(), maxBlockMetas)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("failed to subscribe: %w", err)
+	}
+
+	stall := time.NewTimer(subscriptionStallTimeout)
+	defer stall.Stop()
+
+	// Height the chain was known to be at when the websocket went quiet
+	var quietHeight int64
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case event, ok := <-events:
+			if !ok {
+				return fmt.Errorf("websocket closed")
+			}
+
+			data, ok := event.Data.(tmtypes.EventDataNewBlock)
+			if !ok || data.Block == nil {
+				continue
+			}
+
+			block := s.client.fromBlock(ctx, data.Block)
+			if s.client.config.Load {
+				// A block without its load is backfilled on the next connection
+				if block.Load, err = s.client.getLoad(ctx, block.Height, data.Block.Size()); err != nil {
+					return err
+				}
+			}
+			if err := s.deliver(ctx, block); err != nil {
+				return err
+			}
+			stall.Reset(subscriptionStallTimeout)
+
+		case <-stall.C:
+			// A quiet websocket is only a problem if the chain moved on without us
+			status, err := s.client.GetStatus(ctx)
+			if err != nil {
+				return err
+			}
+			if s.last != nil && s.last.Height > quietHeight {
+				quietHeight = s.last.Height
+			}
+			if quietHeight > 0 && status.LatestHeight > quietHeight {
+				return fmt.Errorf("no events for %s while the chain advanced to height %d", subscriptionStallTimeout, status.LatestHeight)
+			}
+			quietHeight = status.LatestHeight
+			stall.Reset(subscriptionStallTimeout)
+		}
+	}
+}
+
+// deliver sends block to the subscriber after backfilling any heights missed
+// since the last delivered block. Blocks already delivered are skipped
+func (s *subscription) deliver(ctx context.Context, block *types.BlockInfo) error {
+	if s.last != nil {
+		if block.Height <= s.last.Height {
+			return nil
+		}
+
+		if block.Height > s.last.Height+1 {
+			missed, err := s.client.GetBlockRange(ctx, s.last.Height+1, block.Height-1)
+			if err != nil {
+				return fmt.Errorf("failed to backfill blocks %d-%d: %w", s.last.Height+1, block.Height-1, err)
+			}
+			for _, m := range missed {
+				if err := s.send(ctx, m); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return s.send(ctx, block)
+}
+
+// send delivers a single block with its block time
+func (s *subscription) send(ctx context.Context, block *types.BlockInfo) error {
+	block.BlockTime = 0
+	if s.last != nil {
+		block.BlockTime = block.Time.Sub(s.last.Time).Seconds()
+	}
+
+	select {
+	case s.blocks <- block:
+		s.last = block
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// blockInfoFromBlock converts a full block into BlockInfo
+func blockInfoFromBlock(block *tmtypes.Block) *types.BlockInfo {
+	return &types.BlockInfo{
+		Height:     block.Height,
+		Time:       block.Time,
+		Hash:       block.Hash().String(),
+		ParentHash: block.LastBlockID.Hash.String(),
+		Proposer:   block.ProposerAddress.String(),
+		TxCount:    len(block.Txs),
+	}
+}
@@ -0,0 +1,368 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cosmos/cosmos-sdk/types/bech32"
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/testkit"
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+// newTestkitClient serves a testkit chain of n blocks and connects a client
+// to it that retries quickly
+func newTestkitClient(t *testing.T, n int) (*testkit.Chain, *testkit.Node, *CosmosSDKClient) {
+	chain := testkit.NewChain(testChainID)
+	chain.Append(make([]testkit.Block, n)...)
+	node := testkit.NewNode(t, chain)
+
+	c, err := NewCosmosSDKClient(&types.ChainConfig{
+		RPCEndpoint: node.URL,
+		Timeout:     5 * time.Second,
+		MaxRetries:  5,
+		RetryDelay:  time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return chain, node, c
+}
+
+func TestCosmosSDKClientTestkitNode(t *testing.T) {
+	chain, node, c := newTestkitClient(t, 100)
+	ctx := context.Background()
+
+	// Every batch is throttled or fails once before it is served
+	node.Fail("blockchain", 429, 3)
+	node.Fail("blockchain", 502, 2)
+
+	blocks, err := c.GetBlockRange(ctx, 1, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, block := range blocks {
+		want := chain.Block(block.Height)
+		if block.Hash != want.Hash().String() || block.Proposer != want.ProposerAddress.String() {
+			t.Fatalf("got block %d with hash %s from %s", block.Height, block.Hash, block.Proposer)
+		}
+		if block.Height > 1 && block.BlockTime != testkit.DefaultBlockTime.Seconds() {
+			t.Fatalf("got block %d after %vs", block.Height, block.BlockTime)
+		}
+	}
+	if err := VerifyLinkage(blocks); err != nil {
+		t.Error(err)
+	}
+	if stats := c.Stats(); stats.Retries != 5 {
+		t.Errorf("got %d retries, want 5", stats.Retries)
+	}
+
+	node.Prune(1, 50)
+	status, err := c.GetStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.EarliestHeight != 51 || status.LatestHeight != 100 {
+		t.Errorf("got status %+v", status)
+	}
+	if _, err := c.GetBlockRange(ctx, 41, 60); err == nil || !strings.Contains(err.Error(), "node did not return block 41") {
+		t.Errorf("got error %v for pruned heights", err)
+	}
+}
+
+// receiveBlocks reads the blocks from..to off blocks, in order and with their
+// block times, and fails the test on any other block
+func receiveBlocks(ctx context.Context, t *testing.T, chain *testkit.Chain, blocks <-chan *types.BlockInfo, from, to int64) {
+	t.Helper()
+
+	for want := from; want <= to; want++ {
+		select {
+		case block := <-blocks:
+			if block.Height != want || block.BlockTime != testkit.DefaultBlockTime.Seconds() || block.Hash != chain.Block(want).Hash().String() {
+				t.Fatalf("got block %d after %vs, want block %d", block.Height, block.BlockTime, want)
+			}
+		case <-ctx.Done():
+			t.Fatalf("block %d was not delivered", want)
+		}
+	}
+}
+
+// receiveFirstBlock reads the first block of a subscription off blocks, which
+// has no block time as there is no block before it
+func receiveFirstBlock(ctx context.Context, t *testing.T, blocks <-chan *types.BlockInfo, height int64) {
+	t.Helper()
+
+	select {
+	case block := <-blocks:
+		if block.Height != height || block.BlockTime != 0 {
+			t.Fatalf("got block %d after %vs, want block %d first", block.Height, block.BlockTime, height)
+		}
+	case <-ctx.Done():
+		t.Fatalf("block %d was not delivered", height)
+	}
+}
+
+// waitForSubscriptions waits until the node has seen n subscriptions
+func waitForSubscriptions(ctx context.Context, t *testing.T, node *testkit.Node, n int) {
+	t.Helper()
+
+	for node.Calls("subscribe") < n {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("got %d subscriptions, want %d", node.Calls("subscribe"), n)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestCosmosSDKClientSubscribeNewBlocks(t *testing.T) {
+	chain, node, c := newTestkitClient(t, 10)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	// The first websocket handshake fails, the subscription reconnects
+	node.Fail("websocket", 503, 1)
+	blockChan, errChan := c.SubscribeNewBlocks(ctx)
+
+	select {
+	case err := <-errChan:
+		if err == nil {
+			t.Fatal("error channel closed")
+		}
+	case <-ctx.Done():
+		t.Fatal("failed handshake was not reported")
+	}
+	waitForSubscriptions(ctx, t, node, 1)
+
+	chain.Append(make([]testkit.Block, 3)...)
+	receiveFirstBlock(ctx, t, blockChan, 11)
+	receiveBlocks(ctx, t, chain, blockChan, 12, 13)
+
+	// Blocks committed while the connection is down are backfilled once
+	// blocks stream again
+	node.Disconnect()
+	chain.Append(make([]testkit.Block, 3)...)
+	waitForSubscriptions(ctx, t, node, 2)
+	chain.Append(testkit.Block{})
+	receiveBlocks(ctx, t, chain, blockChan, 14, 17)
+
+	select {
+	case block := <-blockChan:
+		t.Errorf("got block %d again", block.Height)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestCosmosSDKClientSubscribeStall(t *testing.T) {
+	subscriptionStallTimeout = 300 * time.Millisecond
+	chain, node, c := newTestkitClient(t, 10)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	blockChan, _ := c.SubscribeNewBlocks(ctx)
+	defer func() {
+		// The subscription reads the timeout until its channels close
+		cancel()
+		for range blockChan {
+		}
+		subscriptionStallTimeout = 30 * time.Second
+	}()
+
+	waitForSubscriptions(ctx, t, node, 1)
+	chain.Append(make([]testkit.Block, 2)...)
+	receiveFirstBlock(ctx, t, blockChan, 11)
+	receiveBlocks(ctx, t, chain, blockChan, 12, 12)
+
+	// The websocket stays open but goes quiet while the chain advances,
+	// which is noticed and fixed with a new connection
+	node.MuteEvents(true)
+	chain.Append(make([]testkit.Block, 2)...)
+	waitForSubscriptions(ctx, t, node, 2)
+	node.MuteEvents(false)
+	chain.Append(testkit.Block{})
+	receiveBlocks(ctx, t, chain, blockChan, 13, 15)
+}
+
+func TestCosmosSDKClientCommits(t *testing.T) {
+	chain := testkit.NewChain(testChainID,
+		testkit.Validator{Name: "alpha", Power: 40},
+		testkit.Validator{Name: "beta", Power: 30},
+		testkit.Validator{Name: "gamma", Power: 20},
+		testkit.Validator{Name: "delta", Power: 10},
+	)
+	chain.Append(make([]testkit.Block, 5)...)
+	chain.Append(testkit.Block{Round: 2, Absent: []string{"delta"}, Nil: []string{"gamma"}})
+	chain.Append(make([]testkit.Block, 4)...)
+	node := testkit.NewNode(t, chain)
+
+	var warnings []string
+	newClient := func() *CosmosSDKClient {
+		c, err := NewCosmosSDKClient(&types.ChainConfig{
+			RPCEndpoint: node.URL,
+			Timeout:     5 * time.Second,
+			MaxRetries:  2,
+			RetryDelay:  time.Millisecond,
+			Commits:     true,
+			Logf:        func(format string, args ...any) { warnings = append(warnings, fmt.Sprintf(format, args...)) },
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { c.Close() })
+		return c
+	}
+
+	blocks, err := newClient().GetBlockRange(context.Background(), 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, block := range blocks {
+		want := types.CommitInfo{Signatures: 4, SignedPower: 1}
+		switch block.Height {
+		case 1:
+			want = types.CommitInfo{}
+		case 6:
+			want = types.CommitInfo{Round: 2, Signatures: 2, Absent: 1, Nil: 1, SignedPower: 0.7}
+		}
+		if block.Commit == nil || *block.Commit != want {
+			t.Errorf("got commit %+v in block %d, want %+v", block.Commit, block.Height, want)
+		}
+	}
+	if err := VerifyLinkage(blocks); err != nil {
+		t.Error(err)
+	}
+	// Full blocks replace the header batches, and the unchanged validator set is fetched once
+	if got := node.Calls("blockchain"); got != 0 {
+		t.Errorf("got %d blockchain calls", got)
+	}
+	if got := node.Calls("validators"); got != 1 {
+		t.Errorf("got %d validators calls, want 1", got)
+	}
+
+	// Without the validator set, blocks still come with their votes
+	node.Fail("validators", 500, 100)
+	block, err := newClient().GetBlockByHeight(context.Background(), 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (types.CommitInfo{Round: 2, Signatures: 2, Absent: 1, Nil: 1}); *block.Commit != want {
+		t.Errorf("got commit %+v, want %+v", block.Commit, want)
+	}
+	var unknown int
+	for _, warning := range warnings {
+		if strings.Contains(warning, "signed voting power unknown") {
+			unknown++
+		}
+	}
+	if unknown != 1 {
+		t.Errorf("got warnings %q, want signed power reported unknown once", warnings)
+	}
+}
+
+func TestCosmosSDKClientLoad(t *testing.T) {
+	chain := testkit.NewChain(testChainID)
+	for height := int64(1); height <= 30; height++ {
+		chain.Append(testkit.Block{Txs: int(height % 4), GasWanted: 120000, GasUsed: 90000})
+	}
+	node := testkit.NewNode(t, chain)
+
+	newClient := func(commits bool) *CosmosSDKClient {
+		c, err := NewCosmosSDKClient(&types.ChainConfig{
+			RPCEndpoint: node.URL,
+			Timeout:     5 * time.Second,
+			MaxRetries:  2,
+			RetryDelay:  time.Millisecond,
+			Commits:     commits,
+			Load:        true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { c.Close() })
+		return c
+	}
+
+	// The size comes from the block meta, or from the full block with commits
+	for _, commits := range []bool{false, true} {
+		blocks, err := newClient(commits).GetBlockRange(context.Background(), 1, 30)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, block := range blocks {
+			txs := block.Height % 4
+			want := types.LoadInfo{GasUsed: 90000 * txs, GasWanted: 120000 * txs, Events: int(txs), Size: chain.Block(block.Height).Size()}
+			if block.Load == nil || *block.Load != want {
+				t.Errorf("commits %v: got load %+v in block %d, want %+v", commits, block.Load, block.Height, want)
+			}
+		}
+		if err := VerifyLinkage(blocks); err != nil {
+			t.Error(err)
+		}
+	}
+	if got := node.Calls("block_results"); got != 60 {
+		t.Errorf("got %d block_results calls, want 60", got)
+	}
+
+	// Blocks are not served without their load
+	node.Fail("block_results", 500, 3)
+	_, err := newClient(false).GetBlockByHeight(context.Background(), 1)
+	if err == nil || !strings.Contains(err.Error(), "failed to get block results at height 1") {
+		t.Errorf("got error %v, want the failed block results reported", err)
+	}
+}
+
+func TestCosmosSDKClientValidators(t *testing.T) {
+	chain := testkit.NewChain(testChainID,
+		testkit.Validator{Name: "alpha", Power: 30},
+		testkit.Validator{Name: "beta", Power: 20},
+		testkit.Validator{Name: "gamma", Power: 10},
+	)
+	chain.Append(make([]testkit.Block, 30)...)
+	node := testkit.NewNode(t, chain)
+
+	c, err := NewCosmosSDKClient(&types.ChainConfig{
+		RPCEndpoint: node.URL,
+		Timeout:     5 * time.Second,
+		MaxRetries:  2,
+		RetryDelay:  time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	blocks, err := c.GetBlockRange(ctx, 1, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	validators, err := ResolveValidators(ctx, c, blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := DescribeValidators(ctx, c, validators, "osmo"); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, power := range map[string]int64{"alpha": 30, "beta": 20, "gamma": 10} {
+		val := validators[chain.Address(name)]
+		if val == nil {
+			t.Errorf("%s was not resolved", name)
+			continue
+		}
+		_, operator, err := bech32.DecodeAndConvert(chain.OperatorAddress(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _ := bech32.ConvertAndEncode("osmovaloper", operator)
+		if val.Moniker != name || val.VotingPower != power || val.OperatorAddress != want {
+			t.Errorf("got %+v for %s, want moniker %s, power %d and operator %s", val, name, name, power, want)
+		}
+	}
+	if got := node.Calls("validators"); got != 1 {
+		t.Errorf("got %d validators calls, want 1", got)
+	}
+}
@@ -0,0 +1,211 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cometbft/cometbft/crypto/ed25519"
+	"github.com/cometbft/cometbft/crypto/secp256k1"
+	codectypes "github.com/cosmos/cosmos-sdk/codec/types"
+	sdked25519 "github.com/cosmos/cosmos-sdk/crypto/keys/ed25519"
+	sdksecp256k1 "github.com/cosmos/cosmos-sdk/crypto/keys/secp256k1"
+	"github.com/cosmos/cosmos-sdk/types/bech32"
+	"github.com/cosmos/cosmos-sdk/types/query"
+	stakingtypes "github.com/cosmos/cosmos-sdk/x/staking/types"
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+// stakingValidatorsPath is the staking module query for all validators,
+// which nodes also answer over abci_query
+const stakingValidatorsPath = "/cosmos.staking.v1beta1.Query/Validators"
+
+// Type URLs of the consensus keys validators can have
+const (
+	ed25519KeyType   = "/cosmos.crypto.ed25519.PubKey"
+	secp256k1KeyType = "/cosmos.crypto.secp256k1.PubKey"
+)
+
+// ValidatorSetClient is implemented by clients that serve the CometBFT
+// validator set of a height, with the address and voting power of every validator
+type ValidatorSetClient interface {
+	GetValidatorSet(ctx context.Context, height int64) ([]types.ValidatorInfo, error)
+}
+
+// StakingClient is implemented by clients that can query the validators of
+// the staking module, with the address, moniker and operator address of every validator
+type StakingClient interface {
+	GetStakingValidators(ctx context.Context) ([]types.ValidatorInfo, error)
+}
+
+// findClient returns the first client in the wrapper chain of c that implements T
+func findClient[T any](c BlockchainClient) (T, bool) {
+	for {
+		if found, ok := c.(T); ok {
+			return found, true
+		}
+
+		wrapper, ok := c.(Wrapper)
+		if !ok {
+			var none T
+			return none, false
+		}
+		c = wrapper.Unwrap()
+	}
+}
+
+// ResolveValidators looks up the proposers of blocks in the validator sets,
+// keyed by consensus address. The set of the last block is fetched first,
+// then the set at the first block of every proposer not found so far, so
+// validators that left the set during the range are found too. Proposers in
+// none of the sets are left out
+func ResolveValidators(ctx context.Context, c BlockchainClient, blocks []*types.BlockInfo) (map[string]*types.ValidatorInfo, error) {
+	sets, ok := findClient[ValidatorSetClient](c)
+	if !ok {
+		return nil, fmt.Errorf("validator sets are not available from this source")
+	}
+
+	validators := make(map[string]*types.ValidatorInfo)
+	if len(blocks) == 0 {
+		return validators, nil
+	}
+
+	fetch := func(height int64) error {
+		set, err := sets.GetValidatorSet(ctx, height)
+		if err != nil {
+			return fmt.Errorf("failed to get the validators of height %d: %w", height, err)
+		}
+		for i := range set {
+			if _, ok := validators[set[i].Address]; !ok {
+				validators[set[i].Address] = &set[i]
+			}
+		}
+		return nil
+	}
+
+	if err := fetch(blocks[len(blocks)-1].Height); err != nil {
+		return nil, err
+	}
+	looked := make(map[string]bool)
+	for _, block := range blocks {
+		if _, ok := validators[block.Proposer]; ok || looked[block.Proposer] {
+			continue
+		}
+		looked[block.Proposer] = true
+		if err := fetch(block.Height); err != nil {
+			return nil, err
+		}
+	}
+	return validators, nil
+}
+
+// DescribeValidators sets the moniker and operator address of validators
+// from the staking module. Operator addresses are encoded with the valoper
+// prefix of bech32Prefix, or kept as the node returns them without one
+func DescribeValidators(ctx context.Context, c BlockchainClient, validators map[string]*types.ValidatorInfo, bech32Prefix string) error {
+	staking, ok := findClient[StakingClient](c)
+	if !ok {
+		return fmt.Errorf("the staking module cannot be queried from this source")
+	}
+
+	described, err := staking.GetStakingValidators(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to query the staking module: %w", err)
+	}
+
+	for _, d := range described {
+		val, ok := validators[d.Address]
+		if !ok {
+			continue
+		}
+		val.Moniker = d.Moniker
+		val.OperatorAddress = d.OperatorAddress
+		if bech32Prefix == "" {
+			continue
+		}
+		if _, operator, err := bech32.DecodeAndConvert(d.OperatorAddress); err == nil {
+			if encoded, err := bech32.ConvertAndEncode(bech32Prefix+"valoper", operator); err == nil {
+				val.OperatorAddress = encoded
+			}
+		}
+	}
+	return nil
+}
+
+// validatorInfos converts a validator set fetched for signed power
+func validatorInfos(set []validatorPower) []types.ValidatorInfo {
+	infos := make([]types.ValidatorInfo, len(set))
+	for i, val := range set {
+		infos[i] = types.ValidatorInfo{Address: val.address, VotingPower: val.power}
+	}
+	return infos
+}
+
+// stakingValidators pages through the validators of the staking module with
+// fetch. Validators whose consensus key cannot be decoded are left out, as
+// they cannot be matched to any proposer
+func stakingValidators(ctx context.Context, fetch func(ctx context.Context, req *stakingtypes.QueryValidatorsRequest) (*stakingtypes.QueryValidatorsResponse, error)) ([]types.ValidatorInfo, error) {
+	var described []types.ValidatorInfo
+	req := &stakingtypes.QueryValidatorsRequest{Pagination: &query.PageRequest{Limit: maxValidatorsPerPage}}
+	for {
+		resp, err := fetch(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, val := range resp.Validators {
+			if val.ConsensusPubkey == nil {
+				continue
+			}
+			key, err := consensusKey(val.ConsensusPubkey)
+			if err != nil {
+				continue
+			}
+			address, err := consensusAddress(val.ConsensusPubkey.TypeUrl, key)
+			if err != nil {
+				continue
+			}
+			described = append(described, types.ValidatorInfo{
+				Address:         address,
+				Moniker:         val.Description.Moniker,
+				OperatorAddress: val.OperatorAddress,
+			})
+		}
+		if len(resp.Validators) == 0 || resp.Pagination == nil || len(resp.Pagination.NextKey) == 0 {
+			return described, nil
+		}
+		req.Pagination.Key = resp.Pagination.NextKey
+	}
+}
+
+// consensusKey extracts the raw public key from a consensus key packed in an Any
+func consensusKey(pubkey *codectypes.Any) ([]byte, error) {
+	switch pubkey.TypeUrl {
+	case ed25519KeyType:
+		var key sdked25519.PubKey
+		err := key.Unmarshal(pubkey.Value)
+		return key.Key, err
+	case secp256k1KeyType:
+		var key sdksecp256k1.PubKey
+		err := key.Unmarshal(pubkey.Value)
+		return key.Key, err
+	}
+	return nil, fmt.Errorf("unsupported consensus key type %s", pubkey.TypeUrl)
+}
+
+// consensusAddress derives the hex consensus address of a raw public key of
+// the consensus key type named by keyType
+func consensusAddress(keyType string, key []byte) (string, error) {
+	switch keyType {
+	case ed25519KeyType:
+		if len(key) != ed25519.PubKeySize {
+			return "", fmt.Errorf("invalid ed25519 key of %d bytes", len(key))
+		}
+		return ed25519.PubKey(key).Address().String(), nil
+	case secp256k1KeyType:
+		if len(key) != secp256k1.PubKeySize {
+			return "", fmt.Errorf("invalid secp256k1 key of %d bytes", len(key))
+		}
+		return secp256k1.PubKey(key).Address().String(), nil
+	}
+	return "", fmt.Errorf("unsupported consensus key type %s", keyType)
+}
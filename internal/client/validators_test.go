@@ -0,0 +1,239 @@
+package client
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cometbft/cometbft/crypto/ed25519"
+	"github.com/cometbft/cometbft/crypto/secp256k1"
+	codectypes "github.com/cosmos/cosmos-sdk/codec/types"
+	sdked25519 "github.com/cosmos/cosmos-sdk/crypto/keys/ed25519"
+	sdksecp256k1 "github.com/cosmos/cosmos-sdk/crypto/keys/secp256k1"
+	"github.com/cosmos/cosmos-sdk/types/bech32"
+	"github.com/cosmos/cosmos-sdk/types/query"
+	stakingtypes "github.com/cosmos/cosmos-sdk/x/staking/types"
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/simulate"
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+// testStakingValidators are validators of the staking module with ed25519
+// and secp256k1 consensus keys, and one with a key type that cannot be
+// matched to proposers
+func testStakingValidators() []stakingtypes.Validator {
+	pack := func(pubkey *codectypes.Any, err error) *codectypes.Any {
+		if err != nil {
+			panic(err)
+		}
+		return pubkey
+	}
+	keys := []struct {
+		moniker string
+		pubkey  *codectypes.Any
+	}{
+		{"alpha", pack(codectypes.NewAnyWithValue(&sdked25519.PubKey{Key: ed25519.GenPrivKeyFromSecret([]byte("alpha")).PubKey().Bytes()}))},
+		{"beta", pack(codectypes.NewAnyWithValue(&sdksecp256k1.PubKey{Key: secp256k1.GenPrivKeySecp256k1([]byte("beta")).PubKey().Bytes()}))},
+		{"gamma", pack(codectypes.NewAnyWithValue(&sdked25519.PubKey{Key: ed25519.GenPrivKeyFromSecret([]byte("gamma")).PubKey().Bytes()}))},
+		{"delta", &codectypes.Any{TypeUrl: "/cosmos.crypto.bls12_381.PubKey", Value: []byte{0x0a, 0x01, 0x01}}},
+	}
+
+	vals := make([]stakingtypes.Validator, len(keys))
+	for i, k := range keys {
+		vals[i] = stakingtypes.Validator{
+			OperatorAddress: testOperatorAddress(k.moniker),
+			ConsensusPubkey: k.pubkey,
+			Description:     stakingtypes.Description{Moniker: k.moniker},
+		}
+	}
+	return vals
+}
+
+// testOperatorAddress is the operator address of a test validator, derived
+// from its moniker
+func testOperatorAddress(moniker string) string {
+	address, _ := bech32.ConvertAndEncode("cosmosvaloper", []byte(strings.Repeat(moniker[:1], 20)))
+	return address
+}
+
+// testStakingInfos is how the validators of testStakingValidators are described
+func testStakingInfos() []types.ValidatorInfo {
+	return []types.ValidatorInfo{
+		{Address: ed25519.GenPrivKeyFromSecret([]byte("alpha")).PubKey().Address().String(), Moniker: "alpha", OperatorAddress: testOperatorAddress("alpha")},
+		{Address: secp256k1.GenPrivKeySecp256k1([]byte("beta")).PubKey().Address().String(), Moniker: "beta", OperatorAddress: testOperatorAddress("beta")},
+		{Address: ed25519.GenPrivKeyFromSecret([]byte("gamma")).PubKey().Address().String(), Moniker: "gamma", OperatorAddress: testOperatorAddress("gamma")},
+	}
+}
+
+// stakingPage serves the page of testStakingValidators that req asks for.
+// Keys are offsets, like the testkit node uses
+func stakingPage(req *stakingtypes.QueryValidatorsRequest) *stakingtypes.QueryValidatorsResponse {
+	vals := testStakingValidators()
+	var offset int
+	if req.Pagination != nil && len(req.Pagination.Key) > 0 {
+		offset, _ = strconv.Atoi(string(req.Pagination.Key))
+	}
+	limit := len(vals)
+	if req.Pagination != nil && req.Pagination.Limit > 0 {
+		limit = int(req.Pagination.Limit)
+	}
+
+	end := min(offset+limit, len(vals))
+	resp := &stakingtypes.QueryValidatorsResponse{
+		Validators: vals[min(offset, len(vals)):end],
+		Pagination: &query.PageResponse{Total: uint64(len(vals))},
+	}
+	if end < len(vals) {
+		resp.Pagination.NextKey = []byte(strconv.Itoa(end))
+	}
+	return resp
+}
+
+// validatorSetClient serves validator sets that change with the height
+type validatorSetClient struct {
+	*simulate.Node
+
+	sets    func(height int64) []types.ValidatorInfo
+	fetched []int64 // heights of the sets served, in order
+}
+
+func (c *validatorSetClient) GetValidatorSet(ctx context.Context, height int64) ([]types.ValidatorInfo, error) {
+	c.fetched = append(c.fetched, height)
+	return c.sets(height), nil
+}
+
+// stakingClient serves described validators
+type stakingClient struct {
+	*simulate.Node
+
+	described []types.ValidatorInfo
+}
+
+func (c *stakingClient) GetStakingValidators(ctx context.Context) ([]types.ValidatorInfo, error) {
+	return c.described, nil
+}
+
+func TestResolveValidators(t *testing.T) {
+	// A and B validate throughout, C leaves the set after height 10 and
+	// D never was in it
+	c := &validatorSetClient{
+		Node: newTestNode(t, 100),
+		sets: func(height int64) []types.ValidatorInfo {
+			set := []types.ValidatorInfo{{Address: "A", VotingPower: 10 + height}, {Address: "B", VotingPower: 5}}
+			if height <= 10 {
+				set = append(set, types.ValidatorInfo{Address: "C", VotingPower: 1})
+			}
+			return set
+		},
+	}
+	var blocks []*types.BlockInfo
+	for height := int64(1); height <= 20; height++ {
+		proposer := []string{"A", "B", "C", "D"}[height%4]
+		if height > 10 && proposer == "C" {
+			proposer = "A"
+		}
+		blocks = append(blocks, &types.BlockInfo{Height: height, Proposer: proposer})
+	}
+
+	validators, err := ResolveValidators(context.Background(), c, blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]types.ValidatorInfo{
+		"A": {Address: "A", VotingPower: 30},
+		"B": {Address: "B", VotingPower: 5},
+		"C": {Address: "C", VotingPower: 1},
+	}
+	if len(validators) != len(want) {
+		t.Errorf("got %d validators, want %d", len(validators), len(want))
+	}
+	for address, val := range want {
+		if got := validators[address]; got == nil || *got != val {
+			t.Errorf("got validator %+v for %s, want %+v", got, address, val)
+		}
+	}
+
+	// The last set, then the sets at the first blocks of C and D
+	if got, want := c.fetched, []int64{20, 2, 3}; !slices.Equal(got, want) {
+		t.Errorf("got validator sets of heights %v, want %v", got, want)
+	}
+
+	if _, err := ResolveValidators(context.Background(), newTestNode(t, 100), blocks); err == nil || !strings.Contains(err.Error(), "not available") {
+		t.Errorf("got error %v, want validator sets reported unavailable", err)
+	}
+}
+
+func TestDescribeValidators(t *testing.T) {
+	infos := testStakingInfos()
+	c := &stakingClient{Node: newTestNode(t, 100), described: infos}
+
+	for _, tt := range []struct {
+		prefix string
+		want   string
+	}{
+		{"", "cosmosvaloper1"},
+		{"osmo", "osmovaloper1"},
+	} {
+		t.Run("prefix="+tt.prefix, func(t *testing.T) {
+			validators := map[string]*types.ValidatorInfo{
+				infos[0].Address: {Address: infos[0].Address, VotingPower: 7},
+				"UNKNOWN":        {Address: "UNKNOWN", VotingPower: 1},
+			}
+			if err := DescribeValidators(context.Background(), c, validators, tt.prefix); err != nil {
+				t.Fatal(err)
+			}
+
+			val := validators[infos[0].Address]
+			if val.Moniker != "alpha" || val.VotingPower != 7 || !strings.HasPrefix(val.OperatorAddress, tt.want) {
+				t.Errorf("got %+v, want alpha described with a %s operator address", val, tt.want)
+			}
+			_, got, _ := bech32.DecodeAndConvert(val.OperatorAddress)
+			_, want, _ := bech32.DecodeAndConvert(infos[0].OperatorAddress)
+			if string(got) != string(want) {
+				t.Errorf("got operator %X, want %X", got, want)
+			}
+			if unknown := validators["UNKNOWN"]; unknown.Moniker != "" || unknown.OperatorAddress != "" {
+				t.Errorf("got %+v described, want it left as is", unknown)
+			}
+		})
+	}
+
+	if err := DescribeValidators(context.Background(), newTestNode(t, 100), nil, ""); err == nil || !strings.Contains(err.Error(), "cannot be queried") {
+		t.Errorf("got error %v, want the staking module reported unavailable", err)
+	}
+}
+
+func TestStakingValidators(t *testing.T) {
+	var calls int
+	described, err := stakingValidators(context.Background(), func(ctx context.Context, req *stakingtypes.QueryValidatorsRequest) (*stakingtypes.QueryValidatorsResponse, error) {
+		calls++
+		req.Pagination.Limit = 3 // a node capping pages below the limit asked for
+		return stakingPage(req), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if calls != 2 {
+		t.Errorf("got %d pages, want 2", calls)
+	}
+	assertStakingInfos(t, described)
+}
+
+// assertStakingInfos checks that described are the validators of
+// testStakingValidators with a supported consensus key
+func assertStakingInfos(t *testing.T, described []types.ValidatorInfo) {
+	t.Helper()
+
+	want := testStakingInfos()
+	if len(described) != len(want) {
+		t.Fatalf("got %d validators, want %d", len(described), len(want))
+	}
+	for i := range want {
+		if described[i] != want[i] {
+			t.Errorf("got validator %+v, want %+v", described[i], want[i])
+		}
+	}
+}
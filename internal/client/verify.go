@@ -0,0 +1,32 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+// VerifyNode checks that the node behind c serves the configured chain and is
+// in sync, so results are never computed from the wrong chain or a node that
+// lags behind. SkipChainIDCheck and AllowCatchingUp in config turn the
+// respective check off. The node status is returned so callers can warn about
+// the checks that were skipped.
+func VerifyNode(ctx context.Context, c BlockchainClient, config *types.ChainConfig) (*types.NodeStatus, error) {
+	status, err := c.GetStatus(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify node: %w", err)
+	}
+
+	if config.ChainID != "" && status.ChainID != config.ChainID && !config.SkipChainIDCheck {
+		return nil, fmt.Errorf("node serves chain %s but chain ID %s is configured (set --chain-id %s, or --skip-chain-id-check to use the node anyway)",
+			status.ChainID, config.ChainID, status.ChainID)
+	}
+
+	if status.CatchingUp && !config.AllowCatchingUp {
+		return nil, fmt.Errorf("node is catching up at height %d and lags behind the chain (use --allow-catching-up to use it anyway)",
+			status.LatestHeight)
+	}
+
+	return status, nil
+}
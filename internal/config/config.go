@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/qj0r9j0vc2/blocktime-calculator/internal/registry"
 	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
 	"github.com/spf13/viper"
 )
@@ -13,6 +14,13 @@ type Config struct {
 	Chain      types.ChainConfig      `json:"chain" mapstructure:"chain"`
 	Calculator types.CalculatorConfig `json:"calculator" mapstructure:"calculator"`
 	Output     OutputConfig           `json:"output" mapstructure:"output"`
+	Cache      CacheConfig            `json:"cache" mapstructure:"cache"`
+}
+
+// CacheConfig represents the block header cache configuration
+type CacheConfig struct {
+	Enabled bool   `json:"enabled" mapstructure:"enabled"` // Cache fetched block headers on disk
+	Dir     string `json:"dir" mapstructure:"dir"`         // Cache directory (default: ~/.cache/blocktime-calculator)
 }
 
 // OutputConfig represents output formatting configuration
@@ -27,12 +35,19 @@ type OutputConfig struct {
 func DefaultConfig() *Config {
 	return &Config{
 		Chain: types.ChainConfig{
-			RPCEndpoint:  "http://localhost:26657",
-			GRPCEndpoint: "localhost:9090",
-			ChainID:      "cosmoshub-4",
-			Timeout:      30 * time.Second,
-			MaxRetries:   3,
-			RetryDelay:   time.Second,
+			RPCEndpoint:    "http://localhost:26657",
+			GRPCEndpoint:   "localhost:9090",
+			RESTEndpoint:   "http://localhost:1317",
+			EVMEndpoint:    "http://localhost:8545",
+			Transport:      "rpc",
+			ChainID:        "cosmoshub-4",
+			Timeout:        30 * time.Second,
+			MaxRetries:     3,
+			RetryDelay:     time.Second,
+			MaxConcurrency: 10,
+			Light: types.LightConfig{
+				TrustPeriod: 168 * time.Hour,
+			},
 		},
 		Calculator: types.CalculatorConfig{
 			SampleSize:        100,
@@ -48,6 +63,10 @@ func DefaultConfig() *Config {
 			PrettyPrint: true,
 			SaveToFile:  "",
 		},
+		Cache: CacheConfig{
+			Enabled: true,
+			Dir:     "",
+		},
 	}
 }
 
@@ -74,17 +93,63 @@ func BuildConfig() (*Config, error) {
 		}
 	}
 
+	if viper.IsSet("cache") {
+		if err := viper.UnmarshalKey("cache", &cfg.Cache); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal cache config: %w", err)
+		}
+	}
+
+	// Resolve a chain name from the chain registry, explicit flags still override it
+	if viper.IsSet("chain-name") {
+		if err := applyRegistry(&cfg.Chain, viper.GetString("chain-name"), viper.GetString("registry")); err != nil {
+			return nil, err
+		}
+	}
+
 	// Override with CLI flags and viper settings
 	// Chain configuration
 	if viper.IsSet("rpc") {
-		cfg.Chain.RPCEndpoint = viper.GetString("rpc")
+		cfg.Chain.RPCEndpoints = viper.GetStringSlice("rpc")
+		cfg.Chain.RPCEndpoint = ""
 	}
 	if viper.IsSet("grpc") {
-		cfg.Chain.GRPCEndpoint = viper.GetString("grpc")
+		cfg.Chain.GRPCEndpoints = viper.GetStringSlice("grpc")
+		cfg.Chain.GRPCEndpoint = ""
+	}
+	if viper.IsSet("rest") {
+		cfg.Chain.RESTEndpoints = viper.GetStringSlice("rest")
+		cfg.Chain.RESTEndpoint = ""
+	}
+	if viper.IsSet("evm") {
+		cfg.Chain.EVMEndpoint = viper.GetString("evm")
+	}
+	if viper.IsSet("home") {
+		cfg.Chain.Home = viper.GetString("home")
+	}
+	if viper.IsSet("from-file") {
+		cfg.Chain.FromFile = viper.GetString("from-file")
+	}
+	if viper.IsSet("simulate") {
+		cfg.Chain.Simulate = viper.GetString("simulate")
+	}
+	if viper.IsSet("commits") {
+		cfg.Chain.Commits = viper.GetBool("commits")
+	}
+	if viper.IsSet("load") {
+		cfg.Chain.Load = viper.GetBool("load")
+	}
+	if viper.IsSet("transport") {
+		cfg.Chain.Transport = viper.GetString("transport")
 	}
 	if viper.IsSet("chain-id") {
 		cfg.Chain.ChainID = viper.GetString("chain-id")
 	}
+	if viper.IsSet("skip-chain-id-check") {
+		cfg.Chain.SkipChainIDCheck = viper.GetBool("skip-chain-id-check")
+	}
+	if viper.IsSet("allow-catching-up") {
+		cfg.Chain.AllowCatchingUp = viper.GetBool("allow-catching-up")
+	}
 	if viper.IsSet("timeout") {
 		cfg.Chain.Timeout = viper.GetDuration("timeout")
 	}
@@ -94,6 +159,38 @@ func BuildConfig() (*Config, error) {
 	if viper.IsSet("retry-delay") {
 		cfg.Chain.RetryDelay = viper.GetDuration("retry-delay")
 	}
+	if viper.IsSet("max-concurrency") {
+		cfg.Chain.MaxConcurrency = viper.GetInt("max-concurrency")
+	}
+	if viper.IsSet("rps") {
+		cfg.Chain.RequestsPerSecond = viper.GetFloat64("rps")
+	}
+	if viper.IsSet("light") {
+		cfg.Chain.Light.Enabled = viper.GetBool("light")
+	}
+	if viper.IsSet("trust-height") {
+		cfg.Chain.Light.TrustHeight = viper.GetInt64("trust-height")
+	}
+	if viper.IsSet("trust-hash") {
+		cfg.Chain.Light.TrustHash = viper.GetString("trust-hash")
+	}
+	if viper.IsSet("trust-period") {
+		cfg.Chain.Light.TrustPeriod = viper.GetDuration("trust-period")
+	}
+	if viper.IsSet("witness") {
+		cfg.Chain.Light.Witnesses = viper.GetStringSlice("witness")
+	}
+
+	// The first of several endpoints doubles as the single endpoint
+	if len(cfg.Chain.RPCEndpoints) > 0 && cfg.Chain.RPCEndpoint == "" {
+		cfg.Chain.RPCEndpoint = cfg.Chain.RPCEndpoints[0]
+	}
+	if len(cfg.Chain.GRPCEndpoints) > 0 && cfg.Chain.GRPCEndpoint == "" {
+		cfg.Chain.GRPCEndpoint = cfg.Chain.GRPCEndpoints[0]
+	}
+	if len(cfg.Chain.RESTEndpoints) > 0 && cfg.Chain.RESTEndpoint == "" {
+		cfg.Chain.RESTEndpoint = cfg.Chain.RESTEndpoints[0]
+	}
 
 	// Calculator configuration
 	if viper.IsSet("sample-size") {
@@ -114,6 +211,12 @@ func BuildConfig() (*Config, error) {
 	if viper.IsSet("use-mad") {
 		cfg.Calculator.UseMedianAbsolute = viper.GetBool("use-mad")
 	}
+	if viper.IsSet("allow-gaps") {
+		cfg.Calculator.AllowGaps = viper.GetBool("allow-gaps")
+	}
+	if viper.IsSet("verify-linkage") {
+		cfg.Calculator.VerifyLinkage = viper.GetBool("verify-linkage")
+	}
 
 	// Output configuration
 	// Check for output format from CLI flag first, then from config file
@@ -132,6 +235,14 @@ func BuildConfig() (*Config, error) {
 		cfg.Output.SaveToFile = viper.GetString("save-to-file")
 	}
 
+	// Cache configuration
+	if viper.IsSet("no-cache") {
+		cfg.Cache.Enabled = !viper.GetBool("no-cache")
+	}
+	if viper.IsSet("cache-dir") {
+		cfg.Cache.Dir = viper.GetString("cache-dir")
+	}
+
 	// Validate configuration
 	if err := ValidateConfig(cfg); err != nil {
 		return nil, fmt.Errorf("invalid configuration: %w", err)
@@ -140,6 +251,22 @@ func BuildConfig() (*Config, error) {
 	return cfg, nil
 }
 
+// applyRegistry fills chain with the settings of the named chain from the
+// chain registry in dir, or from the bundled snapshot when dir is empty
+func applyRegistry(chain *types.ChainConfig, name, dir string) error {
+	reg, err := registry.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	entry, err := reg.Lookup(name)
+	if err != nil {
+		return err
+	}
+
+	return entry.Apply(chain)
+}
+
 // ValidateConfig validates the configuration
 func ValidateConfig(cfg *Config) error {
 	// Validate chain config
@@ -152,6 +279,38 @@ func ValidateConfig(cfg *Config) error {
 	if cfg.Chain.RetryDelay < 0 {
 		return fmt.Errorf("retry delay must be non-negative")
 	}
+	if cfg.Chain.MaxConcurrency <= 0 {
+		return fmt.Errorf("max concurrency must be positive")
+	}
+	if cfg.Chain.RequestsPerSecond < 0 {
+		return fmt.Errorf("requests per second must be non-negative")
+	}
+	validTransports := map[string]bool{
+		"rpc":  true,
+		"grpc": true,
+		"rest": true,
+		"evm":  true,
+	}
+	if !validTransports[cfg.Chain.Transport] {
+		return fmt.Errorf("invalid transport: %s (must be rpc, grpc, rest, or evm)", cfg.Chain.Transport)
+	}
+	if cfg.Chain.Commits && cfg.Chain.Transport == "evm" {
+		return fmt.Errorf("commit signatures are not available over the evm transport")
+	}
+	if cfg.Chain.Load && cfg.Chain.Transport != "rpc" && cfg.Chain.Home == "" && cfg.Chain.FromFile == "" && cfg.Chain.Simulate == "" {
+		return fmt.Errorf("block results are only available over the rpc transport")
+	}
+	if cfg.Chain.Light.Enabled {
+		if cfg.Chain.Transport != "rpc" || cfg.Chain.Home != "" || cfg.Chain.FromFile != "" || cfg.Chain.Simulate != "" {
+			return fmt.Errorf("light client verification requires the rpc transport")
+		}
+		if cfg.Chain.Light.TrustHeight <= 0 || cfg.Chain.Light.TrustHash == "" {
+			return fmt.Errorf("light client verification requires a trusted height and hash")
+		}
+		if cfg.Chain.Light.TrustPeriod <= 0 {
+			return fmt.Errorf("trust period must be positive")
+		}
+	}
 
 	// Validate calculator config
 	if cfg.Calculator.SampleSize <= 0 {
@@ -202,6 +361,7 @@ func SaveToFile(cfg *Config, path string) error {
 	viper.Set("chain", cfg.Chain)
 	viper.Set("calculator", cfg.Calculator)
 	viper.Set("output", cfg.Output)
+	viper.Set("cache", cfg.Cache)
 
 	if err := viper.WriteConfigAs(path); err != nil {
 		return fmt.Errorf("failed to write config file: %w", err)
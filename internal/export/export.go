@@ -0,0 +1,446 @@
+package export
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/qj0r9j0vc2/blocktime-calculator/internal/client"
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+// Formats supported by Export
+const (
+	FormatJSONL   = "jsonl"
+	FormatCSV     = "csv"
+	FormatParquet = "parquet"
+)
+
+// defaultCheckpointEvery is the number of blocks written between checkpoints
+const defaultCheckpointEvery = 1000
+
+// csvHeader names the CSV columns, in the order of csvRecord. The commit and
+// load columns are empty for blocks fetched without their last commit or load
+var csvHeader = []string{
+	"height", "time", "hash", "parent_hash", "proposer", "tx_count", "block_time", "verified",
+	"commit_round", "commit_signatures", "commit_absent", "commit_nil", "commit_signed_power",
+	"gas_used", "gas_wanted", "events", "size",
+}
+
+// Options configures Export
+type Options struct {
+	ChainID     string
+	Format      string // jsonl, csv or parquet
+	Path        string // Output file
+	StartHeight int64
+	EndHeight   int64 // 0 for the latest height, or the end of the export being resumed
+
+	CheckpointEvery int  // Blocks written between checkpoints
+	AllowGaps       bool // Skip heights that cannot be fetched instead of failing
+	VerifyLinkage   bool // Fail when a block does not link to the block before it
+
+	// Progress is called after every checkpoint with the last exported height
+	// and the number of rows written so far
+	Progress func(height int64, rows int64)
+}
+
+// Result summarizes a finished export
+type Result struct {
+	Path             string `json:"path"`
+	Format           string `json:"format"`
+	StartHeight      int64  `json:"start_height"`
+	EndHeight        int64  `json:"end_height"`
+	Rows             int64  `json:"rows"`
+	MissingBlocks    int64  `json:"missing_blocks"`
+	UnverifiedBlocks int64  `json:"unverified_blocks"`      // rows whose header was not verified by the light client
+	ResumedFrom      int64  `json:"resumed_from,omitempty"` // height the export continued at, 0 for a fresh export
+}
+
+// checkpoint is the progress of an export, saved next to the output file.
+// The first Offset bytes of the data file hold all blocks below NextHeight
+type checkpoint struct {
+	ChainID          string           `json:"chain_id"`
+	Format           string           `json:"format"`
+	StartHeight      int64            `json:"start_height"`
+	EndHeight        int64            `json:"end_height"`
+	NextHeight       int64            `json:"next_height"`
+	Offset           int64            `json:"offset"`
+	Rows             int64            `json:"rows"`
+	MissingBlocks    int64            `json:"missing_blocks"`
+	UnverifiedBlocks int64            `json:"unverified_blocks"`
+	Last             *types.BlockInfo `json:"last,omitempty"` // last written block, for the block time and linkage of the next one
+}
+
+// FormatFromPath guesses the format from the extension of path, defaulting to JSONL
+func FormatFromPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return FormatCSV
+	case ".parquet":
+		return FormatParquet
+	default:
+		return FormatJSONL
+	}
+}
+
+// CheckpointPath returns the checkpoint file of an export to path
+func CheckpointPath(path string) string {
+	return path + ".checkpoint"
+}
+
+// Export streams the blocks of a range from c into a file. Progress is
+// checkpointed next to the file every CheckpointEvery blocks and when ctx is
+// cancelled, so an interrupted export started again with the same options
+// continues where it left off instead of starting over. Parquet files are
+// written from a JSONL staging file once all blocks are exported, as a
+// parquet file cannot be appended to.
+func Export(ctx context.Context, c client.BlockchainClient, opts Options) (*Result, error) {
+	switch opts.Format {
+	case FormatJSONL, FormatCSV, FormatParquet:
+	default:
+		return nil, fmt.Errorf("unsupported export format: %s (must be jsonl, csv, or parquet)", opts.Format)
+	}
+	if opts.Path == "" {
+		return nil, fmt.Errorf("output file is required")
+	}
+	if opts.CheckpointEvery <= 0 {
+		opts.CheckpointEvery = defaultCheckpointEvery
+	}
+
+	dataPath := opts.Path
+	if opts.Format == FormatParquet {
+		dataPath = opts.Path + ".partial"
+	}
+	checkpointPath := CheckpointPath(opts.Path)
+
+	cp, err := loadCheckpoint(checkpointPath)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Path: opts.Path, Format: opts.Format}
+	if cp != nil {
+		if opts.EndHeight == 0 {
+			opts.EndHeight = cp.EndHeight
+		}
+		if cp.ChainID != opts.ChainID || cp.Format != opts.Format || cp.StartHeight != opts.StartHeight || cp.EndHeight != opts.EndHeight {
+			return nil, fmt.Errorf("%s belongs to an export of %s blocks %d-%d as %s; export the same range again to resume it, or delete the checkpoint to start over",
+				checkpointPath, cp.ChainID, cp.StartHeight, cp.EndHeight, cp.Format)
+		}
+		result.ResumedFrom = cp.NextHeight
+	} else {
+		if err := checkRange(ctx, c, &opts); err != nil {
+			return nil, err
+		}
+		cp = &checkpoint{
+			ChainID:     opts.ChainID,
+			Format:      opts.Format,
+			StartHeight: opts.StartHeight,
+			EndHeight:   opts.EndHeight,
+			NextHeight:  opts.StartHeight,
+		}
+	}
+	result.StartHeight = cp.StartHeight
+	result.EndHeight = cp.EndHeight
+
+	if cp.NextHeight <= cp.EndHeight {
+		if err := exportBlocks(ctx, c, opts, dataPath, checkpointPath, cp); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Format == FormatParquet {
+		if err := writeParquet(dataPath, opts.Path); err != nil {
+			return nil, err
+		}
+		os.Remove(dataPath)
+	}
+	os.Remove(checkpointPath)
+
+	result.Rows = cp.Rows
+	result.MissingBlocks = cp.MissingBlocks
+	result.UnverifiedBlocks = cp.UnverifiedBlocks
+	return result, nil
+}
+
+// checkRange resolves an open end height and checks that the node has the
+// whole range before anything is written
+func checkRange(ctx context.Context, c client.BlockchainClient, opts *Options) error {
+	status, err := c.GetStatus(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get node status: %w", err)
+	}
+
+	if opts.EndHeight == 0 {
+		opts.EndHeight = status.LatestHeight
+	}
+	if opts.StartHeight <= 0 || opts.StartHeight > opts.EndHeight {
+		return fmt.Errorf("invalid range: start height %d, end height %d", opts.StartHeight, opts.EndHeight)
+	}
+	if opts.StartHeight < status.EarliestHeight {
+		return fmt.Errorf("start height %d is pruned: the node only keeps blocks from height %d (use a later start height or an archive node)", opts.StartHeight, status.EarliestHeight)
+	}
+	if opts.EndHeight > status.LatestHeight {
+		return fmt.Errorf("end height %d is above the latest height %d", opts.EndHeight, status.LatestHeight)
+	}
+
+	return nil
+}
+
+// exportBlocks appends the blocks from cp.NextHeight on to the data file,
+// saving cp whenever the written data is synced to disk
+func exportBlocks(ctx context.Context, c client.BlockchainClient, opts Options, dataPath, checkpointPath string, cp *checkpoint) error {
+	file, err := os.OpenFile(dataPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", dataPath, err)
+	}
+	defer file.Close()
+
+	// A file shorter than the checkpoint was replaced or cut short since,
+	// and truncating would pad it with zero bytes
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", dataPath, err)
+	}
+	if info.Size() < cp.Offset {
+		return fmt.Errorf("%s has %d bytes but %s recorded %d; delete the checkpoint to start over",
+			dataPath, info.Size(), checkpointPath, cp.Offset)
+	}
+
+	// Drop whatever was written after the last checkpoint
+	if err := file.Truncate(cp.Offset); err != nil {
+		return fmt.Errorf("failed to truncate %s: %w", dataPath, err)
+	}
+	if _, err := file.Seek(cp.Offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek %s: %w", dataPath, err)
+	}
+
+	buf := bufio.NewWriter(file)
+	var csvWriter *csv.Writer
+	if opts.Format == FormatCSV {
+		csvWriter = csv.NewWriter(buf)
+		if cp.Offset == 0 {
+			csvWriter.Write(csvHeader)
+		}
+	}
+
+	// save syncs the rows written so far and records them in the checkpoint
+	save := func() error {
+		if csvWriter != nil {
+			csvWriter.Flush()
+			if err := csvWriter.Error(); err != nil {
+				return fmt.Errorf("failed to write %s: %w", dataPath, err)
+			}
+		}
+		if err := buf.Flush(); err != nil {
+			return fmt.Errorf("failed to write %s: %w", dataPath, err)
+		}
+		if err := file.Sync(); err != nil {
+			return fmt.Errorf("failed to sync %s: %w", dataPath, err)
+		}
+
+		offset, err := file.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return fmt.Errorf("failed to seek %s: %w", dataPath, err)
+		}
+		cp.Offset = offset
+
+		if err := saveCheckpoint(checkpointPath, cp); err != nil {
+			return err
+		}
+		if opts.Progress != nil {
+			opts.Progress(cp.NextHeight-1, cp.Rows)
+		}
+		return nil
+	}
+
+	// Missing heights are reported ahead of the blocks below them in the
+	// same chunk, so they only count once a checkpoint has passed them
+	streamOpts := client.StreamOptions{VerifyLinkage: opts.VerifyLinkage}
+	var pendingMissing []int64
+	if opts.AllowGaps {
+		streamOpts.OnMissing = func(missing types.MissingBlock) {
+			pendingMissing = append(pendingMissing, missing.Height)
+		}
+	}
+	countMissing := func() {
+		kept := pendingMissing[:0]
+		for _, height := range pendingMissing {
+			if height < cp.NextHeight {
+				cp.MissingBlocks++
+			} else {
+				kept = append(kept, height)
+			}
+		}
+		pendingMissing = kept
+	}
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	blockChan, errChan := client.StreamBlockRange(streamCtx, c, cp.NextHeight, cp.EndHeight, streamOpts)
+
+	// The stream starts without the block before it when resuming
+	previous := cp.Last
+
+	var sinceCheckpoint int
+	var writeErr error
+	for block := range blockChan {
+		if previous != nil {
+			if previous.Height == block.Height-1 {
+				if opts.VerifyLinkage {
+					if writeErr = client.CheckLink(previous, block); writeErr != nil {
+						break
+					}
+				}
+				block.BlockTime = block.Time.Sub(previous.Time).Seconds()
+			}
+			previous = nil
+		}
+
+		if csvWriter != nil {
+			writeErr = csvWriter.Write(csvRecord(block))
+		} else {
+			writeErr = writeJSONL(buf, block)
+		}
+		if writeErr != nil {
+			writeErr = fmt.Errorf("failed to write %s: %w", dataPath, writeErr)
+			break
+		}
+
+		cp.NextHeight = block.Height + 1
+		cp.Rows++
+		if !block.Verified {
+			cp.UnverifiedBlocks++
+		}
+		cp.Last = block
+
+		sinceCheckpoint++
+		if sinceCheckpoint >= opts.CheckpointEvery {
+			countMissing()
+			if writeErr = save(); writeErr != nil {
+				break
+			}
+			sinceCheckpoint = 0
+		}
+	}
+
+	if writeErr != nil {
+		cancel()
+		for range blockChan {
+		}
+		return writeErr
+	}
+
+	// Keep what was written before a failure or interruption
+	streamErr := <-errChan
+	if streamErr == nil {
+		cp.NextHeight = cp.EndHeight + 1
+	}
+	countMissing()
+	if err := save(); err != nil {
+		return err
+	}
+
+	if streamErr != nil {
+		if errors.Is(streamErr, context.Canceled) {
+			return fmt.Errorf("export interrupted at height %d, run it again to resume: %w", cp.NextHeight, streamErr)
+		}
+		return fmt.Errorf("failed to get blocks from height %d, run the export again to resume: %w", cp.NextHeight, streamErr)
+	}
+
+	return nil
+}
+
+// writeJSONL writes block as one line of JSON
+func writeJSONL(w io.Writer, block *types.BlockInfo) error {
+	data, err := json.Marshal(block)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// csvRecord converts block to a CSV row matching csvHeader
+func csvRecord(block *types.BlockInfo) []string {
+	return []string{
+		strconv.FormatInt(block.Height, 10),
+		block.Time.UTC().Format(time.RFC3339Nano),
+		block.Hash,
+		block.ParentHash,
+		block.Proposer,
+		strconv.Itoa(block.TxCount),
+		strconv.FormatFloat(block.BlockTime, 'f', -1, 64),
+		strconv.FormatBool(block.Verified),
+		commitField(block.Commit, func(c *types.CommitInfo) string { return strconv.Itoa(int(c.Round)) }),
+		commitField(block.Commit, func(c *types.CommitInfo) string { return strconv.Itoa(c.Signatures) }),
+		commitField(block.Commit, func(c *types.CommitInfo) string { return strconv.Itoa(c.Absent) }),
+		commitField(block.Commit, func(c *types.CommitInfo) string { return strconv.Itoa(c.Nil) }),
+		commitField(block.Commit, func(c *types.CommitInfo) string { return strconv.FormatFloat(c.SignedPower, 'f', -1, 64) }),
+		loadField(block.Load, func(l *types.LoadInfo) string { return strconv.FormatInt(l.GasUsed, 10) }),
+		loadField(block.Load, func(l *types.LoadInfo) string { return strconv.FormatInt(l.GasWanted, 10) }),
+		loadField(block.Load, func(l *types.LoadInfo) string { return strconv.Itoa(l.Events) }),
+		loadField(block.Load, func(l *types.LoadInfo) string { return strconv.Itoa(l.Size) }),
+	}
+}
+
+// commitField formats a field of commit, or is empty without a commit
+func commitField(commit *types.CommitInfo, format func(*types.CommitInfo) string) string {
+	if commit == nil {
+		return ""
+	}
+	return format(commit)
+}
+
+// loadField formats a field of load, or is empty without a load
+func loadField(load *types.LoadInfo, format func(*types.LoadInfo) string) string {
+	if load == nil {
+		return ""
+	}
+	return format(load)
+}
+
+// loadCheckpoint loads the checkpoint at path, or returns nil when there is none
+func loadCheckpoint(path string) (*checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	var cp checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint %s (delete it to start over): %w", path, err)
+	}
+	return &cp, nil
+}
+
+// saveCheckpoint replaces the checkpoint at path atomically, so a crash
+// leaves either the old or the new checkpoint
+func saveCheckpoint(path string, cp *checkpoint) error {
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoint: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
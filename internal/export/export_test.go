@@ -0,0 +1,464 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/qj0r9j0vc2/blocktime-calculator/internal/client"
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/simulate"
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+const testChainID = "test-1"
+
+// newTestNode serves a chain up to latest with irregular block times. Its
+// blocks have a last commit unless the height is a multiple of 3 and a load
+// unless it is a multiple of 4
+func newTestNode(t *testing.T, latest int64) *simulate.Node {
+	t.Helper()
+
+	chain, err := simulate.New(simulate.Spec{
+		ChainID:      testChainID,
+		Seed:         3,
+		LatestHeight: latest,
+		BlockTime:    simulate.Distribution{Distribution: simulate.DistributionNormal, Mean: 5 * time.Second, StdDev: 1500 * time.Millisecond},
+		Rounds:       simulate.Rounds{Probability: 0.2, Timeout: 2 * time.Second},
+		TxsPerBlock:  5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &simulate.Node{Chain: chain, Edit: func(block *types.BlockInfo) {
+		height := block.Height
+		if height%3 == 0 {
+			block.Commit = nil
+		} else {
+			absent := int(height % 2)
+			block.Commit.Signatures -= absent
+			block.Commit.Absent = absent
+			block.Commit.Nil = int(height % 7 / 6)
+			block.Commit.SignedPower = 1 - 0.25*float64(absent)
+		}
+		if height%4 != 0 {
+			block.Load = &types.LoadInfo{
+				GasUsed:   height % 11 * 70000,
+				GasWanted: height % 11 * 90000,
+				Events:    int(height%11*4 + 2),
+				Size:      int(height%11*250 + 600),
+			}
+		}
+	}}
+}
+
+// sameCommit reports whether two last commits are equal or both missing
+func sameCommit(a, b *types.CommitInfo) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// sameLoad reports whether two block loads are equal or both missing
+func sameLoad(a, b *types.LoadInfo) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func TestExportResume(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+	}{
+		{"jsonl", FormatJSONL},
+		{"csv", FormatCSV},
+		{"parquet", FormatParquet},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			ctx := context.Background()
+			opts := Options{
+				ChainID:         testChainID,
+				Format:          tt.format,
+				StartHeight:     5,
+				EndHeight:       1000,
+				CheckpointEvery: 50,
+			}
+
+			// Reference export in one go
+			fresh := opts
+			fresh.Path = filepath.Join(dir, "fresh."+tt.format)
+			if _, err := Export(ctx, newTestNode(t, 1200), fresh); err != nil {
+				t.Fatalf("fresh export: %v", err)
+			}
+
+			// The node fails after a few chunks were written
+			resumed := opts
+			resumed.Path = filepath.Join(dir, "resumed."+tt.format)
+			failing := newTestNode(t, 1200)
+			failing.Missing = make(map[int64]bool)
+			for height := int64(600); height <= 1200; height++ {
+				failing.Missing[height] = true
+			}
+			if _, err := Export(ctx, failing, resumed); err == nil {
+				t.Fatal("expected the export to fail")
+			}
+
+			cp, err := loadCheckpoint(CheckpointPath(resumed.Path))
+			if err != nil || cp == nil {
+				t.Fatalf("expected a checkpoint, got %v, %v", cp, err)
+			}
+			if cp.NextHeight <= opts.StartHeight || cp.NextHeight > 600 {
+				t.Fatalf("checkpoint at height %d, want within 6-600", cp.NextHeight)
+			}
+
+			// A torn row written after the checkpoint must be dropped on resume
+			dataPath := resumed.Path
+			if tt.format == FormatParquet {
+				dataPath += ".partial"
+			}
+			file, err := os.OpenFile(dataPath, os.O_APPEND|os.O_WRONLY, 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			file.WriteString(`{"height":99999,"ti`)
+			file.Close()
+
+			result, err := Export(ctx, newTestNode(t, 1200), resumed)
+			if err != nil {
+				t.Fatalf("resumed export: %v", err)
+			}
+			if result.ResumedFrom != cp.NextHeight {
+				t.Errorf("resumed from %d, want %d", result.ResumedFrom, cp.NextHeight)
+			}
+			if result.Rows != 996 {
+				t.Errorf("got %d rows, want 996", result.Rows)
+			}
+
+			if tt.format == FormatParquet {
+				want, err := parquet.ReadFile[parquetRow](fresh.Path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := parquet.ReadFile[parquetRow](resumed.Path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(got) != len(want) {
+					t.Fatalf("got %d parquet rows, want %d", len(got), len(want))
+				}
+				for i := range want {
+					if !got[i].Time.Equal(want[i].Time) || got[i].Height != want[i].Height || got[i].BlockTime != want[i].BlockTime {
+						t.Fatalf("row %d: got %+v, want %+v", i, got[i], want[i])
+					}
+				}
+				if _, err := os.Stat(dataPath); !os.IsNotExist(err) {
+					t.Errorf("staging file %s was not removed", dataPath)
+				}
+			} else {
+				want, _ := os.ReadFile(fresh.Path)
+				got, _ := os.ReadFile(resumed.Path)
+				if !bytes.Equal(got, want) {
+					t.Errorf("resumed export differs from a fresh export")
+				}
+			}
+
+			if _, err := os.Stat(CheckpointPath(resumed.Path)); !os.IsNotExist(err) {
+				t.Errorf("checkpoint was not removed after the export finished")
+			}
+		})
+	}
+}
+
+func TestExportStaleCheckpoint(t *testing.T) {
+	base := checkpoint{
+		ChainID:     testChainID,
+		Format:      FormatJSONL,
+		StartHeight: 10,
+		EndHeight:   100,
+		NextHeight:  10,
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(cp *checkpoint)
+		opts    func(opts *Options)
+		raw     string // checkpoint file content instead of cp
+		data    string // output file content, when it exists
+		wantErr string
+	}{
+		{
+			name:    "other chain",
+			modify:  func(cp *checkpoint) { cp.ChainID = "other-1" },
+			wantErr: "belongs to an export of other-1",
+		},
+		{
+			name:    "other format",
+			modify:  func(cp *checkpoint) { cp.Format = FormatCSV },
+			wantErr: "as csv",
+		},
+		{
+			name:    "other start height",
+			modify:  func(cp *checkpoint) { cp.StartHeight = 20 },
+			wantErr: "blocks 20-100",
+		},
+		{
+			name:    "other end height",
+			opts:    func(opts *Options) { opts.EndHeight = 200 },
+			wantErr: "blocks 10-100",
+		},
+		{
+			name:    "corrupt",
+			raw:     "{not json",
+			wantErr: "invalid checkpoint",
+		},
+		{
+			name:    "output deleted",
+			modify:  func(cp *checkpoint) { cp.NextHeight, cp.Offset, cp.Rows = 20, 2048, 10 },
+			wantErr: "has 0 bytes but",
+		},
+		{
+			name:    "output replaced",
+			modify:  func(cp *checkpoint) { cp.NextHeight, cp.Offset, cp.Rows = 20, 2048, 10 },
+			data:    "{}\n",
+			wantErr: "has 3 bytes but",
+		},
+		{
+			name: "open end resumes the recorded range",
+			opts: func(opts *Options) { opts.EndHeight = 0 },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "blocks.jsonl")
+
+			cp := base
+			if tt.modify != nil {
+				tt.modify(&cp)
+			}
+			if tt.raw != "" {
+				if err := os.WriteFile(CheckpointPath(path), []byte(tt.raw), 0644); err != nil {
+					t.Fatal(err)
+				}
+			} else if err := saveCheckpoint(CheckpointPath(path), &cp); err != nil {
+				t.Fatal(err)
+			}
+			if tt.data != "" {
+				if err := os.WriteFile(path, []byte(tt.data), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			opts := Options{
+				ChainID:     testChainID,
+				Format:      FormatJSONL,
+				Path:        path,
+				StartHeight: 10,
+				EndHeight:   100,
+			}
+			if tt.opts != nil {
+				tt.opts(&opts)
+			}
+
+			result, err := Export(context.Background(), newTestNode(t, 500), opts)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if result.EndHeight != 100 || result.Rows != 91 {
+					t.Errorf("got blocks up to %d (%d rows), want 100 (91 rows)", result.EndHeight, result.Rows)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want it to contain %q", err, tt.wantErr)
+			}
+
+			// The checkpoint is kept so the original export can still be resumed
+			if _, statErr := os.Stat(CheckpointPath(path)); statErr != nil {
+				t.Errorf("checkpoint was removed: %v", statErr)
+			}
+			// and the output is not padded up to the recorded offset
+			if info, statErr := os.Stat(path); statErr == nil && info.Size() != int64(len(tt.data)) {
+				t.Errorf("got a %d byte output, want %d bytes", info.Size(), len(tt.data))
+			}
+		})
+	}
+}
+
+func TestWriteParquet(t *testing.T) {
+	tests := []struct {
+		name string
+		rows int64
+	}{
+		{"empty", 0},
+		{"single batch", 10},
+		{"several batches", parquetBatchSize*2 + 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			src := filepath.Join(dir, "blocks.jsonl")
+			dst := filepath.Join(dir, "blocks.parquet")
+
+			node := newTestNode(t, tt.rows+1)
+			var buf bytes.Buffer
+			var want []*types.BlockInfo
+			for height := int64(1); height <= tt.rows; height++ {
+				block, err := node.GetBlockByHeight(context.Background(), height)
+				if err != nil {
+					t.Fatal(err)
+				}
+				block.BlockTime = float64(height%5) + 0.25
+				block.Verified = height%2 == 0
+				want = append(want, block)
+
+				data, err := json.Marshal(block)
+				if err != nil {
+					t.Fatal(err)
+				}
+				buf.Write(append(data, '\n'))
+			}
+			if err := os.WriteFile(src, buf.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := writeParquet(src, dst); err != nil {
+				t.Fatalf("writeParquet: %v", err)
+			}
+
+			got, err := parquet.ReadFile[parquetRow](dst)
+			if err != nil {
+				t.Fatalf("failed to read %s: %v", dst, err)
+			}
+			if len(got) != len(want) {
+				t.Fatalf("got %d rows, want %d", len(got), len(want))
+			}
+			for i, block := range want {
+				row := got[i]
+				if row.Height != block.Height || !row.Time.Equal(block.Time) || row.Hash != block.Hash ||
+					row.ParentHash != block.ParentHash || row.Proposer != block.Proposer ||
+					row.TxCount != int64(block.TxCount) || row.BlockTime != block.BlockTime || row.Verified != block.Verified {
+					t.Fatalf("row %d: got %+v, want %+v", i, row, block)
+				}
+
+				var commit *types.CommitInfo
+				if row.CommitRound != nil {
+					commit = &types.CommitInfo{
+						Round:       *row.CommitRound,
+						Signatures:  int(*row.CommitSignatures),
+						Absent:      int(*row.CommitAbsent),
+						Nil:         int(*row.CommitNil),
+						SignedPower: *row.CommitSignedPower,
+					}
+				}
+				if !sameCommit(commit, block.Commit) {
+					t.Fatalf("row %d: got commit %+v, want %+v", i, commit, block.Commit)
+				}
+
+				var load *types.LoadInfo
+				if row.GasUsed != nil {
+					load = &types.LoadInfo{
+						GasUsed:   *row.GasUsed,
+						GasWanted: *row.GasWanted,
+						Events:    int(*row.Events),
+						Size:      int(*row.Size),
+					}
+				}
+				if !sameLoad(load, block.Load) {
+					t.Fatalf("row %d: got load %+v, want %+v", i, load, block.Load)
+				}
+			}
+
+			if _, err := os.Stat(dst + ".tmp"); !os.IsNotExist(err) {
+				t.Errorf("temporary file was left behind")
+			}
+		})
+	}
+}
+
+func TestWriteParquetInvalidRow(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "blocks.jsonl")
+	dst := filepath.Join(dir, "blocks.parquet")
+	if err := os.WriteFile(src, []byte("{\"height\":1}\n{broken\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeParquet(src, dst); err == nil {
+		t.Fatal("expected an error for an invalid row")
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Errorf("incomplete parquet file was written")
+	}
+}
+
+func TestExportReplay(t *testing.T) {
+	for _, format := range []string{FormatJSONL, FormatCSV} {
+		t.Run(format, func(t *testing.T) {
+			ctx := context.Background()
+			node := newTestNode(t, 400)
+			path := filepath.Join(t.TempDir(), "blocks."+format)
+			if _, err := Export(ctx, node, Options{
+				ChainID:     testChainID,
+				Format:      format,
+				Path:        path,
+				StartHeight: 5,
+				EndHeight:   300,
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			// The exported file stands in for the node
+			replay, err := client.NewFileClient(path, testChainID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			status, err := replay.GetStatus(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status.ChainID != testChainID || status.EarliestHeight != 5 || status.LatestHeight != 300 {
+				t.Errorf("got status %+v", status)
+			}
+
+			blocks, err := replay.GetBlockRange(ctx, 5, 300)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(blocks) != 296 {
+				t.Fatalf("got %d blocks, want 296", len(blocks))
+			}
+			exported, err := node.GetBlockRange(ctx, 5, 300)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, block := range blocks {
+				want := exported[i]
+				if block.Height != want.Height || !block.Time.Equal(want.Time) || block.Hash != want.Hash || block.ParentHash != want.ParentHash ||
+					block.Proposer != want.Proposer || block.TxCount != want.TxCount || block.BlockTime != want.BlockTime {
+					t.Fatalf("replayed %+v, want %+v", block, want)
+				}
+				if !sameCommit(block.Commit, want.Commit) {
+					t.Fatalf("replayed commit %+v of block %d, want %+v", block.Commit, block.Height, want.Commit)
+				}
+				if !sameLoad(block.Load, want.Load) {
+					t.Fatalf("replayed load %+v of block %d, want %+v", block.Load, block.Height, want.Load)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+// parquetBatchSize is the number of rows handed to the parquet writer at once
+const parquetBatchSize = 1000
+
+// parquetRow is the parquet schema of an exported block, with the columns of
+// the CSV export. The commit and load columns are null without a last commit or load
+type parquetRow struct {
+	Height     int64     `parquet:"height"`
+	Time       time.Time `parquet:"time,timestamp(nanosecond)"`
+	Hash       string    `parquet:"hash"`
+	ParentHash string    `parquet:"parent_hash"`
+	Proposer   string    `parquet:"proposer"`
+	TxCount    int64     `parquet:"tx_count"`
+	BlockTime  float64   `parquet:"block_time"`
+	Verified   bool      `parquet:"verified"`
+
+	CommitRound       *int32   `parquet:"commit_round,optional"`
+	CommitSignatures  *int64   `parquet:"commit_signatures,optional"`
+	CommitAbsent      *int64   `parquet:"commit_absent,optional"`
+	CommitNil         *int64   `parquet:"commit_nil,optional"`
+	CommitSignedPower *float64 `parquet:"commit_signed_power,optional"`
+
+	GasUsed   *int64 `parquet:"gas_used,optional"`
+	GasWanted *int64 `parquet:"gas_wanted,optional"`
+	Events    *int64 `parquet:"events,optional"`
+	Size      *int64 `parquet:"size,optional"`
+}
+
+// writeParquet converts the JSONL file at src into a parquet file at dst.
+// Rows are streamed, and dst only appears once it is complete
+func writeParquet(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer in.Close()
+
+	tmp := dst + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", tmp, err)
+	}
+	defer os.Remove(tmp)
+	defer out.Close()
+
+	writer := parquet.NewGenericWriter[parquetRow](out)
+	rows := make([]parquetRow, 0, parquetBatchSize)
+	flush := func() error {
+		if _, err := writer.Write(rows); err != nil {
+			return fmt.Errorf("failed to write %s: %w", tmp, err)
+		}
+		rows = rows[:0]
+		return nil
+	}
+
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		var block types.BlockInfo
+		if err := json.Unmarshal(scanner.Bytes(), &block); err != nil {
+			return fmt.Errorf("invalid row in %s: %w", src, err)
+		}
+
+		row := parquetRow{
+			Height:     block.Height,
+			Time:       block.Time,
+			Hash:       block.Hash,
+			ParentHash: block.ParentHash,
+			Proposer:   block.Proposer,
+			TxCount:    int64(block.TxCount),
+			BlockTime:  block.BlockTime,
+			Verified:   block.Verified,
+		}
+		if commit := block.Commit; commit != nil {
+			signatures, absent, nilVotes := int64(commit.Signatures), int64(commit.Absent), int64(commit.Nil)
+			row.CommitRound = &commit.Round
+			row.CommitSignatures = &signatures
+			row.CommitAbsent = &absent
+			row.CommitNil = &nilVotes
+			row.CommitSignedPower = &commit.SignedPower
+		}
+		if load := block.Load; load != nil {
+			events, size := int64(load.Events), int64(load.Size)
+			row.GasUsed = &load.GasUsed
+			row.GasWanted = &load.GasWanted
+			row.Events = &events
+			row.Size = &size
+		}
+		rows = append(rows, row)
+		if len(rows) == parquetBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", src, err)
+	}
+
+	if err := flush(); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	if err := out.Sync(); err != nil {
+		return fmt.Errorf("failed to sync %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		return fmt.Errorf("failed to write %s: %w", dst, err)
+	}
+
+	return nil
+}
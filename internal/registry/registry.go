@@ -0,0 +1,160 @@
+// Package registry resolves chain names to connection settings from a
+// snapshot of the cosmos chain-registry, so no network access is needed
+// before the selected endpoints are contacted.
+package registry
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+// bundled is the chain-registry snapshot shipped with the binary
+//
+//go:embed chains
+var bundled embed.FS
+
+// Chain is the part of a chain-registry chain.json this tool uses
+type Chain struct {
+	ChainName    string `json:"chain_name"`
+	ChainID      string `json:"chain_id"`
+	Bech32Prefix string `json:"bech32_prefix"`
+	APIs         struct {
+		RPC  []Endpoint `json:"rpc"`
+		GRPC []Endpoint `json:"grpc"`
+		REST []Endpoint `json:"rest"`
+	} `json:"apis"`
+}
+
+// Endpoint is a public API endpoint listed in chain.json
+type Endpoint struct {
+	Address  string `json:"address"`
+	Provider string `json:"provider"`
+}
+
+// Registry is a chain-registry style directory with a <name>/chain.json per
+// chain and testnets under testnets/<name>/chain.json
+type Registry struct {
+	fsys fs.FS
+	name string
+}
+
+// Open opens the registry in dir, or the bundled snapshot when dir is empty
+func Open(dir string) (*Registry, error) {
+	if dir == "" {
+		fsys, err := fs.Sub(bundled, "chains")
+		if err != nil {
+			return nil, err
+		}
+		return &Registry{fsys: fsys, name: "bundled registry"}, nil
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open chain registry: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("chain registry %s is not a directory", dir)
+	}
+
+	return &Registry{fsys: os.DirFS(dir), name: dir}, nil
+}
+
+// Lookup loads the chain with the given chain-registry name
+func (r *Registry) Lookup(name string) (*Chain, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return nil, fmt.Errorf("invalid chain name: %q", name)
+	}
+
+	for _, dir := range []string{name, path.Join("testnets", name)} {
+		data, err := fs.ReadFile(r.fsys, path.Join(dir, "chain.json"))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read chain %s: %w", name, err)
+		}
+
+		var chain Chain
+		if err := json.Unmarshal(data, &chain); err != nil {
+			return nil, fmt.Errorf("failed to parse %s/chain.json: %w", dir, err)
+		}
+		if chain.ChainID == "" {
+			return nil, fmt.Errorf("%s/chain.json has no chain_id", dir)
+		}
+		return &chain, nil
+	}
+
+	names, _ := r.Names()
+	return nil, fmt.Errorf("chain %s not found in %s (available: %s)", name, r.name, strings.Join(names, ", "))
+}
+
+// Names lists the mainnet chain names in the registry
+func (r *Registry) Names() ([]string, error) {
+	entries, err := fs.ReadDir(r.fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := fs.Stat(r.fsys, path.Join(entry.Name(), "chain.json")); err == nil {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Apply fills config with the chain ID, bech32 prefix and endpoints of the
+// chain. All listed endpoints of each API are used for failover.
+func (c *Chain) Apply(config *types.ChainConfig) error {
+	rpc := addresses(c.APIs.RPC)
+	grpc := addresses(c.APIs.GRPC)
+	rest := addresses(c.APIs.REST)
+	if len(rpc) == 0 && len(grpc) == 0 && len(rest) == 0 {
+		return fmt.Errorf("chain %s lists no API endpoints", c.ChainName)
+	}
+
+	config.ChainID = c.ChainID
+	config.Bech32Prefix = c.Bech32Prefix
+	if len(rpc) > 0 {
+		config.RPCEndpoints = rpc
+		config.RPCEndpoint = ""
+	}
+	if len(grpc) > 0 {
+		config.GRPCEndpoints = grpc
+		config.GRPCEndpoint = ""
+	}
+	if len(rest) > 0 {
+		config.RESTEndpoints = rest
+		config.RESTEndpoint = ""
+	}
+	return nil
+}
+
+// addresses returns the non-empty addresses of endpoints without duplicates
+func addresses(endpoints []Endpoint) []string {
+	var result []string
+	seen := make(map[string]bool)
+	for _, endpoint := range endpoints {
+		address := strings.TrimSpace(endpoint.Address)
+		if address == "" || seen[address] {
+			continue
+		}
+		seen[address] = true
+		result = append(result, address)
+	}
+	return result
+}
@@ -0,0 +1,301 @@
+package simulate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+// minBlockTime is the shortest time between two commits, block times drawn
+// below it are raised to it
+const minBlockTime = time.Millisecond
+
+// Chain is a synthetic chain generated from a Spec. It implements the
+// BlockchainClient interface of the calculator, so every analysis can run
+// against it without a node. Blocks up to the latest height exist from the
+// start; a subscription produces further blocks, paced by their block times.
+type Chain struct {
+	spec      Spec
+	addresses []string // consensus address of every validator
+
+	mu     sync.Mutex
+	rng    *rand.Rand
+	halts  map[int64]time.Duration
+	commit time.Time // commit time of the last generated block, before clock skew
+
+	// Generated blocks, index 0 holding StartHeight
+	times     []time.Time
+	rounds    []int32
+	proposers []int32
+	txs       []int32
+	latest    int64
+
+	// Proposer priorities, rotated like CometBFT does
+	priorities []int64
+	totalPower int64
+}
+
+// New generates the chain of spec up to its latest height
+func New(spec Spec) (*Chain, error) {
+	if err := spec.validate(); err != nil {
+		return nil, err
+	}
+
+	c := &Chain{
+		spec:       spec,
+		rng:        rand.New(rand.NewPCG(spec.Seed, spec.Seed^0x5eed)),
+		halts:      make(map[int64]time.Duration, len(spec.Halts)),
+		priorities: make([]int64, len(spec.Validators)),
+	}
+	for _, halt := range spec.Halts {
+		c.halts[halt.Height] += halt.Duration
+	}
+	for _, validator := range spec.Validators {
+		address := strings.ToUpper(validator.Address)
+		if address == "" {
+			sum := sha256.Sum256([]byte(validator.Name))
+			address = strings.ToUpper(hex.EncodeToString(sum[:20]))
+		}
+		c.addresses = append(c.addresses, address)
+		c.totalPower += validator.Power
+	}
+
+	count := spec.LatestHeight - spec.StartHeight + 1
+	c.times = make([]time.Time, 0, count)
+	c.rounds = make([]int32, 0, count)
+	c.proposers = make([]int32, 0, count)
+	c.txs = make([]int32, 0, count)
+	c.generate(spec.LatestHeight)
+
+	return c, nil
+}
+
+// Open loads the spec at path and generates its chain. A spec without a
+// chain ID takes chainID
+func Open(path, chainID string) (*Chain, error) {
+	spec, err := LoadSpec(path)
+	if err != nil {
+		return nil, err
+	}
+	if spec.ChainID == "" {
+		spec.ChainID = chainID
+	}
+	return New(*spec)
+}
+
+// GetLatestBlockHeight gets the latest generated height
+func (c *Chain) GetLatestBlockHeight(ctx context.Context) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.latest, nil
+}
+
+// GetStatus gets the chain ID and the height window of the chain
+func (c *Chain) GetStatus(ctx context.Context) (*types.NodeStatus, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return &types.NodeStatus{
+		ChainID:        c.spec.ChainID,
+		LatestHeight:   c.latest,
+		EarliestHeight: c.spec.StartHeight,
+	}, nil
+}
+
+// GetBlockByHeight gets block information by height
+func (c *Chain) GetBlockByHeight(ctx context.Context, height int64) (*types.BlockInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if height < c.spec.StartHeight || height > c.latest {
+		return nil, fmt.Errorf("block %d is not available, the chain has blocks %d-%d", height, c.spec.StartHeight, c.latest)
+	}
+	return c.block(height), nil
+}
+
+// GetBlockRange gets a range of blocks
+func (c *Chain) GetBlockRange(ctx context.Context, startHeight, endHeight int64) ([]*types.BlockInfo, error) {
+	if startHeight > endHeight {
+		return nil, fmt.Errorf("invalid range: start height %d > end height %d", startHeight, endHeight)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if startHeight < c.spec.StartHeight || endHeight > c.latest {
+		return nil, fmt.Errorf("blocks %d-%d are not available, the chain has blocks %d-%d", startHeight, endHeight, c.spec.StartHeight, c.latest)
+	}
+
+	blocks := make([]*types.BlockInfo, 0, endHeight-startHeight+1)
+	for height := startHeight; height <= endHeight; height++ {
+		block := c.block(height)
+		if height > startHeight {
+			block.BlockTime = block.Time.Sub(blocks[len(blocks)-1].Time).Seconds()
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+// SubscribeNewBlocks produces the blocks after the latest height, each after
+// its block time divided by the speed of the spec has passed. Every
+// subscription extends the same chain
+func (c *Chain) SubscribeNewBlocks(ctx context.Context) (<-chan *types.BlockInfo, <-chan error) {
+	blocks := make(chan *types.BlockInfo, 1)
+	errs := make(chan error)
+
+	go func() {
+		defer close(errs)
+		defer close(blocks)
+
+		c.mu.Lock()
+		height := c.latest + 1
+		c.mu.Unlock()
+
+		for {
+			c.mu.Lock()
+			c.generate(height)
+			wait := c.times[height-c.spec.StartHeight].Sub(c.times[height-1-c.spec.StartHeight])
+			c.mu.Unlock()
+
+			timer := time.NewTimer(time.Duration(float64(wait) / c.spec.Speed))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			c.mu.Lock()
+			if height > c.latest {
+				c.latest = height
+			}
+			block := c.block(height)
+			block.BlockTime = wait.Seconds()
+			c.mu.Unlock()
+
+			select {
+			case blocks <- block:
+			case <-ctx.Done():
+				return
+			}
+			height++
+		}
+	}()
+
+	return blocks, errs
+}
+
+// GetValidatorSet gets the validators of the spec, which never change
+func (c *Chain) GetValidatorSet(ctx context.Context, height int64) ([]types.ValidatorInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if height < c.spec.StartHeight || height > c.latest {
+		return nil, fmt.Errorf("block %d is not available, the chain has blocks %d-%d", height, c.spec.StartHeight, c.latest)
+	}
+	set := make([]types.ValidatorInfo, len(c.spec.Validators))
+	for i, validator := range c.spec.Validators {
+		set[i] = types.ValidatorInfo{Address: c.addresses[i], VotingPower: validator.Power}
+	}
+	return set, nil
+}
+
+// GetStakingValidators describes the validators of the spec by their names.
+// Simulated validators have no operator address
+func (c *Chain) GetStakingValidators(ctx context.Context) ([]types.ValidatorInfo, error) {
+	described := make([]types.ValidatorInfo, len(c.spec.Validators))
+	for i, validator := range c.spec.Validators {
+		described[i] = types.ValidatorInfo{Address: c.addresses[i], Moniker: validator.Name}
+	}
+	return described, nil
+}
+
+// Close stops nothing, subscriptions end with their context
+func (c *Chain) Close() error {
+	return nil
+}
+
+// block builds the generated block at height, c.mu must be held. Every
+// validator signs the commit it carries, in the rounds that delayed it
+func (c *Chain) block(height int64) *types.BlockInfo {
+	i := height - c.spec.StartHeight
+	return &types.BlockInfo{
+		Height:     height,
+		Time:       c.times[i],
+		Hash:       c.hash(height),
+		ParentHash: c.hash(height - 1),
+		Proposer:   c.addresses[c.proposers[i]],
+		TxCount:    int(c.txs[i]),
+		Commit: &types.CommitInfo{
+			Round:       c.rounds[i],
+			Signatures:  len(c.spec.Validators),
+			SignedPower: 1,
+		},
+	}
+}
+
+// hash derives the block hash of height from the chain ID and seed
+func (c *Chain) hash(height int64) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s/%d/%d", c.spec.ChainID, c.spec.Seed, height)))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// generate extends the chain to height, drawing every block in height
+// order so the chain only depends on the spec. c.mu must be held
+func (c *Chain) generate(height int64) {
+	for next := c.spec.StartHeight + int64(len(c.times)); next <= height; next++ {
+		proposer := c.nextProposer()
+
+		var rounds int32
+		for int(rounds) < c.spec.Rounds.Max && c.rng.Float64() < c.spec.Rounds.Probability {
+			rounds++
+		}
+
+		var txs int32
+		if c.spec.TxsPerBlock > 0 {
+			txs = int32(c.rng.IntN(2*c.spec.TxsPerBlock + 1))
+		}
+
+		if next == c.spec.StartHeight {
+			c.commit = c.spec.GenesisTime
+		} else {
+			blockTime := c.spec.BlockTime.sample(c.rng)
+			if blockTime < minBlockTime {
+				blockTime = minBlockTime
+			}
+			blockTime += time.Duration(rounds)*c.spec.Rounds.Timeout + c.halts[next]
+			c.commit = c.commit.Add(blockTime)
+		}
+
+		c.times = append(c.times, c.commit.Add(c.spec.Validators[proposer].ClockSkew).UTC())
+		c.rounds = append(c.rounds, rounds)
+		c.proposers = append(c.proposers, int32(proposer))
+		c.txs = append(c.txs, txs)
+	}
+
+	if height > c.latest && height <= c.spec.LatestHeight {
+		c.latest = height
+	}
+}
+
+// nextProposer picks the proposer of the next block with the weighted round
+// robin of CometBFT: every validator gains its voting power in priority, and
+// the one with the highest priority proposes and pays the total power
+func (c *Chain) nextProposer() int {
+	proposer := 0
+	for i, validator := range c.spec.Validators {
+		c.priorities[i] += validator.Power
+		if c.priorities[i] > c.priorities[proposer] {
+			proposer = i
+		}
+	}
+	c.priorities[proposer] -= c.totalPower
+	return proposer
+}
@@ -0,0 +1,129 @@
+package simulate
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+// Node serves a chain the way a single node would, with the faults set on
+// it, and records the ranges of blocks it was asked for. Unlike Chain it has
+// no subscriptions or validator sets, so callers looking for those fall back
+// as they would with a plain node. Faults may change between requests, not
+// while requests are in flight
+type Node struct {
+	Chain *Chain
+
+	Err        error                        // returned by every call when set
+	Missing    map[int64]bool               // heights failing on their own, like a corrupt block
+	Earliest   int64                        // heights below are pruned, none when 0
+	Latest     int64                        // height the node has caught up to, the chain's latest when 0
+	NoEarliest bool                         // leave the earliest height out of the status, as gRPC and REST endpoints do
+	Edit       func(block *types.BlockInfo) // changes every block served, block times follow edited times
+
+	mu     sync.Mutex
+	ranges [][2]int64
+}
+
+// GetLatestBlockHeight gets the height the node has caught up to
+func (n *Node) GetLatestBlockHeight(ctx context.Context) (int64, error) {
+	if n.Err != nil {
+		return 0, n.Err
+	}
+	return n.latest(), nil
+}
+
+// GetStatus gets the chain ID and the height window of the node
+func (n *Node) GetStatus(ctx context.Context) (*types.NodeStatus, error) {
+	if n.Err != nil {
+		return nil, n.Err
+	}
+	status, err := n.Chain.GetStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status.LatestHeight = n.latest()
+	status.EarliestHeight = n.earliest()
+	if n.NoEarliest {
+		status.EarliestHeight = 0
+	}
+	return status, nil
+}
+
+// GetBlockByHeight gets block information by height
+func (n *Node) GetBlockByHeight(ctx context.Context, height int64) (*types.BlockInfo, error) {
+	blocks, err := n.GetBlockRange(ctx, height, height)
+	if err != nil {
+		return nil, err
+	}
+	return blocks[0], nil
+}
+
+// GetBlockRange gets a range of blocks
+func (n *Node) GetBlockRange(ctx context.Context, startHeight, endHeight int64) ([]*types.BlockInfo, error) {
+	n.mu.Lock()
+	n.ranges = append(n.ranges, [2]int64{startHeight, endHeight})
+	n.mu.Unlock()
+
+	if n.Err != nil {
+		return nil, n.Err
+	}
+	if earliest, latest := n.earliest(), n.latest(); startHeight < earliest || endHeight > latest {
+		return nil, fmt.Errorf("blocks %d-%d are not available, the node has blocks %d-%d", startHeight, endHeight, earliest, latest)
+	}
+	for height := startHeight; height <= endHeight; height++ {
+		if n.Missing[height] {
+			return nil, fmt.Errorf("block %d is missing", height)
+		}
+	}
+
+	blocks, err := n.Chain.GetBlockRange(ctx, startHeight, endHeight)
+	if err != nil || n.Edit == nil {
+		return blocks, err
+	}
+	for i, block := range blocks {
+		n.Edit(block)
+		if i > 0 {
+			block.BlockTime = block.Time.Sub(blocks[i-1].Time).Seconds()
+		}
+	}
+	return blocks, nil
+}
+
+// Close stops nothing
+func (n *Node) Close() error {
+	return nil
+}
+
+// Ranges returns the ranges of blocks asked for so far, in order. Single
+// blocks are ranges of one height
+func (n *Node) Ranges() [][2]int64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([][2]int64(nil), n.ranges...)
+}
+
+// TakeRanges returns the ranges asked for since the last TakeRanges
+func (n *Node) TakeRanges() [][2]int64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	ranges := n.ranges
+	n.ranges = nil
+	return ranges
+}
+
+// earliest gets the earliest height the node keeps
+func (n *Node) earliest() int64 {
+	return max(n.Chain.spec.StartHeight, n.Earliest)
+}
+
+// latest gets the height the node has caught up to
+func (n *Node) latest() int64 {
+	latest, _ := n.Chain.GetLatestBlockHeight(context.Background())
+	if n.Latest > 0 {
+		latest = min(latest, n.Latest)
+	}
+	return latest
+}
@@ -0,0 +1,429 @@
+package simulate
+
+import (
+	"context"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qj0r9j0vc2/blocktime-calculator/pkg/types"
+)
+
+func constantSpec(latest int64) Spec {
+	return Spec{
+		ChainID:      "sim-1",
+		Seed:         7,
+		LatestHeight: latest,
+		BlockTime:    Distribution{Distribution: DistributionConstant, Mean: 6 * time.Second},
+	}
+}
+
+func newTestChain(t *testing.T, spec Spec) *Chain {
+	c, err := New(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// blockTimes returns the block times of heights start+1..end in seconds
+func blockTimes(t *testing.T, c *Chain, start, end int64) []float64 {
+	blocks, err := c.GetBlockRange(context.Background(), start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	times := make([]float64, 0, len(blocks)-1)
+	for _, block := range blocks[1:] {
+		times = append(times, block.BlockTime)
+	}
+	return times
+}
+
+func TestChainDeterministic(t *testing.T) {
+	spec := constantSpec(2000)
+	spec.BlockTime = Distribution{Distribution: DistributionNormal, Mean: 6 * time.Second, StdDev: 500 * time.Millisecond}
+	spec.TxsPerBlock = 10
+
+	a := newTestChain(t, spec)
+	b := newTestChain(t, spec)
+	blocksA, _ := a.GetBlockRange(context.Background(), 1, 2000)
+	blocksB, _ := b.GetBlockRange(context.Background(), 1, 2000)
+	for i := range blocksA {
+		if !reflect.DeepEqual(blocksA[i], blocksB[i]) {
+			t.Fatalf("block %d differs between chains of the same spec: %+v, %+v", blocksA[i].Height, blocksA[i], blocksB[i])
+		}
+	}
+
+	spec.Seed++
+	other, _ := newTestChain(t, spec).GetBlockByHeight(context.Background(), 2000)
+	if other.Time.Equal(blocksA[1999].Time) || other.Hash == blocksA[1999].Hash {
+		t.Error("another seed generated the same chain")
+	}
+}
+
+func TestChainBlocks(t *testing.T) {
+	spec := constantSpec(100)
+	spec.StartHeight = 11
+	c := newTestChain(t, spec)
+	ctx := context.Background()
+
+	status, err := c.GetStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.ChainID != "sim-1" || status.EarliestHeight != 11 || status.LatestHeight != 100 {
+		t.Errorf("got status %+v", status)
+	}
+
+	blocks, err := c.GetBlockRange(ctx, 11, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, block := range blocks {
+		if !block.Time.Equal(c.spec.GenesisTime.Add(time.Duration(i) * 6 * time.Second)) {
+			t.Fatalf("got block %d at %s", block.Height, block.Time)
+		}
+		if i > 0 && (block.BlockTime != 6 || block.ParentHash != blocks[i-1].Hash) {
+			t.Fatalf("got block %d with block time %v, parent %s", block.Height, block.BlockTime, block.ParentHash)
+		}
+	}
+
+	if _, err := c.GetBlockByHeight(ctx, 10); err == nil || !strings.Contains(err.Error(), "the chain has blocks 11-100") {
+		t.Errorf("got error %v for a height below the start", err)
+	}
+	if _, err := c.GetBlockRange(ctx, 90, 101); err == nil {
+		t.Error("expected an error for heights above the latest")
+	}
+}
+
+func TestChainProposerRotation(t *testing.T) {
+	spec := constantSpec(4000)
+	spec.Validators = []Validator{
+		{Name: "alpha", Power: 50},
+		{Name: "beta", Power: 30},
+		{Name: "gamma", Power: 20},
+	}
+	c := newTestChain(t, spec)
+
+	blocks, _ := c.GetBlockRange(context.Background(), 1, 4000)
+	proposed := make(map[string]int)
+	for _, block := range blocks {
+		proposed[block.Proposer]++
+	}
+
+	// Weighted round robin is exact over every 100 blocks of total power 100
+	for i, want := range []int{2000, 1200, 800} {
+		if got := proposed[c.addresses[i]]; got != want {
+			t.Errorf("%s proposed %d blocks, want %d", spec.Validators[i].Name, got, want)
+		}
+	}
+
+	// Proposers are described by their names
+	set, err := c.GetValidatorSet(context.Background(), 4000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	described, err := c.GetStakingValidators(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, validator := range spec.Validators {
+		if set[i].Address != c.addresses[i] || set[i].VotingPower != validator.Power {
+			t.Errorf("got validator %+v, want %s of power %d", set[i], c.addresses[i], validator.Power)
+		}
+		if described[i].Address != c.addresses[i] || described[i].Moniker != validator.Name {
+			t.Errorf("got description %+v, want %s named %s", described[i], c.addresses[i], validator.Name)
+		}
+	}
+	if _, err := c.GetValidatorSet(context.Background(), 4001); err == nil {
+		t.Error("got the validators of a height past the latest")
+	}
+}
+
+func TestChainRoundsAndHalts(t *testing.T) {
+	spec := constantSpec(10000)
+	spec.Rounds = Rounds{Probability: 0.2, Timeout: 3 * time.Second}
+	spec.Halts = []Halt{{Height: 5000, Duration: 30 * time.Minute}}
+	c := newTestChain(t, spec)
+
+	blocks, err := c.GetBlockRange(context.Background(), 1, 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var delayed int
+	for _, block := range blocks[1:] {
+		height, blockTime, round := block.Height, block.BlockTime, block.Commit.Round
+		if block.Commit.Signatures != len(c.spec.Validators) || block.Commit.SignedPower != 1 {
+			t.Fatalf("got commit %+v in block %d", block.Commit, height)
+		}
+		if round > 0 {
+			delayed++
+		}
+
+		want := 6 + 3*float64(round)
+		if height == 5000 {
+			want += 1800
+		}
+		if blockTime != want {
+			t.Fatalf("block %d took %vs in round %d, want %vs", height, blockTime, round, want)
+		}
+	}
+
+	// Rounds beyond the first happen with probability 0.2
+	if fraction := float64(delayed) / float64(len(blocks)-1); math.Abs(fraction-0.2) > 0.02 {
+		t.Errorf("got %.3f of blocks in a later round, want about 0.2", fraction)
+	}
+}
+
+func TestChainClockSkew(t *testing.T) {
+	spec := constantSpec(100)
+	spec.Validators = []Validator{
+		{Name: "on-time", Power: 1},
+		{Name: "ahead", Power: 1, ClockSkew: 2 * time.Second},
+	}
+	c := newTestChain(t, spec)
+
+	// Blocks of the proposer running ahead come 2 seconds late, the ones
+	// after them 2 seconds early
+	blocks, _ := c.GetBlockRange(context.Background(), 1, 100)
+	for _, block := range blocks[1:] {
+		want := 4.0
+		if block.Proposer == c.addresses[1] {
+			want = 8
+		}
+		if block.BlockTime != want {
+			t.Fatalf("block %d took %vs, want %vs", block.Height, block.BlockTime, want)
+		}
+	}
+}
+
+func TestChainDistributions(t *testing.T) {
+	tests := []struct {
+		name      string
+		blockTime Distribution
+		check     func(t *testing.T, sorted []float64)
+	}{
+		{
+			name:      "lognormal",
+			blockTime: Distribution{Distribution: DistributionLogNormal, Median: 5 * time.Second, Sigma: 0.3},
+			check: func(t *testing.T, sorted []float64) {
+				if median := sorted[len(sorted)/2]; math.Abs(median-5) > 0.1 {
+					t.Errorf("got median %v, want about 5", median)
+				}
+				// The log-normal tail is long: P99 is exp(2.33 sigma) times the median
+				if p99 := sorted[len(sorted)*99/100]; math.Abs(p99-5*math.Exp(2.326*0.3)) > 0.5 {
+					t.Errorf("got P99 %v, want about %v", p99, 5*math.Exp(2.326*0.3))
+				}
+			},
+		},
+		{
+			name: "mixture",
+			blockTime: Distribution{Distribution: DistributionMixture, Components: []Component{
+				{Weight: 9, Distribution: Distribution{Distribution: DistributionNormal, Mean: 6 * time.Second, StdDev: 100 * time.Millisecond}},
+				{Weight: 1, Distribution: Distribution{Distribution: DistributionConstant, Mean: 20 * time.Second}},
+			}},
+			check: func(t *testing.T, sorted []float64) {
+				slow := len(sorted) - sort.SearchFloat64s(sorted, 19.999)
+				if fraction := float64(slow) / float64(len(sorted)); math.Abs(fraction-0.1) > 0.015 {
+					t.Errorf("got %.3f of 20 second blocks, want about 0.1", fraction)
+				}
+				if median := sorted[len(sorted)/2]; math.Abs(median-6) > 0.05 {
+					t.Errorf("got median %v, want about 6", median)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := constantSpec(10000)
+			spec.BlockTime = tt.blockTime
+			times := blockTimes(t, newTestChain(t, spec), 1, 10000)
+			sort.Float64s(times)
+			tt.check(t, times)
+		})
+	}
+}
+
+func TestChainSubscribeNewBlocks(t *testing.T) {
+	spec := constantSpec(50)
+	spec.Speed = 1000 // 6 second blocks every 6 milliseconds
+	c := newTestChain(t, spec)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	blockChan, _ := c.SubscribeNewBlocks(ctx)
+	for want := int64(51); want <= 53; want++ {
+		block := <-blockChan
+		if block == nil || block.Height != want || block.BlockTime != 6 {
+			t.Fatalf("got block %+v, want block %d", block, want)
+		}
+	}
+
+	// Delivered blocks are part of the chain
+	latest, _ := c.GetLatestBlockHeight(ctx)
+	if latest < 53 {
+		t.Errorf("got latest height %d, want at least 53", latest)
+	}
+	if _, err := c.GetBlockByHeight(ctx, 53); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNode(t *testing.T) {
+	n := &Node{Chain: newTestChain(t, constantSpec(100)), Earliest: 11, Latest: 90, Missing: map[int64]bool{50: true}}
+	ctx := context.Background()
+
+	status, err := n.GetStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.ChainID != "sim-1" || status.EarliestHeight != 11 || status.LatestHeight != 90 {
+		t.Errorf("got status %+v", status)
+	}
+
+	tests := []struct {
+		start, end int64
+		wantErr    string
+	}{
+		{11, 49, ""},
+		{10, 20, "blocks 10-20 are not available, the node has blocks 11-90"},
+		{80, 91, "blocks 80-91 are not available, the node has blocks 11-90"},
+		{45, 55, "block 50 is missing"},
+	}
+	for _, tt := range tests {
+		_, err := n.GetBlockRange(ctx, tt.start, tt.end)
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+			t.Errorf("blocks %d-%d: got error %v, want %q", tt.start, tt.end, err, tt.wantErr)
+		}
+	}
+	if _, err := n.GetBlockByHeight(ctx, 90); err != nil {
+		t.Error(err)
+	}
+
+	want := [][2]int64{{11, 49}, {10, 20}, {80, 91}, {45, 55}, {90, 90}}
+	if got := n.Ranges(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got ranges %v, want %v", got, want)
+	}
+	if got := n.TakeRanges(); !reflect.DeepEqual(got, want) || len(n.Ranges()) != 0 {
+		t.Errorf("took ranges %v, leaving %v", got, n.Ranges())
+	}
+
+	// Edited block times carry over to the block times served
+	n.Edit = func(block *types.BlockInfo) {
+		block.Time = block.Time.Add(time.Duration(block.Height%2) * time.Second)
+		block.Commit = nil
+	}
+	blocks, err := n.GetBlockRange(ctx, 20, 23)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, block := range blocks {
+		if wantTime := []float64{0, 7, 5, 7}[i]; block.BlockTime != wantTime || block.Commit != nil {
+			t.Errorf("got block %d with block time %v and commit %+v, want %v without commit", block.Height, block.BlockTime, block.Commit, wantTime)
+		}
+	}
+
+	n.NoEarliest = true
+	if status, _ := n.GetStatus(ctx); status.EarliestHeight != 0 {
+		t.Errorf("got earliest height %d, want it left out", status.EarliestHeight)
+	}
+
+	n.Err = errors.New("connection refused")
+	if _, err := n.GetLatestBlockHeight(ctx); err != n.Err {
+		t.Errorf("got error %v, want %v", err, n.Err)
+	}
+	if _, err := n.GetBlockRange(ctx, 20, 30); err != n.Err {
+		t.Errorf("got error %v, want %v", err, n.Err)
+	}
+	if got := n.Ranges(); len(got) != 2 {
+		t.Errorf("got ranges %v, want the failed one recorded", got)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spec.yaml")
+	err := os.WriteFile(path, []byte(`
+seed: 42
+genesis_time: 2026-03-01T00:00:00Z
+latest_height: 1000
+block_time:
+  distribution: mixture
+  components:
+    - weight: 0.95
+      distribution: normal
+      mean: 6s
+      stddev: 250ms
+    - weight: 0.05
+      distribution: lognormal
+      median: 15s
+      sigma: 0.2
+rounds:
+  probability: 0.01
+  timeout: 3s
+halts:
+  - height: 500
+    duration: 10m
+validators:
+  - name: alpha
+    power: 100
+    clock_skew: 500ms
+  - name: beta
+    address: 0123456789abcdef0123456789abcdef01234567
+    power: 60
+txs_per_block: 5
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := Open(path, "configured-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.spec.BlockTime.Components[1].Median != 15*time.Second || c.spec.Validators[0].ClockSkew != 500*time.Millisecond {
+		t.Errorf("got spec %+v", c.spec)
+	}
+
+	status, _ := c.GetStatus(context.Background())
+	if status.ChainID != "configured-1" || status.LatestHeight != 1000 {
+		t.Errorf("got status %+v", status)
+	}
+	if c.addresses[1] != "0123456789ABCDEF0123456789ABCDEF01234567" {
+		t.Errorf("got address %s", c.addresses[1])
+	}
+}
+
+func TestNewInvalidSpec(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(s *Spec)
+		wantErr string
+	}{
+		{"no latest height", func(s *Spec) { s.LatestHeight = 0 }, "latest height 0 is below the start height 1"},
+		{"no block time", func(s *Spec) { s.BlockTime = Distribution{} }, "block time mean must be positive"},
+		{"unknown distribution", func(s *Spec) { s.BlockTime.Distribution = "poisson" }, "unknown block time distribution: poisson"},
+		{"empty mixture", func(s *Spec) { s.BlockTime.Distribution = DistributionMixture }, "mixture needs at least one component"},
+		{"certain rounds", func(s *Spec) { s.Rounds = Rounds{Probability: 1, Timeout: time.Second} }, "round probability"},
+		{"rounds without timeout", func(s *Spec) { s.Rounds = Rounds{Probability: 0.1} }, "round timeout must be positive"},
+		{"powerless validator", func(s *Spec) { s.Validators = []Validator{{Name: "zero"}} }, "validator zero must have positive voting power"},
+		{"empty halt", func(s *Spec) { s.Halts = []Halt{{Height: 10}} }, "halt before height 10"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := constantSpec(100)
+			tt.modify(&spec)
+			if _, err := New(spec); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
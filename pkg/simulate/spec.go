@@ -0,0 +1,209 @@
+package simulate
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxBlocks is the largest number of blocks a spec may generate up front
+const maxBlocks = 10_000_000
+
+// Distributions of block times
+const (
+	DistributionConstant  = "constant"  // always Mean
+	DistributionNormal    = "normal"    // Mean plus normal noise of StdDev
+	DistributionLogNormal = "lognormal" // log-normal around Median with shape Sigma
+	DistributionMixture   = "mixture"   // one of Components, picked by weight
+)
+
+// Spec describes a synthetic chain. The same spec and seed always generate
+// the same chain
+type Spec struct {
+	ChainID      string       `yaml:"chain_id"`      // chain ID reported by the node, the configured one when empty
+	Seed         uint64       `yaml:"seed"`          // seed of all random draws
+	GenesisTime  time.Time    `yaml:"genesis_time"`  // time of the block at StartHeight
+	StartHeight  int64        `yaml:"start_height"`  // earliest height the node has, 1 by default
+	LatestHeight int64        `yaml:"latest_height"` // latest height when the chain is created
+	BlockTime    Distribution `yaml:"block_time"`    // time between the commits of consecutive blocks
+	Rounds       Rounds       `yaml:"rounds"`        // extra consensus rounds delaying blocks
+	Halts        []Halt       `yaml:"halts"`         // heights the chain stops before
+	Validators   []Validator  `yaml:"validators"`    // 4 validators of equal power when empty
+	TxsPerBlock  int          `yaml:"txs_per_block"` // mean number of transactions per block
+	Speed        float64      `yaml:"speed"`         // pace of new blocks on subscription relative to their block times, 1 by default
+}
+
+// Distribution is a distribution of block times
+type Distribution struct {
+	Distribution string        `yaml:"distribution"` // constant, normal, lognormal or mixture
+	Mean         time.Duration `yaml:"mean"`         // constant and normal
+	StdDev       time.Duration `yaml:"stddev"`       // normal
+	Median       time.Duration `yaml:"median"`       // lognormal
+	Sigma        float64       `yaml:"sigma"`        // lognormal
+	Components   []Component   `yaml:"components"`   // mixture
+}
+
+// Component is one distribution of a mixture
+type Component struct {
+	Weight       float64 `yaml:"weight"`
+	Distribution `yaml:",inline"`
+}
+
+// Rounds models blocks that need more than one consensus round. Every
+// further round happens with Probability and delays the block by Timeout
+type Rounds struct {
+	Probability float64       `yaml:"probability"`
+	Timeout     time.Duration `yaml:"timeout"`
+	Max         int           `yaml:"max"` // most extra rounds of one block, 10 by default
+}
+
+// Halt stops the chain before Height for Duration, as during an upgrade
+type Halt struct {
+	Height   int64         `yaml:"height"`
+	Duration time.Duration `yaml:"duration"`
+}
+
+// Validator proposes blocks in proportion to its voting power. ClockSkew
+// shifts the timestamps of the blocks it proposes, as a proposer with a
+// drifting clock would
+type Validator struct {
+	Name      string        `yaml:"name"`
+	Address   string        `yaml:"address"` // hex consensus address, derived from Name when empty
+	Power     int64         `yaml:"power"`
+	ClockSkew time.Duration `yaml:"clock_skew"`
+}
+
+// LoadSpec reads a spec from a YAML file
+func LoadSpec(path string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read simulation spec: %w", err)
+	}
+
+	var spec Spec
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("invalid simulation spec %s: %w", path, err)
+	}
+	return &spec, nil
+}
+
+// validate fills in defaults and checks the spec
+func (s *Spec) validate() error {
+	if s.StartHeight == 0 {
+		s.StartHeight = 1
+	}
+	if s.GenesisTime.IsZero() {
+		s.GenesisTime = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	if s.Speed == 0 {
+		s.Speed = 1
+	}
+	if s.Rounds.Max == 0 {
+		s.Rounds.Max = 10
+	}
+	if len(s.Validators) == 0 {
+		for i := 0; i < 4; i++ {
+			s.Validators = append(s.Validators, Validator{Name: fmt.Sprintf("validator-%d", i), Power: 1})
+		}
+	}
+
+	if s.StartHeight < 1 {
+		return fmt.Errorf("start height must be positive")
+	}
+	if s.LatestHeight < s.StartHeight {
+		return fmt.Errorf("latest height %d is below the start height %d", s.LatestHeight, s.StartHeight)
+	}
+	if s.LatestHeight-s.StartHeight >= maxBlocks {
+		return fmt.Errorf("a simulated chain can have at most %d blocks", maxBlocks)
+	}
+	if s.Speed < 0 {
+		return fmt.Errorf("speed must be positive")
+	}
+	if s.TxsPerBlock < 0 {
+		return fmt.Errorf("transactions per block must be non-negative")
+	}
+	if s.Rounds.Probability < 0 || s.Rounds.Probability >= 1 {
+		return fmt.Errorf("round probability must be at least 0 and below 1")
+	}
+	if s.Rounds.Probability > 0 && s.Rounds.Timeout <= 0 {
+		return fmt.Errorf("round timeout must be positive")
+	}
+	for _, halt := range s.Halts {
+		if halt.Duration <= 0 {
+			return fmt.Errorf("halt before height %d must last a positive duration", halt.Height)
+		}
+	}
+	for _, validator := range s.Validators {
+		if validator.Power <= 0 {
+			return fmt.Errorf("validator %s must have positive voting power", validator.Name)
+		}
+	}
+
+	return s.BlockTime.validate()
+}
+
+func (d *Distribution) validate() error {
+	switch d.Distribution {
+	case "", DistributionConstant:
+		if d.Mean <= 0 {
+			return fmt.Errorf("block time mean must be positive")
+		}
+	case DistributionNormal:
+		if d.Mean <= 0 || d.StdDev < 0 {
+			return fmt.Errorf("normal block times need a positive mean and a non-negative stddev")
+		}
+	case DistributionLogNormal:
+		if d.Median <= 0 || d.Sigma < 0 {
+			return fmt.Errorf("log-normal block times need a positive median and a non-negative sigma")
+		}
+	case DistributionMixture:
+		if len(d.Components) == 0 {
+			return fmt.Errorf("mixture needs at least one component")
+		}
+		for i := range d.Components {
+			component := &d.Components[i]
+			if component.Weight <= 0 {
+				return fmt.Errorf("mixture component %d needs a positive weight", i+1)
+			}
+			if component.Distribution.Distribution == DistributionMixture {
+				return fmt.Errorf("mixture component %d cannot be a mixture", i+1)
+			}
+			if err := component.Distribution.validate(); err != nil {
+				return fmt.Errorf("mixture component %d: %w", i+1, err)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown block time distribution: %s (must be constant, normal, lognormal or mixture)", d.Distribution)
+	}
+	return nil
+}
+
+// sample draws a block time
+func (d *Distribution) sample(rng *rand.Rand) time.Duration {
+	switch d.Distribution {
+	case DistributionNormal:
+		return d.Mean + time.Duration(rng.NormFloat64()*float64(d.StdDev))
+	case DistributionLogNormal:
+		return time.Duration(float64(d.Median) * math.Exp(d.Sigma*rng.NormFloat64()))
+	case DistributionMixture:
+		var total float64
+		for _, component := range d.Components {
+			total += component.Weight
+		}
+		pick := rng.Float64() * total
+		for _, component := range d.Components {
+			if pick < component.Weight {
+				return component.Distribution.sample(rng)
+			}
+			pick -= component.Weight
+		}
+		last := d.Components[len(d.Components)-1].Distribution
+		return last.sample(rng)
+	default:
+		return d.Mean
+	}
+}
@@ -0,0 +1,322 @@
+// Package testkit serves scripted CometBFT chains over the real JSON-RPC and
+// websocket routes of a node, with injectable faults, so programs embedding
+// the calculator can test their clients end to end without a network.
+package testkit
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	abci "github.com/cometbft/cometbft/abci/types"
+	"github.com/cometbft/cometbft/crypto"
+	"github.com/cometbft/cometbft/crypto/ed25519"
+	cmtproto "github.com/cometbft/cometbft/proto/tendermint/types"
+	coretypes "github.com/cometbft/cometbft/rpc/core/types"
+	tmtypes "github.com/cometbft/cometbft/types"
+	codectypes "github.com/cosmos/cosmos-sdk/codec/types"
+	sdked25519 "github.com/cosmos/cosmos-sdk/crypto/keys/ed25519"
+	"github.com/cosmos/cosmos-sdk/types/bech32"
+	stakingtypes "github.com/cosmos/cosmos-sdk/x/staking/types"
+)
+
+// DefaultBlockTime is the time between blocks whose time is not scripted
+const DefaultBlockTime = 6 * time.Second
+
+// OperatorPrefix is the bech32 prefix of the operator addresses of validators
+const OperatorPrefix = "cosmosvaloper"
+
+// GenesisTime is the time of the first block when it is not scripted
+var GenesisTime = time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+// Validator is a validator of a chain. Its key is derived from Name, so the
+// same name always has the same address
+type Validator struct {
+	Name  string
+	Power int64
+}
+
+// Block scripts one block of a chain. The zero value is an empty block
+// DefaultBlockTime after the previous one
+type Block struct {
+	Time      time.Time // header time, DefaultBlockTime after the previous block when zero
+	Txs       int       // number of transactions
+	GasWanted int64     // gas wanted by every transaction
+	GasUsed   int64     // gas used by every transaction
+
+	// The commit of the previous block, which this block carries. By default
+	// every validator signs it in round 0
+	Round  int32    // round the previous block was committed in
+	Absent []string // names of validators missing from the commit
+	Nil    []string // names of validators that voted nil
+}
+
+// Chain is a scripted chain of real CometBFT blocks. Proposers rotate like
+// on CometBFT, and every block carries the commit of the block before it,
+// signed by all validators unless scripted otherwise. A Chain may be extended while nodes serve it.
+type Chain struct {
+	chainID string
+	keys    map[string]crypto.PrivKey // private keys by hex address
+	names   []string                  // names of the validators, in the order given
+
+	mu      sync.Mutex
+	vals    *tmtypes.ValidatorSet // set of the next block
+	blocks  []*tmtypes.Block      // index 0 holding height 1
+	metas   []*tmtypes.BlockMeta
+	valSets []*tmtypes.ValidatorSet
+	results []*coretypes.ResultBlockResults
+
+	listeners map[chan int64]struct{}
+}
+
+// NewChain creates a chain without blocks. Without validators, the chain has
+// 4 validators of equal power
+func NewChain(chainID string, validators ...Validator) *Chain {
+	if len(validators) == 0 {
+		for i := 0; i < 4; i++ {
+			validators = append(validators, Validator{Name: fmt.Sprintf("validator-%d", i), Power: 1})
+		}
+	}
+
+	c := &Chain{
+		chainID:   chainID,
+		keys:      make(map[string]crypto.PrivKey, len(validators)),
+		listeners: make(map[chan int64]struct{}),
+	}
+	vals := make([]*tmtypes.Validator, 0, len(validators))
+	for _, validator := range validators {
+		key := ed25519.GenPrivKeyFromSecret([]byte(validator.Name))
+		c.keys[key.PubKey().Address().String()] = key
+		c.names = append(c.names, validator.Name)
+		vals = append(vals, tmtypes.NewValidator(key.PubKey(), validator.Power))
+	}
+	c.vals = tmtypes.NewValidatorSet(vals)
+
+	return c
+}
+
+// ChainID returns the chain ID of the chain
+func (c *Chain) ChainID() string {
+	return c.chainID
+}
+
+// Address returns the hex consensus address of the validator named name
+func (c *Chain) Address(name string) string {
+	return ed25519.GenPrivKeyFromSecret([]byte(name)).PubKey().Address().String()
+}
+
+// OperatorAddress returns the bech32 operator address of the validator named
+// name, which is derived from the name like its key
+func (c *Chain) OperatorAddress(name string) string {
+	sum := sha256.Sum256([]byte("operator/" + name))
+	address, err := bech32.ConvertAndEncode(OperatorPrefix, sum[:20])
+	if err != nil {
+		panic(fmt.Sprintf("testkit: failed to encode the operator address of %s: %v", name, err))
+	}
+	return address
+}
+
+// Height returns the height of the latest block, 0 before the first one
+func (c *Chain) Height() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return int64(len(c.blocks))
+}
+
+// Block returns the block at height, or nil when the chain has no such block
+func (c *Chain) Block(height int64) *tmtypes.Block {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if height < 1 || height > int64(len(c.blocks)) {
+		return nil
+	}
+	return c.blocks[height-1]
+}
+
+// Append adds blocks to the chain and announces them to the subscribers of
+// every node serving it. A chain of n default blocks is appended with
+// Append(make([]Block, n)...)
+func (c *Chain) Append(blocks ...Block) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, script := range blocks {
+		height := int64(len(c.blocks)) + 1
+		c.appendBlock(height, script)
+
+		for listener := range c.listeners {
+			// A subscriber that does not keep up misses blocks, as on a node
+			select {
+			case listener <- height:
+			default:
+			}
+		}
+	}
+}
+
+// appendBlock builds, signs and stores the block at height, c.mu must be held
+func (c *Chain) appendBlock(height int64, script Block) {
+	blockTime := script.Time
+	switch {
+	case !blockTime.IsZero():
+	case height == 1:
+		blockTime = GenesisTime
+	default:
+		blockTime = c.blocks[height-2].Time.Add(DefaultBlockTime)
+	}
+
+	// The commit of the previous block is timestamped with this block's
+	// time, so BFT time of every block matches its script
+	lastCommit := &tmtypes.Commit{}
+	var lastBlockID tmtypes.BlockID
+	if height > 1 {
+		lastBlockID = c.metas[height-2].BlockID
+		lastCommit = c.sign(height-1, lastBlockID, c.valSets[height-2], blockTime, script)
+	}
+
+	txs := make(tmtypes.Txs, script.Txs)
+	results := &coretypes.ResultBlockResults{Height: height}
+	for i := range txs {
+		txs[i] = tmtypes.Tx(fmt.Sprintf("%s/%d/%d", c.chainID, height, i))
+		results.TxsResults = append(results.TxsResults, &abci.ExecTxResult{
+			GasWanted: script.GasWanted,
+			GasUsed:   script.GasUsed,
+			Events: []abci.Event{{
+				Type:       "message",
+				Attributes: []abci.EventAttribute{{Key: "action", Value: "send", Index: true}},
+			}},
+		})
+	}
+
+	block := tmtypes.MakeBlock(height, txs, lastCommit, nil)
+	block.ChainID = c.chainID
+	block.Time = blockTime
+	block.LastBlockID = lastBlockID
+	block.ValidatorsHash = c.vals.Hash()
+	block.NextValidatorsHash = c.vals.Hash()
+	block.ProposerAddress = c.vals.GetProposer().Address
+
+	parts, err := block.MakePartSet(tmtypes.BlockPartSizeBytes)
+	if err != nil {
+		panic(fmt.Sprintf("testkit: failed to split block %d into parts: %v", height, err))
+	}
+
+	c.blocks = append(c.blocks, block)
+	c.metas = append(c.metas, tmtypes.NewBlockMeta(block, parts))
+	c.valSets = append(c.valSets, c.vals.Copy())
+	c.results = append(c.results, results)
+	c.vals.IncrementProposerPriority(1)
+}
+
+// sign builds the commit of vals for blockID at height, in the round and
+// with the absent and nil validators of script
+func (c *Chain) sign(height int64, blockID tmtypes.BlockID, vals *tmtypes.ValidatorSet, timestamp time.Time, script Block) *tmtypes.Commit {
+	absent := make([]string, len(script.Absent))
+	for i, name := range script.Absent {
+		absent[i] = c.Address(name)
+	}
+	nilVotes := make([]string, len(script.Nil))
+	for i, name := range script.Nil {
+		nilVotes[i] = c.Address(name)
+	}
+
+	signatures := make([]tmtypes.CommitSig, len(vals.Validators))
+	for i, val := range vals.Validators {
+		address := val.Address.String()
+		if slices.Contains(absent, address) {
+			signatures[i] = tmtypes.NewCommitSigAbsent()
+			continue
+		}
+
+		flag, voteBlockID := tmtypes.BlockIDFlagCommit, blockID
+		if slices.Contains(nilVotes, address) {
+			flag, voteBlockID = tmtypes.BlockIDFlagNil, tmtypes.BlockID{}
+		}
+		vote := &tmtypes.Vote{
+			Type:             cmtproto.PrecommitType,
+			Height:           height,
+			Round:            script.Round,
+			BlockID:          voteBlockID,
+			Timestamp:        timestamp,
+			ValidatorAddress: val.Address,
+			ValidatorIndex:   int32(i),
+		}
+		signature, err := c.keys[address].Sign(tmtypes.VoteSignBytes(c.chainID, vote.ToProto()))
+		if err != nil {
+			panic(fmt.Sprintf("testkit: failed to sign block %d: %v", height, err))
+		}
+
+		signatures[i] = tmtypes.CommitSig{
+			BlockIDFlag:      flag,
+			ValidatorAddress: val.Address,
+			Timestamp:        timestamp,
+			Signature:        signature,
+		}
+	}
+
+	return &tmtypes.Commit{Height: height, Round: script.Round, BlockID: blockID, Signatures: signatures}
+}
+
+// meta returns the block and block meta at height, which must exist
+func (c *Chain) meta(height int64) (*tmtypes.Block, *tmtypes.BlockMeta) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.blocks[height-1], c.metas[height-1]
+}
+
+// blockResults returns the execution results of the block at height, which must exist
+func (c *Chain) blockResults(height int64) *coretypes.ResultBlockResults {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.results[height-1]
+}
+
+// validators returns the validator set of height, which may be one above the
+// latest height like on a node
+func (c *Chain) validators(height int64) *tmtypes.ValidatorSet {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if height > int64(len(c.valSets)) {
+		return c.vals.Copy()
+	}
+	return c.valSets[height-1]
+}
+
+// stakingValidators returns the validators as the staking module of a
+// Cosmos SDK chain describes them, with their names as monikers
+func (c *Chain) stakingValidators() []stakingtypes.Validator {
+	vals := make([]stakingtypes.Validator, len(c.names))
+	for i, name := range c.names {
+		pubkey, err := codectypes.NewAnyWithValue(&sdked25519.PubKey{Key: ed25519.GenPrivKeyFromSecret([]byte(name)).PubKey().Bytes()})
+		if err != nil {
+			panic(fmt.Sprintf("testkit: failed to pack the consensus key of %s: %v", name, err))
+		}
+		vals[i] = stakingtypes.Validator{
+			OperatorAddress: c.OperatorAddress(name),
+			ConsensusPubkey: pubkey,
+			Status:          stakingtypes.Bonded,
+			Description:     stakingtypes.Description{Moniker: name},
+		}
+	}
+	return vals
+}
+
+// subscribe returns a channel receiving the height of every appended block
+// until cancel is called
+func (c *Chain) subscribe() (heights <-chan int64, cancel func()) {
+	listener := make(chan int64, 100)
+
+	c.mu.Lock()
+	c.listeners[listener] = struct{}{}
+	c.mu.Unlock()
+
+	return listener, func() {
+		c.mu.Lock()
+		delete(c.listeners, listener)
+		c.mu.Unlock()
+	}
+}
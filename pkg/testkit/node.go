@@ -0,0 +1,611 @@
+package testkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	abci "github.com/cometbft/cometbft/abci/types"
+	cmtbytes "github.com/cometbft/cometbft/libs/bytes"
+	"github.com/cometbft/cometbft/libs/log"
+	"github.com/cometbft/cometbft/p2p"
+	coretypes "github.com/cometbft/cometbft/rpc/core/types"
+	rpcserver "github.com/cometbft/cometbft/rpc/jsonrpc/server"
+	rpctypes "github.com/cometbft/cometbft/rpc/jsonrpc/types"
+	tmtypes "github.com/cometbft/cometbft/types"
+	"github.com/cosmos/cosmos-sdk/types/query"
+	stakingtypes "github.com/cosmos/cosmos-sdk/x/staking/types"
+)
+
+// Limits of the CometBFT RPC, which the node enforces the same way
+const (
+	maxBlockMetas  = 20  // headers per /blockchain call
+	defaultPerPage = 30  // validators per page when not requested
+	maxPerPage     = 100 // validators per page at most
+)
+
+// stakingValidatorsPath is the one application query the node answers
+const stakingValidatorsPath = "/cosmos.staking.v1beta1.Query/Validators"
+
+// unknownRequestCode is the code of the Cosmos SDK for queries it does not know
+const unknownRequestCode = 6
+
+// eventWriteTimeout bounds how long an event may take to reach a subscriber
+const eventWriteTimeout = 10 * time.Second
+
+// Node serves a Chain over HTTP like a CometBFT node: the status, block,
+// blockchain, block_results and validators routes as JSON-RPC and URI
+// requests, the staking validators over abci_query like a Cosmos SDK
+// application, and NewBlock subscriptions over /websocket. Faults can be
+// injected while it runs.
+type Node struct {
+	*httptest.Server
+	chain *Chain
+
+	mu            sync.Mutex
+	latency       time.Duration
+	failures      []*failure
+	pruned        []heightRange
+	catchingUp    bool
+	muted         bool
+	calls         map[string]int
+	subscriptions map[string]map[string]func() // cancel of every query by websocket connection
+	websockets    map[string]net.Conn          // hijacked websocket connections by remote address
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// failure answers the next count requests of method with an HTTP status
+type failure struct {
+	method string // any method when empty
+	status int
+	count  int
+}
+
+// heightRange is an inclusive range of heights
+type heightRange struct {
+	from, to int64
+}
+
+// NewNode starts a node serving chain, which is stopped when t ends
+func NewNode(t testing.TB, chain *Chain) *Node {
+	n := &Node{
+		chain:         chain,
+		calls:         make(map[string]int),
+		subscriptions: make(map[string]map[string]func()),
+		websockets:    make(map[string]net.Conn),
+		done:          make(chan struct{}),
+	}
+
+	routes := map[string]*rpcserver.RPCFunc{
+		"status":          rpcserver.NewRPCFunc(n.status, ""),
+		"block":           rpcserver.NewRPCFunc(n.block, "height"),
+		"blockchain":      rpcserver.NewRPCFunc(n.blockchain, "minHeight,maxHeight"),
+		"block_results":   rpcserver.NewRPCFunc(n.blockResults, "height"),
+		"validators":      rpcserver.NewRPCFunc(n.validators, "height,page,per_page"),
+		"abci_query":      rpcserver.NewRPCFunc(n.abciQuery, "path,data,height,prove"),
+		"subscribe":       rpcserver.NewWSRPCFunc(n.subscribe, "query"),
+		"unsubscribe":     rpcserver.NewWSRPCFunc(n.unsubscribe, "query"),
+		"unsubscribe_all": rpcserver.NewWSRPCFunc(n.unsubscribeAll, ""),
+	}
+
+	mux := http.NewServeMux()
+	rpcserver.RegisterRPCFuncs(mux, routes, log.NewNopLogger())
+	mux.HandleFunc("/websocket", rpcserver.NewWebsocketManager(routes).WebsocketHandler)
+
+	n.Server = httptest.NewUnstartedServer(n.inject(mux))
+	n.Server.Config.ConnState = n.trackWebsockets
+	n.Server.Start()
+	t.Cleanup(n.Close)
+	return n
+}
+
+// Close ends all subscriptions and stops the node
+func (n *Node) Close() {
+	n.closeOnce.Do(func() {
+		close(n.done)
+		n.Server.Close()
+	})
+}
+
+// SetLatency delays every following request by d
+func (n *Node) SetLatency(d time.Duration) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.latency = d
+}
+
+// Fail answers the next count requests of method, or of any method when
+// method is empty, with the HTTP status, e.g. 429 or 503. The websocket
+// handshake is the method "websocket". Failures queued for the same requests
+// are used up in order
+func (n *Node) Fail(method string, status, count int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.failures = append(n.failures, &failure{method: method, status: status, count: count})
+}
+
+// Disconnect closes every websocket connection, like a node restarting or a
+// proxy cutting connections. Subscribers may connect again
+func (n *Node) Disconnect() {
+	n.mu.Lock()
+	conns := n.websockets
+	n.websockets = make(map[string]net.Conn)
+	n.mu.Unlock()
+
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
+
+// MuteEvents sets whether events are withheld from subscribers, whose
+// websockets then stay open but quiet, like on a node whose event bus fell
+// behind. Events of blocks appended while muted are never sent
+func (n *Node) MuteEvents(muted bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.muted = muted
+}
+
+// Prune removes the heights from..to from the node. Pruning the lowest
+// heights raises the earliest height the node reports, like a node pruning
+// old blocks; heights pruned above it are holes the node silently skips
+func (n *Node) Prune(from, to int64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.pruned = append(n.pruned, heightRange{from: from, to: to})
+}
+
+// SetCatchingUp sets whether the node reports that it is still syncing
+func (n *Node) SetCatchingUp(catchingUp bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.catchingUp = catchingUp
+}
+
+// Calls returns how many requests of method the node received. Subscriptions
+// count once they are in place
+func (n *Node) Calls(method string) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.calls[method]
+}
+
+// trackWebsockets keeps the connections hijacked by websocket handshakes, so
+// Disconnect can close them
+func (n *Node) trackWebsockets(conn net.Conn, state http.ConnState) {
+	if state != http.StateHijacked {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.websockets[conn.RemoteAddr().String()] = conn
+}
+
+// inject counts the requests to next and applies latency and failures to them
+func (n *Node) inject(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods := requestMethods(r)
+
+		n.mu.Lock()
+		for _, method := range methods {
+			n.calls[method]++
+		}
+		latency := n.latency
+		status := n.nextFailure(methods)
+		n.mu.Unlock()
+
+		if latency > 0 {
+			select {
+			case <-time.After(latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		if status != 0 {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// nextFailure uses up the first queued failure matching methods and returns
+// its status, or 0 when the request is served. n.mu must be held
+func (n *Node) nextFailure(methods []string) int {
+	for i, f := range n.failures {
+		if f.method != "" && !slices.Contains(methods, f.method) {
+			continue
+		}
+
+		f.count--
+		if f.count <= 0 {
+			n.failures = append(n.failures[:i], n.failures[i+1:]...)
+		}
+		return f.status
+	}
+	return 0
+}
+
+// requestMethods returns the RPC methods of a URI, JSON-RPC or batch request.
+// The body is left for the handler to read
+func requestMethods(r *http.Request) []string {
+	if r.URL.Path != "/" {
+		return []string{strings.TrimPrefix(r.URL.Path, "/")}
+	}
+
+	body, err := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return nil
+	}
+
+	type request struct {
+		Method string `json:"method"`
+	}
+	var batch []request
+	if err := json.Unmarshal(body, &batch); err != nil {
+		var single request
+		json.Unmarshal(body, &single)
+		batch = []request{single}
+	}
+
+	methods := make([]string, 0, len(batch))
+	for _, req := range batch {
+		methods = append(methods, req.Method)
+	}
+	return methods
+}
+
+// base returns the earliest height not pruned, n.mu must be held
+func (n *Node) base() int64 {
+	base := int64(1)
+	for moved := true; moved; {
+		moved = false
+		for _, r := range n.pruned {
+			if r.from <= base && base <= r.to {
+				base = r.to + 1
+				moved = true
+			}
+		}
+	}
+	return base
+}
+
+// isPruned reports whether height was pruned, n.mu must be held
+func (n *Node) isPruned(height int64) bool {
+	for _, r := range n.pruned {
+		if r.from <= height && height <= r.to {
+			return true
+		}
+	}
+	return false
+}
+
+// height resolves the optional height of a request like CometBFT: the
+// latest height when nil, else a height between the base and latest
+func (n *Node) height(heightPtr *int64, latest int64) (int64, error) {
+	if heightPtr == nil {
+		return latest, nil
+	}
+
+	height := *heightPtr
+	if height <= 0 {
+		return 0, fmt.Errorf("height must be greater than 0, but got %d", height)
+	}
+	if height > latest {
+		return 0, fmt.Errorf("height %d must be less than or equal to the current blockchain height %d", height, latest)
+	}
+
+	n.mu.Lock()
+	base := n.base()
+	n.mu.Unlock()
+	if height < base {
+		return 0, fmt.Errorf("height %d is not available, lowest height is %d", height, base)
+	}
+	return height, nil
+}
+
+// available reports whether the node has the block at height
+func (n *Node) available(height int64) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return height >= 1 && !n.isPruned(height)
+}
+
+func (n *Node) status(*rpctypes.Context) (*coretypes.ResultStatus, error) {
+	latest := n.chain.Height()
+
+	n.mu.Lock()
+	base := n.base()
+	catchingUp := n.catchingUp
+	n.mu.Unlock()
+
+	result := &coretypes.ResultStatus{
+		NodeInfo: p2p.DefaultNodeInfo{Network: n.chain.ChainID()},
+		SyncInfo: coretypes.SyncInfo{
+			LatestBlockHeight:   latest,
+			EarliestBlockHeight: base,
+			CatchingUp:          catchingUp,
+		},
+	}
+	if latest > 0 {
+		block, meta := n.chain.meta(latest)
+		result.SyncInfo.LatestBlockHash = meta.BlockID.Hash
+		result.SyncInfo.LatestBlockTime = block.Time
+	}
+	if base <= latest {
+		block, meta := n.chain.meta(base)
+		result.SyncInfo.EarliestBlockHash = meta.BlockID.Hash
+		result.SyncInfo.EarliestBlockTime = block.Time
+	}
+	return result, nil
+}
+
+func (n *Node) block(_ *rpctypes.Context, heightPtr *int64) (*coretypes.ResultBlock, error) {
+	height, err := n.height(heightPtr, n.chain.Height())
+	if err != nil {
+		return nil, err
+	}
+
+	// Like a node missing the block, answer without one
+	if !n.available(height) {
+		return &coretypes.ResultBlock{}, nil
+	}
+
+	block, meta := n.chain.meta(height)
+	return &coretypes.ResultBlock{BlockID: meta.BlockID, Block: block}, nil
+}
+
+// blockchain answers like CometBFT: at most maxBlockMetas metas in descending
+// order, silently narrowed to the heights the node has
+func (n *Node) blockchain(_ *rpctypes.Context, minHeight, maxHeight int64) (*coretypes.ResultBlockchainInfo, error) {
+	latest := n.chain.Height()
+
+	n.mu.Lock()
+	base := n.base()
+	n.mu.Unlock()
+
+	if minHeight < 0 || maxHeight < 0 {
+		return nil, fmt.Errorf("heights must be non-negative")
+	}
+	if minHeight == 0 {
+		minHeight = 1
+	}
+	if maxHeight == 0 {
+		maxHeight = latest
+	}
+	maxHeight = min(maxHeight, latest)
+	minHeight = max(minHeight, base, maxHeight-maxBlockMetas+1)
+	if minHeight > maxHeight {
+		return nil, fmt.Errorf("min height %d can't be greater than max height %d", minHeight, maxHeight)
+	}
+
+	result := &coretypes.ResultBlockchainInfo{LastHeight: latest}
+	for height := maxHeight; height >= minHeight; height-- {
+		if n.available(height) {
+			_, meta := n.chain.meta(height)
+			result.BlockMetas = append(result.BlockMetas, meta)
+		}
+	}
+	return result, nil
+}
+
+func (n *Node) blockResults(_ *rpctypes.Context, heightPtr *int64) (*coretypes.ResultBlockResults, error) {
+	height, err := n.height(heightPtr, n.chain.Height())
+	if err != nil {
+		return nil, err
+	}
+	if !n.available(height) {
+		return nil, fmt.Errorf("could not find results for height #%d", height)
+	}
+	return n.chain.blockResults(height), nil
+}
+
+// validators pages through the validator set of a height, which may be the
+// height after the latest like on a node
+func (n *Node) validators(_ *rpctypes.Context, heightPtr *int64, pagePtr, perPagePtr *int) (*coretypes.ResultValidators, error) {
+	latest := n.chain.Height()
+	height, err := n.height(heightPtr, latest+1)
+	if err != nil {
+		return nil, err
+	}
+
+	vals := n.chain.validators(height).Validators
+	total := len(vals)
+
+	perPage := defaultPerPage
+	if perPagePtr != nil && *perPagePtr > 0 {
+		perPage = min(*perPagePtr, maxPerPage)
+	}
+	page := 1
+	if pagePtr != nil {
+		pages := max((total-1)/perPage+1, 1)
+		if *pagePtr <= 0 || *pagePtr > pages {
+			return nil, fmt.Errorf("page should be within [1, %d] range, given %d", pages, *pagePtr)
+		}
+		page = *pagePtr
+	}
+
+	skip := (page - 1) * perPage
+	vals = vals[skip:min(skip+perPage, total)]
+	return &coretypes.ResultValidators{
+		BlockHeight: height,
+		Validators:  vals,
+		Count:       len(vals),
+		Total:       total,
+	}, nil
+}
+
+// abciQuery pages through the validators of the staking module, the only
+// application query the node knows. Page keys are offsets
+func (n *Node) abciQuery(_ *rpctypes.Context, path string, data cmtbytes.HexBytes, _ int64, _ bool) (*coretypes.ResultABCIQuery, error) {
+	if path != stakingValidatorsPath {
+		return &coretypes.ResultABCIQuery{Response: abci.ResponseQuery{
+			Code:      unknownRequestCode,
+			Codespace: "sdk",
+			Log:       fmt.Sprintf("unknown query path %s", path),
+		}}, nil
+	}
+
+	var req stakingtypes.QueryValidatorsRequest
+	if err := req.Unmarshal(data); err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+
+	vals := n.chain.stakingValidators()
+	offset, limit := 0, defaultPerPage
+	if page := req.Pagination; page != nil {
+		if len(page.Key) > 0 {
+			var err error
+			if offset, err = strconv.Atoi(string(page.Key)); err != nil {
+				return nil, fmt.Errorf("invalid page key %q", page.Key)
+			}
+		}
+		if page.Limit > 0 {
+			limit = int(page.Limit)
+		}
+	}
+	offset = min(offset, len(vals))
+	end := min(offset+limit, len(vals))
+
+	resp := &stakingtypes.QueryValidatorsResponse{
+		Validators: vals[offset:end],
+		Pagination: &query.PageResponse{Total: uint64(len(vals))},
+	}
+	if end < len(vals) {
+		resp.Pagination.NextKey = []byte(strconv.Itoa(end))
+	}
+	value, err := resp.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return &coretypes.ResultABCIQuery{Response: abci.ResponseQuery{Value: value, Height: n.chain.Height()}}, nil
+}
+
+// subscribe streams NewBlock events of appended blocks to the websocket
+// connection of ctx until it closes or unsubscribes
+func (n *Node) subscribe(ctx *rpctypes.Context, query string) (*coretypes.ResultSubscribe, error) {
+	if query != tmtypes.EventQueryNewBlock.String() {
+		return nil, fmt.Errorf("only %s can be subscribed to, got %s", tmtypes.EventQueryNewBlock, query)
+	}
+
+	conn := ctx.WSConn
+	addr := conn.GetRemoteAddr()
+
+	n.mu.Lock()
+	if n.subscriptions[addr] == nil {
+		n.subscriptions[addr] = make(map[string]func())
+	}
+	if _, ok := n.subscriptions[addr][query]; ok {
+		n.mu.Unlock()
+		return nil, fmt.Errorf("already subscribed")
+	}
+	heights, cancelHeights := n.chain.subscribe()
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	n.subscriptions[addr][query] = func() {
+		stopOnce.Do(func() {
+			cancelHeights()
+			close(stop)
+		})
+	}
+	n.calls["subscribe"]++
+	n.mu.Unlock()
+
+	// Events answer the subscribe request, like on a node
+	id := ctx.JSONReq.ID
+	go func() {
+		defer n.cancelSubscription(addr, query)
+
+		for {
+			select {
+			case <-conn.Context().Done():
+				return
+			case <-n.done:
+				return
+			case <-stop:
+				return
+			case height := <-heights:
+				n.mu.Lock()
+				muted := n.muted
+				n.mu.Unlock()
+				if muted {
+					continue
+				}
+
+				block, meta := n.chain.meta(height)
+				event := &coretypes.ResultEvent{
+					Query:  query,
+					Data:   tmtypes.EventDataNewBlock{Block: block, BlockID: meta.BlockID},
+					Events: map[string][]string{tmtypes.EventTypeKey: {tmtypes.EventNewBlock}},
+				}
+
+				writeCtx, cancel := context.WithTimeout(conn.Context(), eventWriteTimeout)
+				err := conn.WriteRPCResponse(writeCtx, rpctypes.NewRPCSuccessResponse(id, event))
+				cancel()
+				if err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	return &coretypes.ResultSubscribe{}, nil
+}
+
+func (n *Node) unsubscribe(ctx *rpctypes.Context, query string) (*coretypes.ResultUnsubscribe, error) {
+	if !n.cancelSubscription(ctx.WSConn.GetRemoteAddr(), query) {
+		return nil, fmt.Errorf("subscription not found")
+	}
+	return &coretypes.ResultUnsubscribe{}, nil
+}
+
+func (n *Node) unsubscribeAll(ctx *rpctypes.Context) (*coretypes.ResultUnsubscribe, error) {
+	addr := ctx.WSConn.GetRemoteAddr()
+
+	n.mu.Lock()
+	queries := make([]string, 0, len(n.subscriptions[addr]))
+	for query := range n.subscriptions[addr] {
+		queries = append(queries, query)
+	}
+	n.mu.Unlock()
+
+	if len(queries) == 0 {
+		return nil, fmt.Errorf("subscription not found")
+	}
+	for _, query := range queries {
+		n.cancelSubscription(addr, query)
+	}
+	return &coretypes.ResultUnsubscribe{}, nil
+}
+
+// cancelSubscription ends the subscription of addr to query and reports
+// whether there was one
+func (n *Node) cancelSubscription(addr, query string) bool {
+	n.mu.Lock()
+	cancel, ok := n.subscriptions[addr][query]
+	delete(n.subscriptions[addr], query)
+	if len(n.subscriptions[addr]) == 0 {
+		delete(n.subscriptions, addr)
+	}
+	n.mu.Unlock()
+
+	if ok {
+		cancel()
+	}
+	return ok
+}
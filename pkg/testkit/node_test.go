@@ -0,0 +1,261 @@
+package testkit
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	rpchttp "github.com/cometbft/cometbft/rpc/client/http"
+	tmtypes "github.com/cometbft/cometbft/types"
+	sdked25519 "github.com/cosmos/cosmos-sdk/crypto/keys/ed25519"
+	"github.com/cosmos/cosmos-sdk/types/query"
+	stakingtypes "github.com/cosmos/cosmos-sdk/x/staking/types"
+)
+
+func newTestNode(t *testing.T, blocks int) (*Chain, *Node, *rpchttp.HTTP) {
+	chain := NewChain("test-1",
+		Validator{Name: "alpha", Power: 50},
+		Validator{Name: "beta", Power: 30},
+		Validator{Name: "gamma", Power: 20},
+	)
+	chain.Append(make([]Block, blocks)...)
+
+	node := NewNode(t, chain)
+	c, err := rpchttp.New(node.URL, "/websocket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chain, node, c
+}
+
+func TestNodeBlocks(t *testing.T) {
+	chain, _, c := newTestNode(t, 30)
+	chain.Append(Block{Time: GenesisTime.Add(time.Hour), Txs: 3, GasWanted: 200, GasUsed: 150, Round: 1, Absent: []string{"gamma"}})
+	ctx := context.Background()
+
+	status, err := c.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.NodeInfo.Network != "test-1" || status.SyncInfo.LatestBlockHeight != 31 || status.SyncInfo.EarliestBlockHeight != 1 {
+		t.Errorf("got status %+v", status.SyncInfo)
+	}
+
+	height := int64(31)
+	result, err := c.Block(ctx, &height)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := result.Block
+	if len(block.Txs) != 3 || !block.Time.Equal(GenesisTime.Add(time.Hour)) || block.Hash().String() != chain.Block(31).Hash().String() {
+		t.Errorf("got block %d at %s with %d txs", block.Height, block.Time, len(block.Txs))
+	}
+	if block.LastBlockID.Hash.String() != chain.Block(30).Hash().String() {
+		t.Errorf("block 31 does not link to block 30")
+	}
+
+	// The commit of block 30 in block 31 is signed by the validators of block 30
+	height = 30
+	vals, err := c.Validators(ctx, &height, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tmtypes.NewValidatorSet(vals.Validators).VerifyCommit("test-1", block.LastBlockID, 30, block.LastCommit)
+	if err != nil {
+		t.Errorf("commit of block 30 does not verify: %v", err)
+	}
+	if block.LastCommit.Round != 1 || !block.LastCommit.Signatures[2].Absent() || block.LastCommit.Signatures[0].BlockIDFlag != tmtypes.BlockIDFlagCommit {
+		t.Errorf("got commit of block 30 in round %d with %+v", block.LastCommit.Round, block.LastCommit.Signatures)
+	}
+
+	// Blocks of DefaultBlockTime come in descending order, 20 at most
+	info, err := c.BlockchainInfo(ctx, 1, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.BlockMetas) != 20 || info.BlockMetas[0].Header.Height != 30 || info.LastHeight != 31 {
+		t.Fatalf("got %d metas from height %d", len(info.BlockMetas), info.BlockMetas[0].Header.Height)
+	}
+	if want := GenesisTime.Add(29 * DefaultBlockTime); !info.BlockMetas[0].Header.Time.Equal(want) {
+		t.Errorf("got block 30 at %s, want %s", info.BlockMetas[0].Header.Time, want)
+	}
+
+	height = 31
+	results, err := c.BlockResults(ctx, &height)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results.TxsResults) != 3 || results.TxsResults[0].GasUsed != 150 || results.TxsResults[2].GasWanted != 200 {
+		t.Errorf("got results %+v", results.TxsResults)
+	}
+}
+
+func TestNodeProposerRotation(t *testing.T) {
+	chain, _, c := newTestNode(t, 100)
+
+	proposed := make(map[string]int)
+	for height := int64(1); height <= 100; height++ {
+		proposed[chain.Block(height).ProposerAddress.String()]++
+	}
+	for name, want := range map[string]int{"alpha": 50, "beta": 30, "gamma": 20} {
+		if got := proposed[chain.Address(name)]; got != want {
+			t.Errorf("%s proposed %d blocks, want %d", name, got, want)
+		}
+	}
+
+	// Validators are paged like on a node
+	height, page, perPage := int64(50), 2, 2
+	vals, err := c.Validators(context.Background(), &height, &page, &perPage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vals.Total != 3 || vals.Count != 1 || vals.Validators[0].Address.String() != chain.Address("gamma") {
+		t.Errorf("got validators %+v", vals)
+	}
+
+	page = 3
+	if _, err := c.Validators(context.Background(), &height, &page, &perPage); err == nil || !strings.Contains(err.Error(), "page should be within [1, 2] range") {
+		t.Errorf("got error %v for a page past the end", err)
+	}
+}
+
+func TestNodeStakingValidators(t *testing.T) {
+	chain, _, c := newTestNode(t, 5)
+	ctx := context.Background()
+
+	// Two validators per page, the last page holds the third
+	var vals []stakingtypes.Validator
+	req := &stakingtypes.QueryValidatorsRequest{Pagination: &query.PageRequest{Limit: 2}}
+	for page := 1; ; page++ {
+		data, err := req.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := c.ABCIQuery(ctx, stakingValidatorsPath, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var resp stakingtypes.QueryValidatorsResponse
+		if err := resp.Unmarshal(result.Response.Value); err != nil {
+			t.Fatal(err)
+		}
+		vals = append(vals, resp.Validators...)
+		if len(resp.Pagination.NextKey) == 0 {
+			if page != 2 || resp.Pagination.Total != 3 {
+				t.Errorf("got %d pages of %d validators", page, resp.Pagination.Total)
+			}
+			break
+		}
+		req.Pagination.Key = resp.Pagination.NextKey
+	}
+
+	for i, name := range []string{"alpha", "beta", "gamma"} {
+		val := vals[i]
+		var key sdked25519.PubKey
+		if err := key.Unmarshal(val.ConsensusPubkey.Value); err != nil {
+			t.Fatal(err)
+		}
+		if val.Description.Moniker != name || val.OperatorAddress != chain.OperatorAddress(name) || key.Address().String() != chain.Address(name) {
+			t.Errorf("got validator %s with key of %s, want %s", val.Description.Moniker, key.Address(), name)
+		}
+	}
+	if !strings.HasPrefix(vals[0].OperatorAddress, OperatorPrefix+"1") {
+		t.Errorf("got operator address %s", vals[0].OperatorAddress)
+	}
+
+	result, err := c.ABCIQuery(ctx, "/cosmos.bank.v1beta1.Query/TotalSupply", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Response.Code != unknownRequestCode {
+		t.Errorf("got code %d for an unknown query", result.Response.Code)
+	}
+}
+
+func TestNodeFaults(t *testing.T) {
+	_, node, c := newTestNode(t, 40)
+	ctx := context.Background()
+
+	node.Fail("status", 429, 2)
+	node.Fail("", 503, 1)
+	for i, want := range []string{"Status: 429", "Status: 429", "Status: 503", ""} {
+		_, err := c.Status(ctx)
+		if want == "" && err != nil || want != "" && (err == nil || !strings.Contains(err.Error(), want)) {
+			t.Errorf("call %d: got error %v, want %q", i+1, err, want)
+		}
+	}
+	if got := node.Calls("status"); got != 4 {
+		t.Errorf("got %d status calls, want 4", got)
+	}
+
+	node.SetLatency(50 * time.Millisecond)
+	start := time.Now()
+	if _, err := c.Status(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("call took %s with 50ms latency", elapsed)
+	}
+	node.SetLatency(0)
+
+	node.Prune(1, 10)
+	node.Prune(15, 16)
+	status, err := c.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.SyncInfo.EarliestBlockHeight != 11 {
+		t.Errorf("got earliest height %d, want 11", status.SyncInfo.EarliestBlockHeight)
+	}
+
+	height := int64(5)
+	if _, err := c.Block(ctx, &height); err == nil || !strings.Contains(err.Error(), "lowest height is 11") {
+		t.Errorf("got error %v for a pruned height", err)
+	}
+	height = 15
+	if result, err := c.Block(ctx, &height); err != nil || result.Block != nil {
+		t.Errorf("got block %v, error %v for a hole", result, err)
+	}
+
+	// Pruned heights are silently left out
+	info, err := c.BlockchainInfo(ctx, 1, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.BlockMetas) != 8 || info.BlockMetas[len(info.BlockMetas)-1].Header.Height != 11 {
+		t.Errorf("got %d metas down to height %d", len(info.BlockMetas), info.BlockMetas[len(info.BlockMetas)-1].Header.Height)
+	}
+}
+
+func TestNodeSubscribe(t *testing.T) {
+	chain, node, c := newTestNode(t, 10)
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	events, err := c.Subscribe(ctx, "test", tmtypes.EventQueryNewBlock.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node.Calls("subscribe") != 1 {
+		t.Fatalf("got %d subscriptions", node.Calls("subscribe"))
+	}
+
+	chain.Append(make([]Block, 3)...)
+	for want := int64(11); want <= 13; want++ {
+		select {
+		case event := <-events:
+			data, ok := event.Data.(tmtypes.EventDataNewBlock)
+			if !ok || data.Block.Height != want || data.Block.Hash().String() != chain.Block(want).Hash().String() {
+				t.Fatalf("got event %+v, want block %d", event.Data, want)
+			}
+		case <-ctx.Done():
+			t.Fatalf("no event for block %d", want)
+		}
+	}
+}
@@ -6,12 +6,59 @@ import (
 
 // BlockInfo represents block information
 type BlockInfo struct {
-	Height    int64     `json:"height"`
-	Time      time.Time `json:"time"`
-	Hash      string    `json:"hash"`
-	Proposer  string    `json:"proposer"`
-	TxCount   int       `json:"tx_count"`
-	BlockTime float64   `json:"block_time"` // seconds between this and previous block
+	Height     int64     `json:"height"`
+	Time       time.Time `json:"time"`
+	Hash       string    `json:"hash"`        // hash of this block
+	ParentHash string    `json:"parent_hash"` // hash of the previous block, from the header's LastBlockID
+	Proposer   string    `json:"proposer"`
+	TxCount    int       `json:"tx_count"`
+	BlockTime  float64   `json:"block_time"` // seconds between this and previous block
+	Verified   bool      `json:"verified"`   // header was verified by the light client
+
+	Commit *CommitInfo `json:"commit,omitempty"` // last commit of the block, nil when it was not fetched
+	Load   *LoadInfo   `json:"load,omitempty"`   // execution results and size of the block, nil when they were not fetched
+}
+
+// LoadInfo is the load a block put on the chain, from its execution results
+// and its encoded size
+type LoadInfo struct {
+	GasUsed   int64 `json:"gas_used"`   // gas used by all transactions
+	GasWanted int64 `json:"gas_wanted"` // gas wanted by all transactions
+	Events    int   `json:"events"`     // events emitted by the transactions and the block
+	Size      int   `json:"size"`       // size of the block in bytes
+}
+
+// CommitInfo summarizes the LastCommit of a block: the votes that committed
+// the previous block. A commit in a later round means the previous height
+// needed extra rounds, which delays this block by at least a round timeout.
+type CommitInfo struct {
+	Round       int32   `json:"round"`        // consensus round the previous block was committed in
+	Signatures  int     `json:"signatures"`   // validators that signed for the previous block
+	Absent      int     `json:"absent"`       // validators whose vote is missing
+	Nil         int     `json:"nil"`          // validators that voted nil
+	SignedPower float64 `json:"signed_power"` // fraction of voting power that signed, 0 if the validator set is unknown
+}
+
+// MissingBlock represents a height that could not be fetched
+type MissingBlock struct {
+	Height int64  `json:"height"`
+	Reason string `json:"reason"`
+}
+
+// NodeStatus represents the status reported by a node
+type NodeStatus struct {
+	ChainID        string `json:"chain_id"`
+	LatestHeight   int64  `json:"latest_height"`
+	EarliestHeight int64  `json:"earliest_height"` // lowest height the node still has, 0 if unknown
+	CatchingUp     bool   `json:"catching_up"`     // node is still syncing and behind the chain
+}
+
+// ValidatorInfo describes a validator proposing blocks
+type ValidatorInfo struct {
+	Address         string `json:"address"`                    // hex consensus address, as in block headers
+	Moniker         string `json:"moniker,omitempty"`          // from the staking module, empty when it could not be queried
+	OperatorAddress string `json:"operator_address,omitempty"` // bech32 valoper address, empty when the staking module could not be queried
+	VotingPower     int64  `json:"voting_power"`               // at the last analyzed height the validator was in the set
 }
 
 // BlockTimeStats represents statistical analysis of block times
@@ -26,38 +73,116 @@ type BlockTimeStats struct {
 	StdDev           float64   `json:"std_dev"`
 	Min              float64   `json:"min"`
 	Max              float64   `json:"max"`
-	P25              float64   `json:"p25"`  // 25th percentile
-	P75              float64   `json:"p75"`  // 75th percentile
-	P95              float64   `json:"p95"`  // 95th percentile
-	P99              float64   `json:"p99"`  // 99th percentile
+	P25              float64   `json:"p25"` // 25th percentile
+	P75              float64   `json:"p75"` // 75th percentile
+	P95              float64   `json:"p95"` // 95th percentile
+	P99              float64   `json:"p99"` // 99th percentile
 	OutlierCount     int       `json:"outlier_count"`
+	GapCount         int       `json:"gap_count"`         // runs of consecutive missing heights
+	MissingBlocks    int       `json:"missing_blocks"`    // heights that could not be fetched
+	Verified         bool      `json:"verified"`          // every header was verified by the light client
+	UnverifiedBlocks int       `json:"unverified_blocks"` // blocks whose header was not verified
+	Resolution       float64   `json:"resolution"`        // timestamp granularity in seconds, 0 if finer than a second
 	EstimatedRange   Range     `json:"estimated_range"`
 	ConfidenceLevel  float64   `json:"confidence_level"`
+
+	Rounds *RoundStats `json:"rounds,omitempty"` // block times split by commit round, when the commits were fetched
+	Load   *LoadStats  `json:"load,omitempty"`   // block times related to block load, when the execution results were fetched
+}
+
+// LoadStats relates block times to the load of blocks. The time between
+// blocks H-1 and H is the time block H-1 took to be agreed on, so it is
+// paired with the load of block H-1.
+type LoadStats struct {
+	Blocks    int             `json:"blocks"` // block times with a known load
+	GasUsed   LoadCorrelation `json:"gas_used"`
+	GasWanted LoadCorrelation `json:"gas_wanted"`
+	Txs       LoadCorrelation `json:"txs"`
+	Events    LoadCorrelation `json:"events"`
+	Size      LoadCorrelation `json:"size"`
+}
+
+// LoadCorrelation fits block times to a load metric by least squares
+type LoadCorrelation struct {
+	Correlation float64 `json:"correlation"` // Pearson coefficient, 0 when the metric or the block time is constant
+	Slope       float64 `json:"slope"`       // seconds of block time per unit of the metric
+	Intercept   float64 `json:"intercept"`   // block time in seconds at zero load
+}
+
+// RoundStats splits block times by the round of the commit before each block
+type RoundStats struct {
+	FirstRound  RoundGroup `json:"first_round"`  // blocks after a commit in round 0
+	LaterRounds RoundGroup `json:"later_rounds"` // blocks after a commit in round 1 or later
+
+	// Blocks slower than the P95 block time, and the fraction of them that
+	// followed a commit in a later round
+	TailBlocks      int     `json:"tail_blocks"`
+	TailLaterRounds float64 `json:"tail_later_rounds"`
+}
+
+// RoundGroup summarizes the block times of the blocks of some commit rounds
+type RoundGroup struct {
+	Blocks int     `json:"blocks"`
+	Share  float64 `json:"share"` // fraction of the blocks with a known round
+	Mean   float64 `json:"mean"`
+	Median float64 `json:"median"`
+	P95    float64 `json:"p95"`
 }
 
 // Range represents an estimated range for block times
 type Range struct {
-	Lower  float64 `json:"lower"`
-	Upper  float64 `json:"upper"`
+	Lower   float64 `json:"lower"`
+	Upper   float64 `json:"upper"`
 	Typical float64 `json:"typical"` // Most common block time
 }
 
 // ChainConfig represents blockchain connection configuration
 type ChainConfig struct {
-	RPCEndpoint    string        `json:"rpc_endpoint" mapstructure:"rpc_endpoint"`
-	GRPCEndpoint   string        `json:"grpc_endpoint" mapstructure:"grpc_endpoint"`
-	ChainID        string        `json:"chain_id" mapstructure:"chain_id"`
-	Timeout        time.Duration `json:"timeout" mapstructure:"timeout"`
-	MaxRetries     int           `json:"max_retries" mapstructure:"max_retries"`
-	RetryDelay     time.Duration `json:"retry_delay" mapstructure:"retry_delay"`
+	RPCEndpoint       string        `json:"rpc_endpoint" mapstructure:"rpc_endpoint"`
+	RPCEndpoints      []string      `json:"rpc_endpoints,omitempty" mapstructure:"rpc_endpoints"` // Several endpoints of the same chain for failover
+	GRPCEndpoint      string        `json:"grpc_endpoint" mapstructure:"grpc_endpoint"`
+	GRPCEndpoints     []string      `json:"grpc_endpoints,omitempty" mapstructure:"grpc_endpoints"` // Several gRPC endpoints for failover
+	RESTEndpoint      string        `json:"rest_endpoint" mapstructure:"rest_endpoint"`
+	RESTEndpoints     []string      `json:"rest_endpoints,omitempty" mapstructure:"rest_endpoints"` // Several REST endpoints for failover
+	EVMEndpoint       string        `json:"evm_endpoint" mapstructure:"evm_endpoint"`
+	Home              string        `json:"home" mapstructure:"home"`                               // Node home directory to read blocks from offline
+	FromFile          string        `json:"from_file" mapstructure:"from_file"`                     // JSONL or CSV file of exported blocks to replay instead of querying a node
+	Simulate          string        `json:"simulate" mapstructure:"simulate"`                       // YAML spec of a simulated chain to query instead of a node
+	Commits           bool          `json:"commits" mapstructure:"commits"`                         // Record the last commit of every block, which takes full blocks instead of headers
+	Load              bool          `json:"load" mapstructure:"load"`                               // Attach the gas, events and size of every block from its execution results
+	Transport         string        `json:"transport" mapstructure:"transport"`                     // rpc, grpc, rest or evm
+	SkipChainIDCheck  bool          `json:"skip_chain_id_check" mapstructure:"skip_chain_id_check"` // Use nodes serving another chain than ChainID
+	AllowCatchingUp   bool          `json:"allow_catching_up" mapstructure:"allow_catching_up"`     // Use nodes that are still syncing
+	ChainID           string        `json:"chain_id" mapstructure:"chain_id"`
+	Bech32Prefix      string        `json:"bech32_prefix" mapstructure:"bech32_prefix"` // Account address prefix, e.g. cosmos
+	Timeout           time.Duration `json:"timeout" mapstructure:"timeout"`
+	MaxRetries        int           `json:"max_retries" mapstructure:"max_retries"`
+	RetryDelay        time.Duration `json:"retry_delay" mapstructure:"retry_delay"`
+	MaxConcurrency    int           `json:"max_concurrency" mapstructure:"max_concurrency"`         // Upper bound of concurrent requests per endpoint
+	RequestsPerSecond float64       `json:"requests_per_second" mapstructure:"requests_per_second"` // Request rate limit per endpoint, 0 for unlimited
+	Light             LightConfig   `json:"light" mapstructure:"light"`
+
+	// Logf logs client events such as concurrency cuts when set
+	Logf func(format string, args ...any) `json:"-" mapstructure:"-"`
+}
+
+// LightConfig represents light client verification configuration
+type LightConfig struct {
+	Enabled     bool          `json:"enabled" mapstructure:"enabled"`           // Verify fetched headers with a light client
+	TrustHeight int64         `json:"trust_height" mapstructure:"trust_height"` // Height of the trusted header
+	TrustHash   string        `json:"trust_hash" mapstructure:"trust_hash"`     // Hex hash of the trusted header
+	TrustPeriod time.Duration `json:"trust_period" mapstructure:"trust_period"` // How long headers are trusted, well below the unbonding period
+	Witnesses   []string      `json:"witnesses" mapstructure:"witnesses"`       // RPC endpoints cross-checking the primary
 }
 
 // CalculatorConfig represents calculator configuration
 type CalculatorConfig struct {
-	SampleSize          int     `json:"sample_size" mapstructure:"sample_size"`                     // Number of blocks to analyze
-	OutlierThreshold    float64 `json:"outlier_threshold" mapstructure:"outlier_threshold"`         // IQR multiplier for outlier detection
-	ConfidenceLevel     float64 `json:"confidence_level" mapstructure:"confidence_level"`           // Confidence level for range estimation (e.g., 0.95)
-	MinSampleSize       int     `json:"min_sample_size" mapstructure:"min_sample_size"`             // Minimum blocks required for analysis
-	TrimPercent         float64 `json:"trim_percent" mapstructure:"trim_percent"`                   // Percentage of extremes to trim (e.g., 0.05 for 5%)
-	UseMedianAbsolute   bool    `json:"use_median_absolute" mapstructure:"use_median_absolute"`     // Use MAD instead of standard deviation
-}
\ No newline at end of file
+	SampleSize        int     `json:"sample_size" mapstructure:"sample_size"`                 // Number of blocks to analyze
+	OutlierThreshold  float64 `json:"outlier_threshold" mapstructure:"outlier_threshold"`     // IQR multiplier for outlier detection
+	ConfidenceLevel   float64 `json:"confidence_level" mapstructure:"confidence_level"`       // Confidence level for range estimation (e.g., 0.95)
+	MinSampleSize     int     `json:"min_sample_size" mapstructure:"min_sample_size"`         // Minimum blocks required for analysis
+	TrimPercent       float64 `json:"trim_percent" mapstructure:"trim_percent"`               // Percentage of extremes to trim (e.g., 0.05 for 5%)
+	UseMedianAbsolute bool    `json:"use_median_absolute" mapstructure:"use_median_absolute"` // Use MAD instead of standard deviation
+	AllowGaps         bool    `json:"allow_gaps" mapstructure:"allow_gaps"`                   // Skip heights that cannot be fetched instead of failing
+	VerifyLinkage     bool    `json:"verify_linkage" mapstructure:"verify_linkage"`           // Check that every block links to its predecessor by hash
+}